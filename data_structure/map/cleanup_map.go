@@ -1,27 +1,35 @@
 package map_data_structure
 
 import (
-	"sync/atomic"
 	"time"
 )
 
-var (
-	atomicRegistry atomic.Pointer[[]*TTLMap[any, any]]
+const (
+	DefaultCleanerResolution     = 100 * time.Millisecond
+	DefaultMaxExpirationsPerTick = 10000
 )
 
-func init() {
-	atomicRegistry.Store(&[]*TTLMap[any, any]{})
+// CleanerOptions tune how expired items are deleted in the background. Zero values take the defaults.
+type CleanerOptions struct {
+	// Resolution is how often the cleaner wakes up, an item is deleted at most one resolution after it expires
+	// unless more items expire at once than a tick deletes
+	Resolution time.Duration
+	// MaxExpirationsPerTick bounds the items deleted per wake-up, so a burst of expirations is spread over several ticks
+	MaxExpirationsPerTick int
 }
 
-func StartGlobalCleaner() {
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		for range ticker.C {
-			registrySlice := atomicRegistry.Load()
-			mapsToClean := *registrySlice
-			for _, m := range mapsToClean {
-				m.cleanExpiredItems()
-			}
-		}
-	}()
+// cleaner deletes the items of every TTLMap once they expire. Items are scheduled when they are set, it only runs
+// while some are waiting, and a released map drops out of it without being looked at.
+var cleaner = newTimingWheel(CleanerOptions{})
+
+// ConfigureCleaner changes the options of the cleaner, the items already scheduled are kept.
+func ConfigureCleaner(options CleanerOptions) {
+	cleaner.reconfigure(options)
+}
+
+// ScheduledExpirations returns how many entries the cleaner holds, an item given more time keeps the entry it has.
+func ScheduledExpirations() int {
+	cleaner.mu.Lock()
+	defer cleaner.mu.Unlock()
+	return cleaner.count
 }
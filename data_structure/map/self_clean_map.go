@@ -2,34 +2,97 @@ package map_data_structure
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
 type Item[V any] struct {
 	value      *V
 	expiration int64
+	// scheduled is the expiration the cleaner has an entry of the key for, -1 for none. An item given more time keeps the entry,
+	// which schedules the item again when it finds it still live, so refreshing an item does not pile up entries.
+	scheduled int64
 }
 
+// TTLMap is a concurrent map whose items expire, an expired item is deleted by the cleaner shortly after it expires
+// and is never returned before that.
 type TTLMap[K any, V any] struct {
 	innerMap sync.Map
+	// isReleased makes the cleaner drop the items it still has scheduled for the map
+	isReleased atomic.Bool
+	onExpire   atomic.Pointer[func(key K, value *V)]
 }
 
-func (ttlMap *TTLMap[K, V]) cleanExpiredItems() {
-	now := time.Now().UnixNano()
-	ttlMap.innerMap.Range(func(key, val any) bool {
-		item := val.(Item[V])
-		if item.expiration != -1 && now > item.expiration {
-			ttlMap.innerMap.Delete(key)
+func NewTTLMap[K any, V any]() *TTLMap[K, V] {
+	return &TTLMap[K, V]{}
+}
+
+// newItem returns the item replacing previous, it takes over the entry previous is scheduled with unless that comes too late.
+// schedule tells whether the item needs an entry of its own.
+func newItem[V any](value *V, expiration int64, previous any) (item Item[V], schedule bool) {
+	item = Item[V]{value: value, expiration: expiration, scheduled: expiration}
+	if previous != nil {
+		if scheduled := previous.(Item[V]).scheduled; scheduled != -1 && (expiration == -1 || scheduled <= expiration) {
+			item.scheduled = scheduled
+			return item, false
 		}
-		return true
-	})
+	}
+	return item, expiration != -1
 }
 
-func NewTTLMap[K any, V any]() *TTLMap[K, V] {
-	m := &TTLMap[K, V]{}
-	registerTTLMap(m)
-	return m
+// schedule has the cleaner look at key once expiration passed.
+func (ttlMap *TTLMap[K, V]) schedule(key any, expiration int64) {
+	cleaner.schedule(ttlMap, key, expiration)
+}
+
+// expireKey deletes key when it expired, and schedules it again when it was given more time since the entry was scheduled.
+// An entry the item no longer refers to is left alone, the item has a later one.
+func (ttlMap *TTLMap[K, V]) expireKey(key any, scheduled int64) {
+	for {
+		stored, ok := ttlMap.innerMap.Load(key)
+		if !ok {
+			return
+		}
+		item := stored.(Item[V])
+		if item.expiration == scheduled || item.expiration != -1 && time.Now().UnixNano() > item.expiration {
+			ttlMap.deleteExpired(key, stored)
+			return
+		}
+		if item.scheduled != scheduled {
+			return
+		}
+		next := item
+		next.scheduled = item.expiration
+		if ttlMap.innerMap.CompareAndSwap(key, stored, next) {
+			if next.scheduled != -1 {
+				ttlMap.schedule(key, next.scheduled)
+			}
+			return
+		}
+	}
+}
+
+// deleteExpired deletes an item found expired, whether by the cleaner or by a read, and reports it to the OnExpire callback
+// once even when several goroutines find it at the same time.
+func (ttlMap *TTLMap[K, V]) deleteExpired(key any, stored any) {
+	if !ttlMap.innerMap.CompareAndDelete(key, stored) {
+		return
+	}
+	if callback := ttlMap.onExpire.Load(); callback != nil {
+		// a nil key, e.g. the bucket of NULL values, is not a K and converts to the zero K
+		typedKey, _ := key.(K)
+		(*callback)(typedKey, stored.(Item[V]).value)
+	}
+}
+
+// OnExpire sets the function called with every item that expires, after it is deleted. It is not called for items deleted
+// with Delete, Clear or Release, and runs on the goroutine that found the item expired, so it must not block.
+func (ttlMap *TTLMap[K, V]) OnExpire(callback func(key K, value *V)) {
+	ttlMap.onExpire.Store(&callback)
+}
+
+func (ttlMap *TTLMap[K, V]) released() bool {
+	return ttlMap.isReleased.Load()
 }
 
 /*func (ttlMap *TTLMap[K, V]) SortKeys() []K {
@@ -71,11 +134,101 @@ func (ttlMap *TTLMap[K, V]) Set(key K, value *V, ttl time.Duration) {
 	} else {
 		expiration = time.Now().Add(ttl).UnixNano()
 	}
+	ttlMap.SetWithExpiration(key, value, expiration)
+}
 
-	ttlMap.innerMap.Store(key, Item[V]{
-		value:      value,
-		expiration: expiration,
-	})
+// SetWithExpiration stores value under key with an absolute expiration in unix nanoseconds,
+// -1 means the item never expires.
+func (ttlMap *TTLMap[K, V]) SetWithExpiration(key K, value *V, expiration int64) {
+	for {
+		previous, loaded := ttlMap.innerMap.Load(key)
+		item, schedule := newItem(value, expiration, previous)
+		if loaded && ttlMap.innerMap.CompareAndSwap(key, previous, item) {
+			if schedule {
+				ttlMap.schedule(key, expiration)
+			}
+			return
+		}
+		if !loaded {
+			if _, loaded = ttlMap.innerMap.LoadOrStore(key, item); !loaded {
+				if schedule {
+					ttlMap.schedule(key, expiration)
+				}
+				return
+			}
+		}
+	}
+}
+
+// GetOrSet returns the live value stored under key, or stores value with ttl when there is none. loaded tells which happened,
+// when several callers race on a missing key exactly one of them stores its value.
+func (ttlMap *TTLMap[K, V]) GetOrSet(key K, value *V, ttl time.Duration) (actual *V, loaded bool) {
+	expiration := int64(-1)
+	if ttl != -1 {
+		expiration = time.Now().Add(ttl).UnixNano()
+	}
+	created, schedule := newItem(value, expiration, nil)
+	for {
+		stored, loaded := ttlMap.innerMap.LoadOrStore(key, created)
+		if !loaded {
+			if schedule {
+				ttlMap.schedule(key, expiration)
+			}
+			return value, false
+		}
+		item := stored.(Item[V])
+		if item.expiration == -1 || time.Now().UnixNano() <= item.expiration {
+			return item.value, true
+		}
+		ttlMap.deleteExpired(key, stored)
+	}
+}
+
+// Update replaces the value stored under key and keeps its current expiration.
+// It returns false when the key does not exist or is already expired.
+func (ttlMap *TTLMap[K, V]) Update(key K, value *V) bool {
+	expiration, ok := ttlMap.Expiration(key)
+	if !ok {
+		return false
+	}
+	ttlMap.SetWithExpiration(key, value, expiration)
+	return true
+}
+
+// SetExpiration changes the absolute expiration of key and keeps its value, -1 means the item never expires.
+// It returns false when the key does not exist or is already expired.
+func (ttlMap *TTLMap[K, V]) SetExpiration(key K, expiration int64) bool {
+	for {
+		stored, ok := ttlMap.innerMap.Load(key)
+		if !ok {
+			return false
+		}
+		item := stored.(Item[V])
+		if item.expiration != -1 && time.Now().UnixNano() > item.expiration {
+			return false
+		}
+		next, schedule := newItem(item.value, expiration, stored)
+		if ttlMap.innerMap.CompareAndSwap(key, stored, next) {
+			if schedule {
+				ttlMap.schedule(key, expiration)
+			}
+			return true
+		}
+	}
+}
+
+// Expiration returns the absolute expiration of key in unix nanoseconds, -1 means no expiration.
+func (ttlMap *TTLMap[K, V]) Expiration(key K) (int64, bool) {
+	val, ok := ttlMap.innerMap.Load(key)
+	if !ok {
+		return 0, false
+	}
+	item := val.(Item[V])
+	if item.expiration != -1 && time.Now().UnixNano() > item.expiration {
+		ttlMap.deleteExpired(key, val)
+		return 0, false
+	}
+	return item.expiration, true
 }
 
 func (ttlMap *TTLMap[K, V]) Get(key K) (*V, bool) {
@@ -86,7 +239,7 @@ func (ttlMap *TTLMap[K, V]) Get(key K) (*V, bool) {
 	}
 	item := val.(Item[V])
 	if item.expiration != -1 && time.Now().UnixNano() > item.expiration {
-		ttlMap.innerMap.Delete(key)
+		ttlMap.deleteExpired(key, val)
 		var zero V
 		return &zero, false
 	}
@@ -97,6 +250,13 @@ func (ttlMap *TTLMap[K, V]) Delete(key K) {
 	ttlMap.innerMap.Delete(key)
 }
 
+// Remove deletes key and reports whether it held an item, also an expired one the cleaner has not deleted yet.
+// An item is reported once, either by Remove or to the OnExpire callback.
+func (ttlMap *TTLMap[K, V]) Remove(key K) bool {
+	_, ok := ttlMap.innerMap.LoadAndDelete(key)
+	return ok
+}
+
 func (ttlMap *TTLMap[K, V]) Len() int {
 	var length int
 	ttlMap.innerMap.Range(func(key, value any) bool {
@@ -110,10 +270,12 @@ func (ttlMap *TTLMap[K, V]) Items(consumer func(key K, value *V) bool) {
 	ttlMap.innerMap.Range(func(k, v any) bool {
 		item := v.(Item[V])
 		if item.expiration != -1 && time.Now().UnixNano() > item.expiration {
-			ttlMap.innerMap.Delete(k)
+			ttlMap.deleteExpired(k, v)
 			return true
 		}
-		return consumer(k.(K), item.value)
+		// a nil key, e.g. the bucket of NULL values, is not a K and converts to the zero K
+		key, _ := k.(K)
+		return consumer(key, item.value)
 	})
 }
 
@@ -124,7 +286,8 @@ func (ttlMap *TTLMap[K, V]) Range(consumer func(index int, value V) bool, offset
 	ttlMap.innerMap.Range(func(k, v any) bool {
 		item := v.(Item[V])
 		if item.expiration == -1 || now <= item.expiration {
-			keys = append(keys, k.(K))
+			key, _ := k.(K)
+			keys = append(keys, key)
 		}
 		return true
 	})
@@ -163,12 +326,14 @@ func (ttlMap *TTLMap[K, V]) DeleteAll(predicate func(value V) bool) {
 	})
 }
 
-func registerTTLMap[K any, V any](m *TTLMap[K, V]) {
-	for {
-		oldSlice := atomicRegistry.Load()
-		newSlice := append(*oldSlice, (*TTLMap[any, any])(unsafe.Pointer(m)))
-		if atomicRegistry.CompareAndSwap(oldSlice, &newSlice) {
-			break
-		}
-	}
+// Clear drops every item of the map.
+func (ttlMap *TTLMap[K, V]) Clear() {
+	ttlMap.innerMap.Clear()
+}
+
+// Release drops every item and the items the cleaner still has scheduled for the map,
+// the map must not be used afterwards.
+func (ttlMap *TTLMap[K, V]) Release() {
+	ttlMap.isReleased.Store(true)
+	ttlMap.innerMap.Clear()
 }
@@ -0,0 +1,196 @@
+package map_data_structure
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 5
+)
+
+// expirable is what the cleaner needs from a map holding an item that expires, whatever its key and value types are.
+type expirable interface {
+	// expireKey deletes key when it expired and schedules it again when it was given more time, see TTLMap.expireKey
+	expireKey(key any, expiration int64)
+	released() bool
+}
+
+type wheelEntry struct {
+	target     expirable
+	key        any
+	expiration int64
+}
+
+// timingWheel schedules the expiration of items in a hierarchy of wheels like the timers of the Linux kernel. Level 0 has a slot
+// per tick of resolution, each slot of level l spans 64 slots of level l-1 and its entries move down a level when level l-1 wraps,
+// so a tick only touches the entries that are due or about to be instead of every item of every map.
+type timingWheel struct {
+	mu         sync.Mutex
+	resolution int64
+	// maxPerTick bounds how many items are deleted per tick, the rest wait in due for the next ticks
+	maxPerTick int
+	// current is the last tick processed, counted in resolutions since the unix epoch
+	current int64
+	slots   [wheelLevels][wheelSlots][]wheelEntry
+	due     []wheelEntry
+	count   int
+	running bool
+	stop    chan struct{}
+}
+
+func newTimingWheel(options CleanerOptions) *timingWheel {
+	wheel := &timingWheel{}
+	wheel.configure(options)
+	return wheel
+}
+
+func (wheel *timingWheel) configure(options CleanerOptions) {
+	if options.Resolution <= 0 {
+		options.Resolution = DefaultCleanerResolution
+	}
+	if options.MaxExpirationsPerTick <= 0 {
+		options.MaxExpirationsPerTick = DefaultMaxExpirationsPerTick
+	}
+	wheel.resolution = int64(options.Resolution)
+	wheel.maxPerTick = options.MaxExpirationsPerTick
+	wheel.current = time.Now().UnixNano() / wheel.resolution
+}
+
+// schedule deletes key from target once expiration has passed, starting the ticker when the wheel was idle.
+func (wheel *timingWheel) schedule(target expirable, key any, expiration int64) {
+	wheel.mu.Lock()
+	defer wheel.mu.Unlock()
+	if wheel.count == 0 {
+		// an idle wheel has not been advanced, nothing can be missed by jumping to now
+		wheel.current = time.Now().UnixNano() / wheel.resolution
+	}
+	wheel.add(wheelEntry{target: target, key: key, expiration: expiration})
+	if !wheel.running {
+		wheel.running = true
+		wheel.stop = make(chan struct{})
+		go wheel.run(time.Duration(wheel.resolution), wheel.stop)
+	}
+}
+
+// add puts entry in the slot of the lowest level whose span reaches its tick, entries further away than the top level spans
+// wait in its last slot and are placed again when it is cascaded.
+func (wheel *timingWheel) add(entry wheelEntry) {
+	wheel.count++
+	// an item expires after the tick its expiration falls in
+	tick := entry.expiration/wheel.resolution + 1
+	delta := tick - wheel.current
+	if delta <= 0 {
+		wheel.due = append(wheel.due, entry)
+		return
+	}
+	for level := 0; level < wheelLevels; level++ {
+		if delta < 1<<(wheelBits*(level+1)) || level == wheelLevels-1 {
+			if level == wheelLevels-1 && delta >= 1<<(wheelBits*wheelLevels) {
+				tick = wheel.current + 1<<(wheelBits*wheelLevels) - 1
+			}
+			slot := (tick >> (wheelBits * level)) & wheelMask
+			wheel.slots[level][slot] = append(wheel.slots[level][slot], entry)
+			return
+		}
+	}
+}
+
+// advance moves the wheel up to tick, cascading the higher levels as the lower ones wrap and queueing the due entries.
+func (wheel *timingWheel) advance(tick int64) {
+	for wheel.current < tick {
+		wheel.current++
+		for level := wheelLevels - 1; level > 0; level-- {
+			if wheel.current&(1<<(wheelBits*level)-1) != 0 {
+				continue
+			}
+			slot := (wheel.current >> (wheelBits * level)) & wheelMask
+			entries := wheel.slots[level][slot]
+			wheel.slots[level][slot] = nil
+			for _, entry := range entries {
+				wheel.count--
+				if !entry.target.released() {
+					wheel.add(entry)
+				}
+			}
+		}
+		slot := wheel.current & wheelMask
+		wheel.due = append(wheel.due, wheel.slots[0][slot]...)
+		wheel.slots[0][slot] = nil
+	}
+}
+
+// tick advances the wheel to now and returns at most maxPerTick due entries, stopping the ticker once the wheel is empty.
+func (wheel *timingWheel) tick(now int64) ([]wheelEntry, bool) {
+	wheel.mu.Lock()
+	defer wheel.mu.Unlock()
+	wheel.advance(now / wheel.resolution)
+	batch := wheel.due
+	if len(batch) > wheel.maxPerTick {
+		batch = batch[:wheel.maxPerTick:wheel.maxPerTick]
+		wheel.due = wheel.due[wheel.maxPerTick:]
+	} else {
+		wheel.due = nil
+	}
+	wheel.count -= len(batch)
+	if wheel.count == 0 {
+		wheel.running = false
+		return batch, false
+	}
+	return batch, true
+}
+
+func (wheel *timingWheel) run(resolution time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			batch, running := wheel.tick(now.UnixNano())
+			// items are deleted without holding the lock, so maps setting items meanwhile do not wait for them
+			for _, entry := range batch {
+				if !entry.target.released() {
+					entry.target.expireKey(entry.key, entry.expiration)
+				}
+			}
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+// reconfigure changes the resolution and the bound per tick, placing every scheduled entry again on the new wheel.
+func (wheel *timingWheel) reconfigure(options CleanerOptions) {
+	wheel.mu.Lock()
+	defer wheel.mu.Unlock()
+	entries := wheel.due
+	for level := range wheel.slots {
+		for slot := range wheel.slots[level] {
+			entries = append(entries, wheel.slots[level][slot]...)
+			wheel.slots[level][slot] = nil
+		}
+	}
+	wheel.due = nil
+	wheel.count = 0
+	wheel.configure(options)
+	for _, entry := range entries {
+		if !entry.target.released() {
+			wheel.add(entry)
+		}
+	}
+	if wheel.running {
+		close(wheel.stop)
+		wheel.running = false
+	}
+	if wheel.count > 0 {
+		wheel.running = true
+		wheel.stop = make(chan struct{})
+		go wheel.run(time.Duration(wheel.resolution), wheel.stop)
+	}
+}
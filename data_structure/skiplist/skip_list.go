@@ -0,0 +1,170 @@
+package data_structure_skiplist
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	maxLevel = 32
+	// a node reaches the next level with a probability of 1/4
+	levelProbability = 4
+)
+
+type node[K any] struct {
+	key  K
+	next []*node[K]
+	// previous links the lowest level backwards so the list can be walked in descending order
+	previous *node[K]
+}
+
+// SkipList keeps unique keys in the order of compare, it is safe for concurrent use.
+type SkipList[K any] struct {
+	mutex   sync.RWMutex
+	compare func(a, b K) int
+	head    *node[K]
+	tail    *node[K]
+	level   int
+	length  int
+}
+
+func NewSkipList[K any](compare func(a, b K) int) *SkipList[K] {
+	return &SkipList[K]{
+		compare: compare,
+		head:    &node[K]{next: make([]*node[K], maxLevel)},
+		level:   1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < maxLevel && rand.IntN(levelProbability) == 0 {
+		level++
+	}
+	return level
+}
+
+// findPredecessors returns, for every level, the last node whose key is lower than key.
+func (list *SkipList[K]) findPredecessors(key K) [maxLevel]*node[K] {
+	var predecessors [maxLevel]*node[K]
+	current := list.head
+	for level := list.level - 1; level >= 0; level-- {
+		for current.next[level] != nil && list.compare(current.next[level].key, key) < 0 {
+			current = current.next[level]
+		}
+		predecessors[level] = current
+	}
+	return predecessors
+}
+
+// Insert adds key to the list, a key equal to an existing one replaces it.
+func (list *SkipList[K]) Insert(key K) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	predecessors := list.findPredecessors(key)
+	if next := predecessors[0].next[0]; next != nil && list.compare(next.key, key) == 0 {
+		next.key = key
+		return
+	}
+	level := randomLevel()
+	for ; list.level < level; list.level++ {
+		predecessors[list.level] = list.head
+	}
+	inserted := &node[K]{key: key, next: make([]*node[K], level)}
+	for i := 0; i < level; i++ {
+		inserted.next[i] = predecessors[i].next[i]
+		predecessors[i].next[i] = inserted
+	}
+	if predecessors[0] != list.head {
+		inserted.previous = predecessors[0]
+	}
+	if inserted.next[0] != nil {
+		inserted.next[0].previous = inserted
+	} else {
+		list.tail = inserted
+	}
+	list.length++
+}
+
+// Delete removes key from the list and tells whether it was there.
+func (list *SkipList[K]) Delete(key K) bool {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	predecessors := list.findPredecessors(key)
+	deleted := predecessors[0].next[0]
+	if deleted == nil || list.compare(deleted.key, key) != 0 {
+		return false
+	}
+	for i := range deleted.next {
+		predecessors[i].next[i] = deleted.next[i]
+	}
+	if deleted.next[0] != nil {
+		deleted.next[0].previous = deleted.previous
+	} else {
+		list.tail = deleted.previous
+	}
+	for list.level > 1 && list.head.next[list.level-1] == nil {
+		list.level--
+	}
+	list.length--
+	return true
+}
+
+func (list *SkipList[K]) Len() int {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+	return list.length
+}
+
+// Ascend walks the keys in ascending order starting at the first key not lower than from, or at the lowest key when from is nil,
+// until consumer returns false. The list must not be changed from consumer.
+func (list *SkipList[K]) Ascend(from *K, consumer func(key K) bool) {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+
+	current := list.head.next[0]
+	if from != nil {
+		current = list.findPredecessors(*from)[0].next[0]
+	}
+	for ; current != nil; current = current.next[0] {
+		if !consumer(current.key) {
+			return
+		}
+	}
+}
+
+// Descend walks the keys in descending order starting at the last key not greater than from, or at the greatest key when from is nil,
+// until consumer returns false. The list must not be changed from consumer.
+func (list *SkipList[K]) Descend(from *K, consumer func(key K) bool) {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+
+	current := list.tail
+	if from != nil {
+		predecessor := list.findPredecessors(*from)[0]
+		if next := predecessor.next[0]; next != nil && list.compare(next.key, *from) == 0 {
+			current = next
+		} else if predecessor != list.head {
+			current = predecessor
+		} else {
+			current = nil
+		}
+	}
+	for ; current != nil; current = current.previous {
+		if !consumer(current.key) {
+			return
+		}
+	}
+}
+
+// Clear drops every key of the list.
+func (list *SkipList[K]) Clear() {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+	list.head = &node[K]{next: make([]*node[K], maxLevel)}
+	list.tail = nil
+	list.level = 1
+	list.length = 0
+}
@@ -2,24 +2,64 @@ package data_structure_slice
 
 import (
 	map_data_structure "a-eighty/data_structure/map"
+	"sync/atomic"
 	"time"
 )
 
+// TTLSlice keeps elements under the index they were appended at. Indexes start at 1 and are never reused,
+// neither after a delete nor after an element expires, so an index kept elsewhere never points at another element.
 type TTLSlice[T any] struct {
-	innerMap map_data_structure.TTLMap[int, T]
+	innerMap *map_data_structure.TTLMap[int, T]
+	// lastIndex is the index handed out by the last append
+	lastIndex atomic.Int64
 }
 
 func NewTTLSlice[T any]() *TTLSlice[T] {
 	return &TTLSlice[T]{
-		innerMap: *map_data_structure.NewTTLMap[int, T](),
+		innerMap: map_data_structure.NewTTLMap[int, T](),
 	}
 }
 
-func (mainSlice *TTLSlice[T]) Append(value T, ttl time.Duration) {
-	mapLength := mainSlice.innerMap.Len()
-	mainSlice.innerMap.Set(mapLength+1, &value, ttl)
+// Append adds value under a new index and returns the index, it is safe for concurrent use.
+func (mainSlice *TTLSlice[T]) Append(value T, ttl time.Duration) int {
+	index := int(mainSlice.lastIndex.Add(1))
+	mainSlice.innerMap.Set(index, &value, ttl)
+	return index
 }
 
+// AppendWithExpiration appends value with an absolute expiration in unix nanoseconds and returns its index.
+func (mainSlice *TTLSlice[T]) AppendWithExpiration(value T, expiration int64) int {
+	index := int(mainSlice.lastIndex.Add(1))
+	mainSlice.innerMap.SetWithExpiration(index, &value, expiration)
+	return index
+}
+
+// Update replaces the element at index and keeps its expiration.
+func (mainSlice *TTLSlice[T]) Update(index int, value T) bool {
+	return mainSlice.innerMap.Update(index, &value)
+}
+
+// Expiration returns the absolute expiration of the element at index.
+func (mainSlice *TTLSlice[T]) Expiration(index int) (int64, bool) {
+	return mainSlice.innerMap.Expiration(index)
+}
+
+// SetExpiration changes the absolute expiration of the element at index, -1 means it never expires.
+func (mainSlice *TTLSlice[T]) SetExpiration(index int, expiration int64) bool {
+	return mainSlice.innerMap.SetExpiration(index, expiration)
+}
+
+// OnExpire sets the function called with every element that expires together with its index, see TTLMap.OnExpire.
+func (mainSlice *TTLSlice[T]) OnExpire(callback func(index int, value *T)) {
+	mainSlice.innerMap.OnExpire(callback)
+}
+
+// Items walks the live elements together with the index they are stored under.
+func (mainSlice *TTLSlice[T]) Items(consumer func(index int, value *T) bool) {
+	mainSlice.innerMap.Items(consumer)
+}
+
+// Delete removes the element at index, the other elements keep their indexes.
 func (mainSlice *TTLSlice[T]) Delete(index int) {
 	mainSlice.innerMap.Delete(index)
 }
@@ -41,22 +81,27 @@ func (mainSlice *TTLSlice[T]) Range(consumer func(index int, value T) bool, offs
 	mainSlice.innerMap.Range(consumer, offset, limit)
 }
 
+// Len counts the live elements, indexes run past it once elements were deleted or expired.
 func (mainSlice *TTLSlice[T]) Len() int {
 	return mainSlice.innerMap.Len()
 }
 
+// Clear drops every element of the slice, later appends still get new indexes.
+func (mainSlice *TTLSlice[T]) Clear() {
+	mainSlice.innerMap.Clear()
+}
+
+// Release drops every element and the ones the cleaner still has scheduled for the slice.
+func (mainSlice *TTLSlice[T]) Release() {
+	mainSlice.innerMap.Release()
+}
+
 func (mainSlice *TTLSlice[T]) DeleteAll(predicate func(value T) bool) {
-	if predicate == nil {
-		mainSlice.innerMap.Range(func(index int, value T) bool {
+	// Range numbers the elements it walks instead of passing their indexes, Items passes the index an element is stored under
+	mainSlice.innerMap.Items(func(index int, value *T) bool {
+		if predicate == nil || predicate(*value) {
 			mainSlice.Delete(index)
-			return true
-		}, nil, nil)
-	} else {
-		mainSlice.innerMap.Range(func(index int, value T) bool {
-			if predicate(value) {
-				mainSlice.Delete(index)
-			}
-			return true
-		}, nil, nil)
-	}
+		}
+		return true
+	})
 }
@@ -66,7 +66,7 @@ func parallelQuickSort[T any](data []T, less func(a, b T) bool) {
 	const threshold = math.MaxInt
 
 	if len(data) < threshold {
-		sort.Slice(data, func(i, j int) bool { return less(data[i], data[j]) })
+		sort.SliceStable(data, func(i, j int) bool { return less(data[i], data[j]) })
 		return
 	}
 
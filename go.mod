@@ -2,27 +2,16 @@ module a-eighty
 
 go 1.25.0
 
-require (
-	github.com/bytedance/sonic v1.14.1
-	github.com/google/uuid v1.6.0
-)
+require github.com/google/uuid v1.6.0
 
 require vitess.io/vitess v0.22.1
 
 require github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc
 
-require github.com/cespare/xxhash/v2 v2.3.0
-
 require (
-	github.com/bytedance/gopkg v0.1.3 // indirect
-	github.com/bytedance/sonic/loader v0.3.0 // indirect
-	github.com/cloudwego/base64x v0.1.6 // indirect
 	github.com/golang/glog v1.2.5 // indirect
-	github.com/klauspost/cpuid/v2 v2.3.0 // indirect
 	github.com/planetscale/vtprotobuf v0.6.1-0.20241121165744-79df5c4772f2 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
-	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
-	golang.org/x/arch v0.21.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250908214217-97024824d090 // indirect
 	google.golang.org/grpc v1.75.0 // indirect
@@ -0,0 +1,565 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// aggregateKeyPrefix starts the key an aggregate value is stored under in a group row, no column name starts with NUL.
+const aggregateKeyPrefix = "\x00"
+
+func aggregateKey(aggregate sqlparser.AggrFunc) string {
+	return aggregateKeyPrefix + sqlparser.String(aggregate)
+}
+
+// accumulator folds the rows of one group into the value of an aggregate function.
+type accumulator interface {
+	add(row map[string]any) error
+	result() any
+}
+
+// batchAccumulator is an accumulator that also folds the selected rows of a batch at once.
+type batchAccumulator interface {
+	accumulator
+	addBatch(batch *map_table.Batch, selection []int) error
+}
+
+// aggregateDefinition creates a fresh accumulator for every group.
+// batched is set when the accumulators can be fed batches, which takes an argument that is a plain column and no DISTINCT.
+type aggregateDefinition struct {
+	key            string
+	newAccumulator func() accumulator
+	batched        bool
+}
+
+// isAggregateSelect tells whether the select has to be grouped, any aggregate function in the select list, HAVING or ORDER BY groups all rows.
+func isAggregateSelect(selectStmt *sqlparser.Select) bool {
+	if selectStmt.GroupBy != nil && len(selectStmt.GroupBy.Exprs) > 0 {
+		return true
+	}
+	if selectStmt.Having != nil {
+		return true
+	}
+	for _, selectExpr := range selectStmt.SelectExprs.Exprs {
+		if aliased, ok := selectExpr.(*sqlparser.AliasedExpr); ok && sqlparser.ContainsAggregation(aliased.Expr) {
+			return true
+		}
+	}
+	for _, order := range selectStmt.OrderBy {
+		if sqlparser.ContainsAggregation(order.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectAggregate groups the rows matching the WHERE clause and evaluates the select list once per group.
+// group computes the group rows from the GROUP BY keys and the aggregates, see groupRows.
+func selectAggregate(scope *expressionScope, selectStmt *sqlparser.Select, group func(groupKeys []valueEvaluator, aggregates []aggregateDefinition) ([]map[string]any, error)) (*QueryResult, error) {
+	groupScope := *scope
+	groupScope.aggregates = true
+	selectProjection, err := buildProjection(&groupScope, selectStmt.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	groupKeys, err := buildGroupKeys(scope, selectStmt)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregateExprs []sqlparser.Expr
+	for _, selectExpr := range selectStmt.SelectExprs.Exprs {
+		if aliased, ok := selectExpr.(*sqlparser.AliasedExpr); ok {
+			aggregateExprs = append(aggregateExprs, aliased.Expr)
+		}
+	}
+	if selectStmt.Having != nil {
+		aggregateExprs = append(aggregateExprs, selectStmt.Having.Expr)
+	}
+	for _, order := range selectStmt.OrderBy {
+		aggregateExprs = append(aggregateExprs, order.Expr)
+	}
+	aggregates, err := collectAggregates(scope, aggregateExprs)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := group(groupKeys, aggregates)
+	if err != nil {
+		return nil, err
+	}
+	return finishSelect(&groupScope, selectStmt, selectProjection, groups)
+}
+
+// buildGroupKeys resolves the GROUP BY list, an entry is a table column, a select list alias or the position of a select expression.
+func buildGroupKeys(scope *expressionScope, selectStmt *sqlparser.Select) ([]valueEvaluator, error) {
+	if selectStmt.GroupBy == nil {
+		return nil, nil
+	}
+	aliasExprs := selectAliases(selectStmt)
+	keys := make([]valueEvaluator, 0, len(selectStmt.GroupBy.Exprs))
+	for _, expr := range selectStmt.GroupBy.Exprs {
+		groupExpr, err := resolveSelectReference(scope, selectStmt, aliasExprs, expr, "group statement")
+		if err != nil {
+			return nil, err
+		}
+		if sqlparser.ContainsAggregation(groupExpr) {
+			return nil, fmt.Errorf("can't group on '%s'", sqlparser.String(expr))
+		}
+		evaluator, err := buildValueEvaluator(scope, groupExpr)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, evaluator)
+	}
+	return keys, nil
+}
+
+// selectAliases maps the aliases of the select list to their expressions.
+func selectAliases(selectStmt *sqlparser.Select) map[string]sqlparser.Expr {
+	aliasExprs := make(map[string]sqlparser.Expr)
+	for _, selectExpr := range selectStmt.SelectExprs.Exprs {
+		if aliased, ok := selectExpr.(*sqlparser.AliasedExpr); ok && !aliased.As.IsEmpty() {
+			aliasExprs[aliased.As.String()] = aliased.Expr
+		}
+	}
+	return aliasExprs
+}
+
+// resolveSelectReference replaces a position or an alias of the select list by its expression, table columns win over aliases like in MySQL.
+func resolveSelectReference(scope *expressionScope, selectStmt *sqlparser.Select, aliasExprs map[string]sqlparser.Expr, expr sqlparser.Expr, clause string) (sqlparser.Expr, error) {
+	switch expression := expr.(type) {
+	case *sqlparser.Literal:
+		if expression.Type != sqlparser.IntVal {
+			return expr, nil
+		}
+		position, err := strconv.Atoi(expression.Val)
+		selectExprs := selectStmt.SelectExprs.Exprs
+		if err != nil || position < 1 || position > len(selectExprs) {
+			return nil, fmt.Errorf("unknown column '%s' in '%s'", expression.Val, clause)
+		}
+		aliased, ok := selectExprs[position-1].(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, fmt.Errorf("cannot refer to '%s' by position", sqlparser.String(selectExprs[position-1]))
+		}
+		return aliased.Expr, nil
+	case *sqlparser.ColName:
+		aliasExpr, ok := aliasExprs[expression.Name.String()]
+		if !ok || !expression.Qualifier.IsEmpty() {
+			return expr, nil
+		}
+		if _, definition, err := scope.lookupColumn(expression); err == nil && definition != nil {
+			return expr, nil
+		}
+		return aliasExpr, nil
+	}
+	return expr, nil
+}
+
+// collectAggregates finds every aggregate function of the expressions, the same call written twice is computed once.
+func collectAggregates(scope *expressionScope, exprs []sqlparser.Expr) ([]aggregateDefinition, error) {
+	var aggregates []aggregateDefinition
+	seen := make(map[string]bool)
+	var buildErr error
+	for _, expr := range exprs {
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			aggregate, ok := node.(sqlparser.AggrFunc)
+			if !ok || buildErr != nil {
+				return buildErr == nil, nil
+			}
+			key := aggregateKey(aggregate)
+			if seen[key] {
+				return false, nil
+			}
+			seen[key] = true
+			newAccumulator, batched, err := buildAccumulator(scope, aggregate)
+			if err != nil {
+				buildErr = err
+				return false, nil
+			}
+			aggregates = append(aggregates, aggregateDefinition{key: key, newAccumulator: newAccumulator, batched: batched})
+			// arguments are evaluated on the rows of the group, an aggregate inside an aggregate fails to build there
+			return false, nil
+		}, expr)
+	}
+	return aggregates, buildErr
+}
+
+// buildAccumulator returns the constructor of the accumulators of an aggregate, batched tells whether they are batchAccumulators.
+func buildAccumulator(scope *expressionScope, aggregate sqlparser.AggrFunc) (newAccumulator func() accumulator, batched bool, err error) {
+	if _, ok := aggregate.(*sqlparser.CountStar); ok {
+		return func() accumulator { return &countAccumulator{} }, true, nil
+	}
+
+	arguments := make([]valueEvaluator, 0, len(aggregate.GetArgs()))
+	for _, argument := range aggregate.GetArgs() {
+		evaluator, err := buildValueEvaluator(scope, argument)
+		if err != nil {
+			return nil, false, err
+		}
+		arguments = append(arguments, evaluator)
+	}
+	distinct := false
+	if distinctAggregate, ok := aggregate.(sqlparser.DistinctableAggr); ok {
+		distinct = distinctAggregate.IsDistinct()
+	}
+	var column string
+	if len(arguments) == 1 && !distinct {
+		column, batched = batchColumn(scope, aggregate.GetArgs()[0])
+	}
+
+	switch aggregate.(type) {
+	case *sqlparser.Count:
+		return func() accumulator {
+			return &countAccumulator{arguments: arguments, distinct: newDistinctSet(distinct), column: column}
+		}, batched, nil
+	case *sqlparser.Sum:
+		return func() accumulator {
+			return &sumAccumulator{argument: arguments[0], distinct: newDistinctSet(distinct), column: column}
+		}, batched, nil
+	case *sqlparser.Avg:
+		return func() accumulator {
+			return &sumAccumulator{argument: arguments[0], distinct: newDistinctSet(distinct), average: true, column: column}
+		}, batched, nil
+	case *sqlparser.Min:
+		return func() accumulator {
+			return &extremeAccumulator{argument: arguments[0], wanted: -1, column: column}
+		}, batched, nil
+	case *sqlparser.Max:
+		return func() accumulator {
+			return &extremeAccumulator{argument: arguments[0], wanted: 1, column: column}
+		}, batched, nil
+	}
+	return nil, false, fmt.Errorf("unsupported aggregate function: %s", aggregate.AggrName())
+}
+
+// groupRows splits the rows by their group key, groups keep the order in which their first row was seen.
+// Without GROUP BY all rows form one group, even when there are none, so COUNT(*) of an empty table is 0.
+func groupRows(rows []map[string]any, groupKeys []valueEvaluator, aggregates []aggregateDefinition) ([]map[string]any, error) {
+	type group struct {
+		row          map[string]any
+		accumulators []accumulator
+	}
+	newGroup := func(row map[string]any) *group {
+		created := &group{row: make(map[string]any, len(row)+len(aggregates))}
+		for key, value := range row {
+			created.row[key] = value
+		}
+		for _, aggregate := range aggregates {
+			created.accumulators = append(created.accumulators, aggregate.newAccumulator())
+		}
+		return created
+	}
+
+	var groups []*group
+	groupIndex := make(map[string]*group)
+	if len(groupKeys) == 0 {
+		groups = append(groups, newGroup(nil))
+	}
+	var keyBuilder strings.Builder
+	for _, row := range rows {
+		var current *group
+		if len(groupKeys) == 0 {
+			current = groups[0]
+			if len(current.row) == 0 {
+				// the columns outside of aggregates show the values of the first row like MySQL without ONLY_FULL_GROUP_BY
+				for key, value := range row {
+					current.row[key] = value
+				}
+			}
+		} else {
+			keyBuilder.Reset()
+			for _, groupKey := range groupKeys {
+				value, err := groupKey(row)
+				if err != nil {
+					return nil, err
+				}
+				writeValueKey(&keyBuilder, value)
+			}
+			var ok bool
+			if current, ok = groupIndex[keyBuilder.String()]; !ok {
+				current = newGroup(row)
+				groupIndex[keyBuilder.String()] = current
+				groups = append(groups, current)
+			}
+		}
+		for _, accumulator := range current.accumulators {
+			if err := accumulator.add(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]map[string]any, len(groups))
+	for i, group := range groups {
+		for j, aggregate := range aggregates {
+			group.row[aggregate.key] = group.accumulators[j].result()
+		}
+		result[i] = group.row
+	}
+	return result, nil
+}
+
+// writeValueKey appends a value to a composite key, the type is part of the key so 1 and '1' stay apart.
+func writeValueKey(builder *strings.Builder, value any) {
+	key := utils.ValueKey(value)
+	fmt.Fprintf(builder, "%T:%v\x00", key, key)
+}
+
+// distinctSet remembers the values an aggregate has already seen, it is nil when the aggregate is not DISTINCT.
+type distinctSet map[string]bool
+
+func newDistinctSet(distinct bool) distinctSet {
+	if !distinct {
+		return nil
+	}
+	return make(distinctSet)
+}
+
+// firstSeen tells whether the values are new, it always does for a nil set.
+func (set distinctSet) firstSeen(values ...any) bool {
+	if set == nil {
+		return true
+	}
+	var builder strings.Builder
+	for _, value := range values {
+		writeValueKey(&builder, value)
+	}
+	key := builder.String()
+	if set[key] {
+		return false
+	}
+	set[key] = true
+	return true
+}
+
+// countAccumulator counts rows, without arguments it is COUNT(*), otherwise rows where every argument is NULL are skipped.
+// column is the column a batched accumulator counts the values of.
+type countAccumulator struct {
+	arguments []valueEvaluator
+	distinct  distinctSet
+	column    string
+	count     int64
+}
+
+func (accumulator *countAccumulator) add(row map[string]any) error {
+	values := make([]any, len(accumulator.arguments))
+	for i, argument := range accumulator.arguments {
+		value, err := argument(row)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return nil
+		}
+		values[i] = value
+	}
+	if accumulator.distinct.firstSeen(values...) {
+		accumulator.count++
+	}
+	return nil
+}
+
+func (accumulator *countAccumulator) addBatch(batch *map_table.Batch, selection []int) error {
+	if len(accumulator.arguments) == 0 {
+		accumulator.count += int64(len(selection))
+		return nil
+	}
+	chunk := batch.Column(accumulator.column)
+	if chunk == nil {
+		return nil
+	}
+	for _, position := range selection {
+		if chunk.Present[position] && !chunk.Null[position] {
+			accumulator.count++
+		}
+	}
+	return nil
+}
+
+func (accumulator *countAccumulator) result() any {
+	return accumulator.count
+}
+
+// sumAccumulator computes SUM and AVG, both are NULL when the group has no value that is not NULL.
+type sumAccumulator struct {
+	argument valueEvaluator
+	distinct distinctSet
+	average  bool
+	column   string
+	sum      any
+	count    int64
+}
+
+func (accumulator *sumAccumulator) add(row map[string]any) error {
+	value, err := accumulator.argument(row)
+	if err != nil || value == nil {
+		return err
+	}
+	return accumulator.addValue(value)
+}
+
+// addBatch adds integers and floats in a loop, in the same order and with the same results as arithmetic.
+func (accumulator *sumAccumulator) addBatch(batch *map_table.Batch, selection []int) error {
+	chunk := batch.Column(accumulator.column)
+	if chunk == nil {
+		return nil
+	}
+	switch {
+	case chunk.Kind == map_table.ChunkInt && (accumulator.sum == nil || isInt64(accumulator.sum)):
+		accumulator.sum = sumValues(accumulator, chunk, chunk.Ints, selection)
+	case chunk.Kind == map_table.ChunkFloat && (accumulator.sum == nil || isFloat64(accumulator.sum)):
+		accumulator.sum = sumValues(accumulator, chunk, chunk.Floats, selection)
+	default:
+		for _, position := range selection {
+			if value, _ := chunk.Value(position); value != nil {
+				if err := accumulator.addValue(value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func sumValues[T int64 | float64](accumulator *sumAccumulator, chunk *map_table.Chunk, values []T, selection []int) any {
+	var sum T
+	if accumulator.sum != nil {
+		sum = accumulator.sum.(T)
+	}
+	added := false
+	for _, position := range selection {
+		if chunk.Present[position] && !chunk.Null[position] {
+			sum += values[position]
+			accumulator.count++
+			added = true
+		}
+	}
+	if !added {
+		return accumulator.sum
+	}
+	return sum
+}
+
+func isInt64(value any) bool {
+	_, ok := value.(int64)
+	return ok
+}
+
+func isFloat64(value any) bool {
+	_, ok := value.(float64)
+	return ok
+}
+
+func (accumulator *sumAccumulator) addValue(value any) error {
+	var err error
+	if !accumulator.distinct.firstSeen(value) {
+		return nil
+	}
+	if accumulator.sum == nil {
+		accumulator.sum, err = toNumber(value)
+	} else {
+		accumulator.sum, err = arithmetic(sqlparser.PlusOp, accumulator.sum, value)
+	}
+	accumulator.count++
+	return err
+}
+
+func (accumulator *sumAccumulator) result() any {
+	if !accumulator.average || accumulator.sum == nil {
+		return accumulator.sum
+	}
+	average, _ := arithmetic(sqlparser.DivOp, accumulator.sum, accumulator.count)
+	return average
+}
+
+// extremeAccumulator keeps the smallest value for MIN (wanted -1) and the largest for MAX (wanted 1).
+type extremeAccumulator struct {
+	argument valueEvaluator
+	wanted   int
+	column   string
+	value    any
+}
+
+func (accumulator *extremeAccumulator) add(row map[string]any) error {
+	value, err := accumulator.argument(row)
+	if err != nil || value == nil {
+		return err
+	}
+	return accumulator.addValue(value)
+}
+
+func (accumulator *extremeAccumulator) addBatch(batch *map_table.Batch, selection []int) error {
+	chunk := batch.Column(accumulator.column)
+	if chunk == nil {
+		return nil
+	}
+	switch {
+	case chunk.Kind == map_table.ChunkInt && (accumulator.value == nil || isInt64(accumulator.value)):
+		accumulator.value = extremeValue(accumulator, chunk, chunk.Ints, selection)
+	case chunk.Kind == map_table.ChunkFloat && (accumulator.value == nil || isFloat64(accumulator.value)):
+		accumulator.value = extremeValue(accumulator, chunk, chunk.Floats, selection)
+	case chunk.Kind == map_table.ChunkString && (accumulator.value == nil || isString(accumulator.value)):
+		accumulator.value = extremeValue(accumulator, chunk, chunk.Strings, selection)
+	default:
+		for _, position := range selection {
+			if value, _ := chunk.Value(position); value != nil {
+				if err := accumulator.addValue(value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// extremeValue compares values of one type with cmp.Compare, which utils.CompareValues does for them too.
+func extremeValue[T int64 | float64 | string](accumulator *extremeAccumulator, chunk *map_table.Chunk, values []T, selection []int) any {
+	var extreme T
+	found := accumulator.value != nil
+	if found {
+		extreme = accumulator.value.(T)
+	}
+	for _, position := range selection {
+		if !chunk.Present[position] || chunk.Null[position] {
+			continue
+		}
+		if !found || cmp.Compare(values[position], extreme) == accumulator.wanted {
+			extreme, found = values[position], true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return extreme
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func (accumulator *extremeAccumulator) addValue(value any) error {
+	if accumulator.value == nil {
+		accumulator.value = value
+		return nil
+	}
+	result, err := utils.CompareValues(value, accumulator.value)
+	if err != nil {
+		return err
+	}
+	if result == accumulator.wanted {
+		accumulator.value = value
+	}
+	return nil
+}
+
+func (accumulator *extremeAccumulator) result() any {
+	return accumulator.value
+}
@@ -0,0 +1,256 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// HandleAlterTable adds and drops indexes and changes the settings of a table, CREATE INDEX and DROP INDEX parse as ALTER TABLE.
+func HandleAlterTable(databaseName string, alterTableStm *sqlparser.AlterTable) error {
+	if !alterTableStm.FullyParsed {
+		return errors.New("unsupported ALTER TABLE syntax")
+	}
+	tableName := alterTableStm.Table
+	table, err := map_table.GetTable(tableDatabaseName(databaseName, tableName), tableName.Name.String())
+	if err != nil {
+		return err
+	}
+	for _, alterOption := range alterTableStm.AlterOptions {
+		switch option := alterOption.(type) {
+		case *sqlparser.AddIndexDefinition:
+			definition, err := buildIndexDefinition(option.IndexDefinition, table.Indexes())
+			if err != nil {
+				return err
+			}
+			if err := table.CreateIndex(definition); err != nil {
+				return fmt.Errorf("%s: %w", definition.Name, err)
+			}
+		case *sqlparser.DropKey:
+			name := option.Name.String()
+			switch option.Type {
+			case sqlparser.NormalKeyType:
+			case sqlparser.PrimaryKeyType:
+				name = map_table.PrimaryKeyName
+			default:
+				return fmt.Errorf("unsupported ALTER TABLE option: %s", sqlparser.String(option))
+			}
+			if err := table.DropIndex(name); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		case sqlparser.TableOptions:
+			options := table.Options()
+			if err := applyTableOptions(&options, option); err != nil {
+				return err
+			}
+			table.SetOptions(options)
+		default:
+			return fmt.Errorf("unsupported ALTER TABLE option: %s", sqlparser.String(alterOption))
+		}
+	}
+	return nil
+}
+
+// buildIndexDefinition converts an index of CREATE INDEX, ALTER TABLE or CREATE TABLE. An index without a name is named
+// after its first column like in MySQL, existing are the indexes the table already has. Plain indexes default to BTREE,
+// PRIMARY KEY and UNIQUE ones to HASH so a key is found in constant time.
+func buildIndexDefinition(indexDefinition *sqlparser.IndexDefinition, existing []map_table.IndexDefinition) (map_table.IndexDefinition, error) {
+	definition := map_table.IndexDefinition{
+		Name: indexDefinition.Info.Name.String(),
+		Kind: map_table.IndexKindBTree,
+	}
+	switch indexDefinition.Info.Type {
+	case sqlparser.IndexTypeDefault:
+	case sqlparser.IndexTypePrimary:
+		definition.Name = map_table.PrimaryKeyName
+		definition.Kind = map_table.IndexKindHash
+		definition.Primary = true
+		definition.Unique = true
+	case sqlparser.IndexTypeUnique:
+		definition.Kind = map_table.IndexKindHash
+		definition.Unique = true
+	default:
+		return map_table.IndexDefinition{}, fmt.Errorf("unsupported index: %s", sqlparser.String(indexDefinition))
+	}
+	for _, column := range indexDefinition.Columns {
+		if column.Expression != nil {
+			return map_table.IndexDefinition{}, errors.New("indexes on expressions are not currently supported")
+		}
+		definition.Columns = append(definition.Columns, column.Column.String())
+	}
+	for _, option := range indexDefinition.Options {
+		if !strings.EqualFold(option.Name, "using") {
+			continue
+		}
+		switch strings.ToLower(option.String) {
+		case "hash":
+			definition.Kind = map_table.IndexKindHash
+		case "btree":
+			definition.Kind = map_table.IndexKindBTree
+		default:
+			return map_table.IndexDefinition{}, fmt.Errorf("unknown index type '%s'", option.String)
+		}
+	}
+
+	if definition.Name == "" && len(definition.Columns) > 0 {
+		taken := func(name string) bool {
+			for _, index := range existing {
+				if strings.EqualFold(index.Name, name) {
+					return true
+				}
+			}
+			return false
+		}
+		definition.Name = definition.Columns[0]
+		for suffix := 2; taken(definition.Name); suffix++ {
+			definition.Name = definition.Columns[0] + "_" + strconv.Itoa(suffix)
+		}
+	}
+	return definition, nil
+}
+
+// applyTableOptions reads the settings of a table from its COMMENT and MAX_ROWS, other table options are ignored.
+func applyTableOptions(options *map_table.TableOptions, tableOptions sqlparser.TableOptions) error {
+	for _, tableOption := range tableOptions {
+		if tableOption.Value == nil {
+			continue
+		}
+		switch strings.ToLower(tableOption.Name) {
+		case "comment":
+			if err := applyTableComment(options, tableOption.Value.Val); err != nil {
+				return err
+			}
+		case "max_rows":
+			maxRows, err := parseRowLimit(tableOption.Value.Val)
+			if err != nil {
+				return fmt.Errorf("invalid MAX_ROWS: %w", err)
+			}
+			options.MaxRows = maxRows
+		}
+	}
+	return nil
+}
+
+// applyTableComment reads settings written as key=value in a table comment like 'auto_index=off, ttl=PT30M, max_rows=1000, eviction=lfu',
+// words without '=' are left as plain comment.
+func applyTableComment(options *map_table.TableOptions, comment string) error {
+	fields := strings.FieldsFunc(comment, func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	})
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "auto_index":
+			enabled, ok := parseSwitch(value)
+			if !ok {
+				return fmt.Errorf("invalid value '%s' for table setting '%s'", value, key)
+			}
+			options.DisableAutoIndex = !enabled
+		case "sliding_ttl":
+			enabled, ok := parseSwitch(value)
+			if !ok {
+				return fmt.Errorf("invalid value '%s' for table setting '%s'", value, key)
+			}
+			options.SlidingTTL = enabled
+		case "ttl":
+			ttl, err := parseDefaultTTL(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' for table setting '%s': %w", value, key, err)
+			}
+			options.DefaultTTL = ttl
+		case "max_rows":
+			maxRows, err := parseRowLimit(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' for table setting '%s': %w", value, key, err)
+			}
+			options.MaxRows = maxRows
+		case "max_memory":
+			maxMemory, err := parseByteSize(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' for table setting '%s': %w", value, key, err)
+			}
+			options.MaxMemory = maxMemory
+		case "eviction":
+			policy, ok := map_table.ParseEvictionPolicy(value)
+			if !ok {
+				return fmt.Errorf("invalid value '%s' for table setting '%s'", value, key)
+			}
+			options.Eviction = policy
+		default:
+			return fmt.Errorf("unknown table setting '%s'", key)
+		}
+	}
+	return nil
+}
+
+// parseDefaultTTL reads the default TTL of a table as an ISO 8601 duration like the TTL column, off, none or 0 remove it.
+func parseDefaultTTL(value string) (time.Duration, error) {
+	switch strings.ToLower(value) {
+	case "off", "none", "0":
+		return 0, nil
+	}
+	ttl, err := utils.ParseISO8601Duration(strings.ToUpper(value))
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, errors.New("TTL must be positive")
+	}
+	return ttl, nil
+}
+
+// parseRowLimit reads a row limit, off, none or 0 remove it.
+func parseRowLimit(value string) (int64, error) {
+	switch strings.ToLower(value) {
+	case "off", "none":
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return 0, errors.New("limit must be a number of rows")
+	}
+	return limit, nil
+}
+
+// parseByteSize reads a memory limit in bytes with an optional K, M or G suffix of powers of 1024 like 64M or 1GB,
+// off, none or 0 remove it.
+func parseByteSize(value string) (int64, error) {
+	upper := strings.TrimSuffix(strings.ToUpper(value), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(upper, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(upper, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(upper, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		upper = upper[:len(upper)-1]
+	}
+	if limit, err := parseRowLimit(upper); err == nil && limit <= math.MaxInt64/multiplier {
+		return limit * multiplier, nil
+	}
+	return 0, errors.New("size must be a number of bytes like 512K, 64M or 1G")
+}
+
+func parseSwitch(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1", "yes":
+		return true, true
+	case "off", "false", "0", "no":
+		return false, true
+	}
+	return false, false
+}
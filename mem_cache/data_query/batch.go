@@ -0,0 +1,468 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"cmp"
+	"errors"
+	"slices"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// batchFilter narrows selection, the positions of a batch still in play in ascending order, to the rows matching a condition.
+// It may reuse the array of selection.
+type batchFilter func(batch *map_table.Batch, selection []int) []int
+
+// maxExactFloatInt bounds the integers a float64 represents exactly, utils.CompareValues compares larger ones as decimals.
+const maxExactFloatInt = 1 << 53
+
+// buildBatchFilter compiles a WHERE condition to a batchFilter. Comparisons of a column with a constant, IS [NOT] NULL, IN lists
+// and BETWEEN, joined by AND and OR, are evaluated on the chunks of the batch; other conditions on the rows of the positions
+// left, like the row predicate does.
+func buildBatchFilter(scope *expressionScope, expr sqlparser.Expr) (batchFilter, error) {
+	switch expression := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := buildBatchFilter(scope, expression.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := buildBatchFilter(scope, expression.Right)
+		if err != nil {
+			return nil, err
+		}
+		return func(batch *map_table.Batch, selection []int) []int {
+			return right(batch, left(batch, selection))
+		}, nil
+	case *sqlparser.OrExpr:
+		left, err := buildBatchFilter(scope, expression.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := buildBatchFilter(scope, expression.Right)
+		if err != nil {
+			return nil, err
+		}
+		return func(batch *map_table.Batch, selection []int) []int {
+			leftMatches := left(batch, append([]int(nil), selection...))
+			rest := make([]int, 0, len(selection)-len(leftMatches))
+			i := 0
+			for _, position := range selection {
+				if i < len(leftMatches) && leftMatches[i] == position {
+					i++
+				} else {
+					rest = append(rest, position)
+				}
+			}
+			return mergePositions(selection[:0], leftMatches, right(batch, rest))
+		}, nil
+	case *sqlparser.ComparisonExpr:
+		if filter, ok := buildComparisonFilter(scope, expression); ok {
+			return filter, nil
+		}
+	case *sqlparser.BetweenExpr:
+		if expression.IsBetween {
+			return buildBatchFilter(scope, &sqlparser.AndExpr{
+				Left:  &sqlparser.ComparisonExpr{Operator: sqlparser.GreaterEqualOp, Left: expression.Left, Right: expression.From},
+				Right: &sqlparser.ComparisonExpr{Operator: sqlparser.LessEqualOp, Left: expression.Left, Right: expression.To},
+			})
+		}
+	case *sqlparser.IsExpr:
+		if filter, ok := buildNullFilter(scope, expression); ok {
+			return filter, nil
+		}
+	}
+
+	predicate, err := buildRowPredicate(scope, expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(batch *map_table.Batch, selection []int) []int {
+		kept := selection[:0]
+		for _, position := range selection {
+			if predicate(batch.Row(position)) {
+				kept = append(kept, position)
+			}
+		}
+		return kept
+	}, nil
+}
+
+// mergePositions merges two ascending lists of positions into to.
+func mergePositions(to, a, b []int) []int {
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] < b[0] {
+			to, a = append(to, a[0]), a[1:]
+		} else {
+			to, b = append(to, b[0]), b[1:]
+		}
+	}
+	to = append(to, a...)
+	return append(to, b...)
+}
+
+// batchColumn resolves the column a batch filter reads, false when the filter cannot read it from a batch of the table.
+func batchColumn(scope *expressionScope, expr sqlparser.Expr) (string, bool) {
+	column, ok := expr.(*sqlparser.ColName)
+	if !ok || len(scope.tables) > 0 || scope.inserted {
+		return "", false
+	}
+	key, err := scope.resolveColumn(column)
+	return key, err == nil
+}
+
+// buildComparisonFilter compiles a comparison of a column with a constant, and IN with a list of constants.
+func buildComparisonFilter(scope *expressionScope, expression *sqlparser.ComparisonExpr) (batchFilter, bool) {
+	if expression.Modifier != sqlparser.Missing {
+		return nil, false
+	}
+	if expression.Operator == sqlparser.InOp {
+		return buildInFilter(scope, expression)
+	}
+	// the column is put on the left, 5 < id is id > 5
+	operator := expression.Operator
+	columnExpr, valueExpr := expression.Left, expression.Right
+	if _, ok := columnExpr.(*sqlparser.ColName); !ok {
+		columnExpr, valueExpr = valueExpr, columnExpr
+		switch operator {
+		case sqlparser.LessThanOp:
+			operator = sqlparser.GreaterThanOp
+		case sqlparser.LessEqualOp:
+			operator = sqlparser.GreaterEqualOp
+		case sqlparser.GreaterThanOp:
+			operator = sqlparser.LessThanOp
+		case sqlparser.GreaterEqualOp:
+			operator = sqlparser.LessEqualOp
+		}
+	}
+	var matches func(result int) bool
+	switch operator {
+	case sqlparser.EqualOp:
+		matches = func(result int) bool { return result == 0 }
+	case sqlparser.NotEqualOp:
+		matches = func(result int) bool { return result != 0 }
+	case sqlparser.LessThanOp:
+		matches = func(result int) bool { return result < 0 }
+	case sqlparser.LessEqualOp:
+		matches = func(result int) bool { return result <= 0 }
+	case sqlparser.GreaterThanOp:
+		matches = func(result int) bool { return result > 0 }
+	case sqlparser.GreaterEqualOp:
+		matches = func(result int) bool { return result >= 0 }
+	default:
+		return nil, false
+	}
+	column, ok := batchColumn(scope, columnExpr)
+	if !ok {
+		return nil, false
+	}
+	constant, ok := constantValue(scope, valueExpr)
+	if !ok {
+		return nil, false
+	}
+	// the comparison evaluates both ways round to the same when the column is on the right, see utils.CompareValues
+	flipped := columnExpr != expression.Left
+	compare := func(value any) (int, error) {
+		if flipped {
+			result, err := utils.CompareValues(constant, value)
+			return -result, err
+		}
+		return utils.CompareValues(value, constant)
+	}
+
+	return func(batch *map_table.Batch, selection []int) []int {
+		chunk := batch.Column(column)
+		if chunk == nil || constant == nil {
+			return selection[:0]
+		}
+		kept := selection[:0]
+		switch c := constant.(type) {
+		case int64:
+			switch {
+			case chunk.Kind == map_table.ChunkInt:
+				return keepCompared(kept, selection, chunk, chunk.Ints, c, matches)
+			case chunk.Kind == map_table.ChunkFloat && c > -maxExactFloatInt && c < maxExactFloatInt:
+				return keepCompared(kept, selection, chunk, chunk.Floats, float64(c), matches)
+			}
+		case float64:
+			if chunk.Kind == map_table.ChunkFloat {
+				return keepCompared(kept, selection, chunk, chunk.Floats, c, matches)
+			}
+		case string:
+			if chunk.Codes != nil && (operator == sqlparser.EqualOp || operator == sqlparser.NotEqualOp) {
+				return keepCoded(kept, selection, chunk, codeSet(chunk, c), operator == sqlparser.EqualOp)
+			}
+			if chunk.Kind == map_table.ChunkString {
+				return keepCompared(kept, selection, chunk, chunk.Strings, c, matches)
+			}
+		}
+		for _, position := range selection {
+			value, _ := chunk.Value(position)
+			if value == nil {
+				continue
+			}
+			if result, err := compare(value); err == nil && matches(result) {
+				kept = append(kept, position)
+			}
+		}
+		return kept
+	}, true
+}
+
+// keepCompared appends the positions whose value compares with constant as matches wants to kept.
+func keepCompared[T cmp.Ordered](kept, selection []int, chunk *map_table.Chunk, values []T, constant T, matches func(result int) bool) []int {
+	for _, position := range selection {
+		if chunk.Present[position] && !chunk.Null[position] && matches(cmp.Compare(values[position], constant)) {
+			kept = append(kept, position)
+		}
+	}
+	return kept
+}
+
+// codeSet marks the dictionary codes of a chunk that stand for one of strs.
+func codeSet(chunk *map_table.Chunk, strs ...string) *[256]bool {
+	var codes [256]bool
+	for code, s := range chunk.Dictionary {
+		codes[code] = slices.Contains(strs, s)
+	}
+	return &codes
+}
+
+// keepCoded appends the positions whose code is in codes to kept, or the ones whose code is not for !wanted.
+func keepCoded(kept, selection []int, chunk *map_table.Chunk, codes *[256]bool, wanted bool) []int {
+	for _, position := range selection {
+		if chunk.Present[position] && !chunk.Null[position] && codes[chunk.Codes[position]] == wanted {
+			kept = append(kept, position)
+		}
+	}
+	return kept
+}
+
+// buildInFilter keeps the rows whose column equals an element of a list of constants, NULL elements match nothing.
+func buildInFilter(scope *expressionScope, expression *sqlparser.ComparisonExpr) (batchFilter, bool) {
+	column, ok := batchColumn(scope, expression.Left)
+	if !ok {
+		return nil, false
+	}
+	list, ok := expression.Right.(sqlparser.ValTuple)
+	if !ok {
+		return nil, false
+	}
+	var elements, intList []any
+	var strList []string
+	ints := make(map[int64]bool)
+	strs := make(map[string]bool)
+	for _, element := range list {
+		value, ok := constantValue(scope, element)
+		if !ok {
+			return nil, false
+		}
+		if value == nil {
+			continue
+		}
+		elements = append(elements, value)
+		switch v := value.(type) {
+		case int64:
+			ints[v] = true
+			intList = append(intList, v)
+		case string:
+			strs[v] = true
+			strList = append(strList, v)
+		}
+	}
+	intsOnly, stringsOnly := len(intList) == len(elements), len(strList) == len(elements)
+
+	return func(batch *map_table.Batch, selection []int) []int {
+		chunk := batch.Column(column)
+		kept := selection[:0]
+		if chunk == nil {
+			return kept
+		}
+		if chunk.Codes != nil && stringsOnly {
+			return keepCoded(kept, selection, chunk, codeSet(chunk, strList...), true)
+		}
+		for _, position := range selection {
+			if !chunk.Present[position] || chunk.Null[position] {
+				continue
+			}
+			var found bool
+			switch {
+			case chunk.Kind == map_table.ChunkInt && intsOnly:
+				found = ints[chunk.Ints[position]]
+			case chunk.Kind == map_table.ChunkString && stringsOnly:
+				found = strs[chunk.Strings[position]]
+			default:
+				value, _ := chunk.Value(position)
+				for _, element := range elements {
+					if found = valuesEqual(value, element); found {
+						break
+					}
+				}
+			}
+			if found {
+				kept = append(kept, position)
+			}
+		}
+		return kept
+	}, true
+}
+
+// buildNullFilter compiles IS NULL and IS NOT NULL of a column, a row lacking the column holds NULL in it.
+func buildNullFilter(scope *expressionScope, expression *sqlparser.IsExpr) (batchFilter, bool) {
+	if expression.Right != sqlparser.IsNullOp && expression.Right != sqlparser.IsNotNullOp {
+		return nil, false
+	}
+	column, ok := batchColumn(scope, expression.Left)
+	if !ok {
+		return nil, false
+	}
+	wantNull := expression.Right == sqlparser.IsNullOp
+	return func(batch *map_table.Batch, selection []int) []int {
+		chunk := batch.Column(column)
+		if chunk == nil {
+			if wantNull {
+				return selection
+			}
+			return selection[:0]
+		}
+		kept := selection[:0]
+		for _, position := range selection {
+			if (!chunk.Present[position] || chunk.Null[position]) == wantNull {
+				kept = append(kept, position)
+			}
+		}
+		return kept
+	}, true
+}
+
+// errNeedsAllColumns stops the walk of referencedColumns.
+var errNeedsAllColumns = errors.New("needs all columns")
+
+// referencedColumns lists the columns of the table a SELECT reads, false when it needs all of them like SELECT * does.
+func referencedColumns(scope *expressionScope, selectStmt *sqlparser.Select) ([]string, bool) {
+	aliases := selectAliases(selectStmt)
+	seen := make(map[string]bool)
+	columns := []string{}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch expression := node.(type) {
+		case *sqlparser.StarExpr, *sqlparser.Subquery:
+			return false, errNeedsAllColumns
+		case *sqlparser.ColName:
+			key, err := scope.resolveColumn(expression)
+			if err != nil {
+				if _, ok := aliases[expression.Name.String()]; ok && expression.Qualifier.IsEmpty() {
+					return false, nil
+				}
+				return false, errNeedsAllColumns
+			}
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+		return true, nil
+	}, selectStmt.SelectExprs, selectStmt.Where, selectStmt.GroupBy, selectStmt.Having, selectStmt.OrderBy)
+	return columns, err == nil
+}
+
+// scans tells whether the statement reads the rows through scanBatches.
+func (access *tableAccess) scans() bool {
+	return access.candidates == nil && !access.expirations
+}
+
+// scanBatches hands the matching rows of a full scan to consumer a batch at a time, selection lists their positions.
+// read reports the rows as read by a SELECT, see touch.
+func (access *tableAccess) scanBatches(read bool, consumer func(batch *map_table.Batch, selection []int) bool) {
+	read = read && access.table.TracksAccess()
+	access.table.ScanBatches(access.columns, func(batch *map_table.Batch) bool {
+		selection := batch.Selection()
+		if access.filter != nil {
+			selection = access.filter(batch, selection)
+		}
+		if len(selection) == 0 {
+			return true
+		}
+		if read {
+			access.touch(batchIndexes(batch, selection))
+		}
+		return consumer(batch, selection)
+	})
+}
+
+func batchIndexes(batch *map_table.Batch, selection []int) []int {
+	indexes := make([]int, len(selection))
+	for i, position := range selection {
+		indexes[i] = batch.IDs[position]
+	}
+	return indexes
+}
+
+// scan builds the matching rows of a full scan in the order of their index, it stops after limit rows when limit is set.
+func (access *tableAccess) scan(limit *uint64) []map[string]any {
+	var rows []map[string]any
+	access.scanBatches(true, func(batch *map_table.Batch, selection []int) bool {
+		if limit != nil && uint64(len(selection)) > *limit-uint64(len(rows)) {
+			selection = selection[:*limit-uint64(len(rows))]
+		}
+		for _, position := range selection {
+			rows = append(rows, batch.Row(position))
+		}
+		return limit == nil || uint64(len(rows)) < *limit
+	})
+	return rows
+}
+
+// writeCandidates returns the rows DELETE and UPDATE check their WHERE clause on, for a scan the ones the batch filter keeps.
+func (access *tableAccess) writeCandidates() []int {
+	if !access.scans() || access.filter == nil {
+		return access.candidates
+	}
+	indexes := []int{}
+	access.scanBatches(false, func(batch *map_table.Batch, selection []int) bool {
+		indexes = append(indexes, batchIndexes(batch, selection)...)
+		return true
+	})
+	return indexes
+}
+
+// group groups the matching rows for a SELECT, a full scan without GROUP BY whose aggregates all read columns
+// is aggregated batch by batch without building the rows.
+func (access *tableAccess) group(groupKeys []valueEvaluator, aggregates []aggregateDefinition) ([]map[string]any, error) {
+	if len(groupKeys) > 0 || !access.scans() {
+		return groupRows(access.rows(), groupKeys, aggregates)
+	}
+	for _, aggregate := range aggregates {
+		if !aggregate.batched {
+			return groupRows(access.rows(), groupKeys, aggregates)
+		}
+	}
+
+	accumulators := make([]accumulator, len(aggregates))
+	for i, aggregate := range aggregates {
+		accumulators[i] = aggregate.newAccumulator()
+	}
+	var row map[string]any
+	var err error
+	access.scanBatches(true, func(batch *map_table.Batch, selection []int) bool {
+		if row == nil {
+			// the columns outside of aggregates show the values of the first row, see groupRows
+			row = batch.Row(selection[0])
+		}
+		for _, accumulator := range accumulators {
+			if err = accumulator.(batchAccumulator).addBatch(batch, selection); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		row = make(map[string]any, len(aggregates))
+	}
+	for i, aggregate := range aggregates {
+		row[aggregate.key] = accumulators[i].result()
+	}
+	return []map[string]any{row}, nil
+}
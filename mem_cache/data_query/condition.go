@@ -0,0 +1,344 @@
+package data_query
+
+import (
+	"a-eighty/utils"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// buildComparisonEvaluator evaluates to a bool, or NULL when a side is NULL or the sides cannot be compared.
+func buildComparisonEvaluator(scope *expressionScope, expression *sqlparser.ComparisonExpr) (valueEvaluator, error) {
+	if expression.Modifier != sqlparser.Missing {
+		return nil, fmt.Errorf("unsupported comparison: %s", sqlparser.String(expression))
+	}
+	switch expression.Operator {
+	case sqlparser.InOp, sqlparser.NotInOp:
+		return buildInEvaluator(scope, expression)
+	case sqlparser.LikeOp, sqlparser.NotLikeOp, sqlparser.RegexpOp, sqlparser.NotRegexpOp:
+		return buildPatternEvaluator(scope, expression)
+	}
+
+	var matches func(result int) bool
+	switch expression.Operator {
+	case sqlparser.EqualOp, sqlparser.NullSafeEqualOp:
+		matches = func(result int) bool { return result == 0 }
+	case sqlparser.NotEqualOp:
+		matches = func(result int) bool { return result != 0 }
+	case sqlparser.LessThanOp:
+		matches = func(result int) bool { return result < 0 }
+	case sqlparser.LessEqualOp:
+		matches = func(result int) bool { return result <= 0 }
+	case sqlparser.GreaterThanOp:
+		matches = func(result int) bool { return result > 0 }
+	case sqlparser.GreaterEqualOp:
+		matches = func(result int) bool { return result >= 0 }
+	default:
+		return nil, fmt.Errorf("unsupported comparison operator: %s", expression.Operator.ToString())
+	}
+	left, err := buildValueEvaluator(scope, expression.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := buildValueEvaluator(scope, expression.Right)
+	if err != nil {
+		return nil, err
+	}
+	nullSafe := expression.Operator == sqlparser.NullSafeEqualOp
+
+	return func(row map[string]any) (any, error) {
+		leftValue, err := left(row)
+		if err != nil {
+			return nil, err
+		}
+		rightValue, err := right(row)
+		if err != nil {
+			return nil, err
+		}
+		if leftValue == nil || rightValue == nil {
+			if nullSafe {
+				return leftValue == nil && rightValue == nil, nil
+			}
+			return nil, nil
+		}
+		result, err := utils.CompareValues(leftValue, rightValue)
+		if err != nil {
+			return nil, nil
+		}
+		return matches(result), nil
+	}, nil
+}
+
+// buildLogicalEvaluator implements the three-valued logic of SQL, NULL stands for unknown.
+func buildLogicalEvaluator(scope *expressionScope, expr sqlparser.Expr) (valueEvaluator, error) {
+	if notExpr, ok := expr.(*sqlparser.NotExpr); ok {
+		operand, err := buildValueEvaluator(scope, notExpr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(row map[string]any) (any, error) {
+			value, err := operand(row)
+			if err != nil || value == nil {
+				return nil, err
+			}
+			return !isTrue(value), nil
+		}, nil
+	}
+
+	var leftExpr, rightExpr sqlparser.Expr
+	var combine func(left, right any) any
+	switch expression := expr.(type) {
+	case *sqlparser.AndExpr:
+		leftExpr, rightExpr = expression.Left, expression.Right
+		combine = func(left, right any) any {
+			if (left != nil && !isTrue(left)) || (right != nil && !isTrue(right)) {
+				return false
+			}
+			if left == nil || right == nil {
+				return nil
+			}
+			return true
+		}
+	case *sqlparser.OrExpr:
+		leftExpr, rightExpr = expression.Left, expression.Right
+		combine = func(left, right any) any {
+			if isTrue(left) || isTrue(right) {
+				return true
+			}
+			if left == nil || right == nil {
+				return nil
+			}
+			return false
+		}
+	case *sqlparser.XorExpr:
+		leftExpr, rightExpr = expression.Left, expression.Right
+		combine = func(left, right any) any {
+			if left == nil || right == nil {
+				return nil
+			}
+			return isTrue(left) != isTrue(right)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported logical expression: %s", sqlparser.String(expr))
+	}
+
+	left, err := buildValueEvaluator(scope, leftExpr)
+	if err != nil {
+		return nil, err
+	}
+	right, err := buildValueEvaluator(scope, rightExpr)
+	if err != nil {
+		return nil, err
+	}
+	return func(row map[string]any) (any, error) {
+		leftValue, err := left(row)
+		if err != nil {
+			return nil, err
+		}
+		rightValue, err := right(row)
+		if err != nil {
+			return nil, err
+		}
+		return combine(leftValue, rightValue), nil
+	}, nil
+}
+
+// buildInEvaluator is true when the value equals an element of the list, NULL when it does not but the list holds a NULL.
+func buildInEvaluator(scope *expressionScope, expression *sqlparser.ComparisonExpr) (valueEvaluator, error) {
+	list, ok := expression.Right.(sqlparser.ValTuple)
+	if !ok {
+		return nil, fmt.Errorf("unsupported IN list: %s", sqlparser.String(expression.Right))
+	}
+	left, err := buildValueEvaluator(scope, expression.Left)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]valueEvaluator, len(list))
+	for i, element := range list {
+		if elements[i], err = buildValueEvaluator(scope, element); err != nil {
+			return nil, err
+		}
+	}
+	negate := expression.Operator == sqlparser.NotInOp
+
+	return func(row map[string]any) (any, error) {
+		value, err := left(row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		sawNull := false
+		for _, element := range elements {
+			elementValue, err := element(row)
+			if err != nil {
+				return nil, err
+			}
+			if elementValue == nil {
+				sawNull = true
+				continue
+			}
+			if valuesEqual(value, elementValue) {
+				return !negate, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return negate, nil
+	}, nil
+}
+
+// buildPatternEvaluator matches the text of a value against a LIKE pattern or a regular expression.
+// A constant pattern is compiled once, others are compiled for every row.
+func buildPatternEvaluator(scope *expressionScope, expression *sqlparser.ComparisonExpr) (valueEvaluator, error) {
+	left, err := buildValueEvaluator(scope, expression.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := buildValueEvaluator(scope, expression.Right)
+	if err != nil {
+		return nil, err
+	}
+	isLike := expression.Operator == sqlparser.LikeOp || expression.Operator == sqlparser.NotLikeOp
+	negate := expression.Operator == sqlparser.NotLikeOp || expression.Operator == sqlparser.NotRegexpOp
+
+	escape := '\\'
+	if expression.Escape != nil {
+		if !isLike {
+			return nil, fmt.Errorf("unsupported ESCAPE for %s", expression.Operator.ToString())
+		}
+		escapeValue, err := literalValue(expression.Escape)
+		if err != nil {
+			return nil, err
+		}
+		escapeString, ok := escapeValue.(string)
+		if !ok || utf8.RuneCountInString(escapeString) != 1 {
+			return nil, errors.New("incorrect arguments to ESCAPE")
+		}
+		escape, _ = utf8.DecodeRuneInString(escapeString)
+	}
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		if isLike {
+			return likePattern(pattern, escape)
+		}
+		return regexp.Compile(pattern)
+	}
+
+	var constantPattern *regexp.Regexp
+	if literal, ok := expression.Right.(*sqlparser.Literal); ok && literal.Type == sqlparser.StrVal {
+		if constantPattern, err = compile(literal.Val); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", sqlparser.String(literal), err)
+		}
+	}
+
+	return func(row map[string]any) (any, error) {
+		value, err := left(row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		pattern := constantPattern
+		if pattern == nil {
+			patternValue, err := right(row)
+			if err != nil || patternValue == nil {
+				return nil, err
+			}
+			if pattern, err = compile(utils.FormatValue(patternValue)); err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", utils.FormatValue(patternValue), err)
+			}
+		}
+		return pattern.MatchString(utils.FormatValue(value)) != negate, nil
+	}, nil
+}
+
+// likePattern translates a LIKE pattern to an anchored regular expression, % matches any text and _ one character.
+func likePattern(pattern string, escape rune) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == escape:
+			escaped = true
+		case r == '%':
+			builder.WriteString(".*")
+		case r == '_':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		builder.WriteString(regexp.QuoteMeta(string(escape)))
+	}
+	builder.WriteString("$")
+	return regexp.Compile(builder.String())
+}
+
+// buildBetweenEvaluator is the same as left >= from AND left <= to, with the three-valued result of that condition.
+func buildBetweenEvaluator(scope *expressionScope, expression *sqlparser.BetweenExpr) (valueEvaluator, error) {
+	lower, err := buildComparisonEvaluator(scope, &sqlparser.ComparisonExpr{Operator: sqlparser.GreaterEqualOp, Left: expression.Left, Right: expression.From})
+	if err != nil {
+		return nil, err
+	}
+	upper, err := buildComparisonEvaluator(scope, &sqlparser.ComparisonExpr{Operator: sqlparser.LessEqualOp, Left: expression.Left, Right: expression.To})
+	if err != nil {
+		return nil, err
+	}
+	isBetween := expression.IsBetween
+
+	return func(row map[string]any) (any, error) {
+		lowerValue, err := lower(row)
+		if err != nil {
+			return nil, err
+		}
+		upperValue, err := upper(row)
+		if err != nil {
+			return nil, err
+		}
+		if lowerValue == false || upperValue == false {
+			return !isBetween, nil
+		}
+		if lowerValue == nil || upperValue == nil {
+			return nil, nil
+		}
+		return isBetween, nil
+	}, nil
+}
+
+// buildIsEvaluator handles IS [NOT] NULL, TRUE and FALSE, they never evaluate to NULL.
+func buildIsEvaluator(scope *expressionScope, expression *sqlparser.IsExpr) (valueEvaluator, error) {
+	left, err := buildValueEvaluator(scope, expression.Left)
+	if err != nil {
+		return nil, err
+	}
+	var test func(value any) bool
+	switch expression.Right {
+	case sqlparser.IsNullOp:
+		test = func(value any) bool { return value == nil }
+	case sqlparser.IsNotNullOp:
+		test = func(value any) bool { return value != nil }
+	case sqlparser.IsTrueOp:
+		test = func(value any) bool { return value != nil && isTrue(value) }
+	case sqlparser.IsNotTrueOp:
+		test = func(value any) bool { return value == nil || !isTrue(value) }
+	case sqlparser.IsFalseOp:
+		test = func(value any) bool { return value != nil && !isTrue(value) }
+	case sqlparser.IsNotFalseOp:
+		test = func(value any) bool { return value == nil || isTrue(value) }
+	default:
+		return nil, fmt.Errorf("unsupported expression: %s", sqlparser.String(expression))
+	}
+	return func(row map[string]any) (any, error) {
+		value, err := left(row)
+		if err != nil {
+			return nil, err
+		}
+		return test(value), nil
+	}, nil
+}
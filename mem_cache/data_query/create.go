@@ -3,20 +3,177 @@ package data_query
 import (
 	"a-eighty/mem_cache/map_table"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
+func HandleCreateDatabase(createDatabaseStm *sqlparser.CreateDatabase) error {
+	databaseName := createDatabaseStm.DBName.String()
+	if databaseName == "" {
+		return errors.New("database name is empty")
+	}
+	err := map_table.CreateDatabase(databaseName)
+	if createDatabaseStm.IfNotExists && errors.Is(err, map_table.ErrDatabaseExists) {
+		return nil
+	}
+	return err
+}
+
 func HandleCreateTable(databaseName string, createTableStm *sqlparser.CreateTable) error {
 	tableName := createTableStm.Table
 	if tableName.IsEmpty() {
 		return errors.New("table name is empty")
 	}
-	columns := createTableStm.GetTableSpec().Columns
-	columnsMap := make(map[string]bool)
-	for _, col := range columns {
-		columnsMap[col.Name.String()] = true
+	tableSpec := createTableStm.GetTableSpec()
+	if !createTableStm.FullyParsed || tableSpec == nil {
+		return errors.New("unsupported CREATE TABLE syntax")
+	}
+	indexes, err := buildTableIndexes(tableSpec)
+	if err != nil {
+		return err
+	}
+	var primaryKey []string
+	if len(indexes) > 0 && indexes[0].Primary {
+		primaryKey = indexes[0].Columns
+	}
+	schema, err := buildTableSchema(tableSpec, primaryKey)
+	if err != nil {
+		return err
+	}
+	var options map_table.TableOptions
+	if err := applyTableOptions(&options, tableSpec.Options); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		for _, column := range index.Columns {
+			if _, ok := schema.Column(column); !ok {
+				return fmt.Errorf("key column '%s' doesn't exist in table", column)
+			}
+		}
+	}
+
+	tableDatabase, tableNameString := tableDatabaseName(databaseName, tableName), tableName.Name.String()
+	err = map_table.CreateTableWithOptions(tableDatabase, tableNameString, schema, options)
+	if createTableStm.IfNotExists && errors.Is(err, map_table.ErrTableExists) {
+		return nil
+	}
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+	table, err := map_table.GetTable(tableDatabase, tableNameString)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := table.CreateIndex(index); err != nil {
+			_ = map_table.DropTable(tableDatabase, tableNameString)
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTableIndexes collects the indexes of CREATE TABLE together with the PRIMARY KEY and UNIQUE options of its columns,
+// the primary key comes first.
+func buildTableIndexes(tableSpec *sqlparser.TableSpec) ([]map_table.IndexDefinition, error) {
+	var indexes []map_table.IndexDefinition
+	add := func(definition map_table.IndexDefinition) error {
+		for _, previous := range indexes {
+			if definition.Primary && previous.Primary {
+				return errors.New("multiple primary key defined")
+			}
+			if strings.EqualFold(previous.Name, definition.Name) {
+				return fmt.Errorf("%s: %w", definition.Name, map_table.ErrIndexExists)
+			}
+		}
+		if definition.Primary {
+			indexes = slices.Insert(indexes, 0, definition)
+		} else {
+			indexes = append(indexes, definition)
+		}
+		return nil
+	}
+
+	for _, col := range tableSpec.Columns {
+		if col.Type.Options == nil {
+			continue
+		}
+		var indexType sqlparser.IndexType
+		switch col.Type.Options.KeyOpt {
+		case sqlparser.ColKeyNone:
+			continue
+		case sqlparser.ColKeyPrimary, sqlparser.ColKey:
+			// KEY alone in a column definition is a PRIMARY KEY in MySQL
+			indexType = sqlparser.IndexTypePrimary
+		case sqlparser.ColKeyUnique, sqlparser.ColKeyUniqueKey:
+			indexType = sqlparser.IndexTypeUnique
+		default:
+			return nil, fmt.Errorf("unsupported index on column '%s'", col.Name.String())
+		}
+		definition, err := buildIndexDefinition(&sqlparser.IndexDefinition{
+			Info:    &sqlparser.IndexInfo{Type: indexType},
+			Columns: []*sqlparser.IndexColumn{{Column: col.Name}},
+		}, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(definition); err != nil {
+			return nil, err
+		}
+	}
+	for _, index := range tableSpec.Indexes {
+		definition, err := buildIndexDefinition(index, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(definition); err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+// buildTableSchema converts the column definitions of CREATE TABLE, the columns of primaryKey are NOT NULL like in MySQL.
+func buildTableSchema(tableSpec *sqlparser.TableSpec, primaryKey []string) (*map_table.TableSchema, error) {
+	columns := make([]map_table.ColumnDefinition, 0, len(tableSpec.Columns))
+	for _, col := range tableSpec.Columns {
+		columnType, err := columnTypeFromSQL(col.Type.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", col.Name.String(), err)
+		}
+		inPrimaryKey := slices.ContainsFunc(primaryKey, func(name string) bool {
+			return strings.EqualFold(name, col.Name.String())
+		})
+		column := map_table.ColumnDefinition{
+			Name:     col.Name.String(),
+			Type:     columnType,
+			SQLType:  strings.ToLower(col.Type.Type),
+			Nullable: !inPrimaryKey,
+		}
+		if options := col.Type.Options; options != nil {
+			if options.Null != nil {
+				column.Nullable = *options.Null
+				if column.Nullable && inPrimaryKey {
+					return nil, fmt.Errorf("all parts of a PRIMARY KEY must be NOT NULL, column '%s' is declared NULL", column.Name)
+				}
+			}
+			if options.Default != nil {
+				defaultValue, err := convertColumnValue(&column, options.Default)
+				if err != nil {
+					return nil, fmt.Errorf("invalid default value for column '%s': %w", column.Name, err)
+				}
+				column.Default = defaultValue
+				column.HasDefault = true
+			}
+		}
+		// like MySQL, a nullable column without an explicit default defaults to NULL
+		if !column.HasDefault && column.Nullable {
+			column.HasDefault = true
+		}
+		columns = append(columns, column)
 	}
-	tableNameString := tableName.Name.String()
-	return map_table.CreateTable(databaseName, tableNameString)
+	return map_table.NewTableSchema(columns)
 }
@@ -2,34 +2,36 @@ package data_query
 
 import (
 	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
 
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
-func HandleDelete(databaseName string, deleteStm *sqlparser.Delete) error {
-	tableName := deleteStm.TableExprs[0].(*sqlparser.AliasedTableExpr)
-	tableNameString := tableName.TableNameString()
-	table, err := map_table.GetTable(databaseName, tableNameString)
+func HandleDelete(databaseName string, deleteStm *sqlparser.Delete) (uint64, error) {
+	if len(deleteStm.TableExprs) != 1 {
+		return 0, errors.New("DELETE with multiple tables is not currently supported")
+	}
+	tableName, ok := deleteStm.TableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported DELETE table expression: %s", sqlparser.String(deleteStm.TableExprs[0]))
+	}
+	if len(deleteStm.OrderBy) > 0 || deleteStm.Limit != nil {
+		return 0, errors.New("DELETE with ORDER BY or LIMIT is not currently supported")
+	}
+	tableDatabase, tableNameString, err := aliasedTableName(databaseName, tableName)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if where := deleteStm.Where; where != nil {
-		predicate, err := BuildPredicateFromExpr[map[string]any](where.Expr)
-		if err == nil {
-			err := table.Delete(predicate)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
-	} else {
-		err := table.Delete(func(a map[string]any) bool {
-			return true
-		})
-		if err != nil {
-			return err
-		}
-		return nil
+	table, err := map_table.GetTable(tableDatabase, tableNameString)
+	if err != nil {
+		return 0, err
+	}
+	scope := newTableScope(tableName, tableNameString, table)
+	scope.expirations = usesExpiration(deleteStm)
+	access, err := planTableAccess(scope, table, deleteStm.Where)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return access.delete()
 }
@@ -0,0 +1,46 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func HandleDropDatabase(dropDatabaseStm *sqlparser.DropDatabase) error {
+	err := map_table.DropDatabase(dropDatabaseStm.DBName.String())
+	if dropDatabaseStm.IfExists && errors.Is(err, map_table.ErrDatabaseNotExists) {
+		return nil
+	}
+	return err
+}
+
+func HandleDropTable(databaseName string, dropTableStm *sqlparser.DropTable) (uint64, error) {
+	// every table is checked before the first one is dropped, so a missing table drops nothing
+	if !dropTableStm.IfExists {
+		for _, tableName := range dropTableStm.FromTables {
+			if _, err := map_table.GetTable(tableDatabaseName(databaseName, tableName), tableName.Name.String()); err != nil {
+				return 0, fmt.Errorf("%s: %w", sqlparser.String(tableName), err)
+			}
+		}
+	}
+
+	var droppedTables uint64
+	for _, tableName := range dropTableStm.FromTables {
+		err := map_table.DropTable(tableDatabaseName(databaseName, tableName), tableName.Name.String())
+		if err != nil {
+			if dropTableStm.IfExists && (errors.Is(err, map_table.ErrTableNotExists) || errors.Is(err, map_table.ErrDatabaseNotExists)) {
+				continue
+			}
+			return droppedTables, err
+		}
+		droppedTables++
+	}
+	return droppedTables, nil
+}
+
+func HandleTruncateTable(databaseName string, truncateTableStm *sqlparser.TruncateTable) error {
+	tableName := truncateTableStm.Table
+	return map_table.TruncateTable(tableDatabaseName(databaseName, tableName), tableName.Name.String())
+}
@@ -0,0 +1,671 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// valueEvaluator computes an expression for one row, a nil result is SQL NULL.
+type valueEvaluator func(row map[string]any) (any, error)
+
+// expressionScope is the table an expression reads its columns from.
+type expressionScope struct {
+	// tableName is the alias of the table when it has one
+	tableName string
+	schema    *map_table.TableSchema
+	// tables are the tables of a join, a joined row stores their columns under "table.column"
+	tables []*expressionScope
+	// aggregates allows aggregate functions, their value is computed per group and read from the group row
+	aggregates bool
+	// aliases are the select list names HAVING and ORDER BY may refer to, they win over table columns
+	aliases map[string]bool
+	// inserted allows VALUES(column) of ON DUPLICATE KEY UPDATE and columns qualified by insertAlias,
+	// they read the value the statement tried to insert from the row, see insertedKey
+	inserted    bool
+	insertAlias string
+	// expirations allows TTL() and EXPIRES_AT(), which read the expiration of the row from expirationKey
+	expirations bool
+}
+
+// expirationKey is the key the expiration of a row is stored under, in unix nanoseconds or -1, for statements using TTL() or EXPIRES_AT().
+const expirationKey = aggregateKeyPrefix + "EXPIRATION"
+
+// usesExpiration tells whether a statement calls TTL() or EXPIRES_AT().
+func usesExpiration(node sqlparser.SQLNode) bool {
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if function, ok := node.(*sqlparser.FuncExpr); ok && isExpirationFunction(function.Name.Lowered()) {
+			found = true
+		}
+		return !found, nil
+	}, node)
+	return found
+}
+
+func isExpirationFunction(name string) bool {
+	return name == "ttl" || name == "expires_at"
+}
+
+// insertedKey is the key the value an INSERT tried to write to a column is stored under in the row ON DUPLICATE KEY UPDATE evaluates,
+// next to the columns of the stored row.
+func insertedKey(column string) string {
+	return aggregateKeyPrefix + "VALUES(" + column + ")"
+}
+
+// newTableScope is the scope of a single table of a FROM clause, its columns are qualified by the alias when it has one.
+func newTableScope(tableExpr *sqlparser.AliasedTableExpr, tableName string, table *map_table.DataTable) *expressionScope {
+	scope := &expressionScope{
+		tableName: tableName,
+		schema:    table.Schema(),
+	}
+	if !tableExpr.As.IsEmpty() {
+		scope.tableName = tableExpr.As.String()
+	}
+	return scope
+}
+
+// resolveColumn returns the key the column is stored under in a row.
+func (scope *expressionScope) resolveColumn(col *sqlparser.ColName) (string, error) {
+	key, _, err := scope.lookupColumn(col)
+	return key, err
+}
+
+// lookupColumn resolves a column to its row key and, for tables with a schema, its definition.
+func (scope *expressionScope) lookupColumn(col *sqlparser.ColName) (string, *map_table.ColumnDefinition, error) {
+	name := col.Name.String()
+	if col.Qualifier.IsEmpty() && scope.aliases[name] {
+		return name, nil, nil
+	}
+	if len(scope.tables) > 0 {
+		return scope.lookupJoinedColumn(col)
+	}
+	if scope.inserted && scope.insertAlias != "" && strings.EqualFold(col.Qualifier.Name.String(), scope.insertAlias) {
+		key, definition, err := scope.lookupColumn(&sqlparser.ColName{Name: col.Name})
+		if err != nil {
+			return "", nil, err
+		}
+		return insertedKey(key), definition, nil
+	}
+	if !col.Qualifier.IsEmpty() && !strings.EqualFold(col.Qualifier.Name.String(), scope.tableName) {
+		return "", nil, fmt.Errorf("unknown column '%s' in field list", sqlparser.String(col))
+	}
+	if scope.schema == nil {
+		return name, nil, nil
+	}
+	column, ok := scope.schema.Column(name)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown column '%s' in field list", sqlparser.String(col))
+	}
+	return column.Name, column, nil
+}
+
+// lookupJoinedColumn finds the table of a column in a join. An unqualified name has to belong to exactly one table,
+// schemaless tables only claim it when no table with a schema has such a column.
+func (scope *expressionScope) lookupJoinedColumn(col *sqlparser.ColName) (string, *map_table.ColumnDefinition, error) {
+	name := col.Name.String()
+	var matches, schemalessMatches []string
+	var definition *map_table.ColumnDefinition
+	for _, table := range scope.tables {
+		if !col.Qualifier.IsEmpty() && !strings.EqualFold(col.Qualifier.Name.String(), table.tableName) {
+			continue
+		}
+		if table.schema == nil {
+			schemalessMatches = append(schemalessMatches, table.tableName+"."+name)
+			continue
+		}
+		if column, ok := table.schema.Column(name); ok {
+			matches = append(matches, table.tableName+"."+column.Name)
+			definition = column
+		}
+	}
+	if len(matches) == 0 {
+		matches = schemalessMatches
+		definition = nil
+	}
+	switch len(matches) {
+	case 0:
+		return "", nil, fmt.Errorf("unknown column '%s' in field list", sqlparser.String(col))
+	case 1:
+		return matches[0], definition, nil
+	}
+	return "", nil, fmt.Errorf("column '%s' in field list is ambiguous", sqlparser.String(col))
+}
+
+func buildValueEvaluator(scope *expressionScope, expr sqlparser.Expr) (valueEvaluator, error) {
+	switch expression := expr.(type) {
+	case sqlparser.AggrFunc:
+		if !scope.aggregates {
+			return nil, fmt.Errorf("invalid use of group function: %s", sqlparser.String(expr))
+		}
+		key := aggregateKey(expression)
+		return func(row map[string]any) (any, error) {
+			return row[key], nil
+		}, nil
+
+	case *sqlparser.ComparisonExpr:
+		return buildComparisonEvaluator(scope, expression)
+
+	case *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.XorExpr, *sqlparser.NotExpr:
+		return buildLogicalEvaluator(scope, expression)
+
+	case *sqlparser.BetweenExpr:
+		return buildBetweenEvaluator(scope, expression)
+
+	case *sqlparser.IsExpr:
+		return buildIsEvaluator(scope, expression)
+
+	case *sqlparser.ColName:
+		key, err := scope.resolveColumn(expression)
+		if err != nil {
+			return nil, err
+		}
+		return func(row map[string]any) (any, error) {
+			return row[key], nil
+		}, nil
+
+	case *sqlparser.ValuesFuncExpr:
+		if !scope.inserted {
+			return nil, fmt.Errorf("VALUES() is only supported in ON DUPLICATE KEY UPDATE: %s", sqlparser.String(expr))
+		}
+		key, err := scope.resolveColumn(expression.Name)
+		if err != nil {
+			return nil, err
+		}
+		return func(row map[string]any) (any, error) {
+			return row[insertedKey(key)], nil
+		}, nil
+
+	case *sqlparser.Literal, *sqlparser.NullVal, sqlparser.BoolVal:
+		value, err := literalValue(expression)
+		if err != nil {
+			return nil, err
+		}
+		return constantEvaluator(value), nil
+
+	case *sqlparser.UnaryExpr:
+		operand, err := buildValueEvaluator(scope, expression.Expr)
+		if err != nil {
+			return nil, err
+		}
+		switch expression.Operator {
+		case sqlparser.UPlusOp:
+			return operand, nil
+		case sqlparser.UMinusOp:
+			return func(row map[string]any) (any, error) {
+				value, err := operand(row)
+				if err != nil {
+					return nil, err
+				}
+				return arithmetic(sqlparser.MinusOp, int64(0), value)
+			}, nil
+		}
+
+	case *sqlparser.BinaryExpr:
+		left, err := buildValueEvaluator(scope, expression.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := buildValueEvaluator(scope, expression.Right)
+		if err != nil {
+			return nil, err
+		}
+		switch expression.Operator {
+		case sqlparser.PlusOp, sqlparser.MinusOp, sqlparser.MultOp, sqlparser.DivOp, sqlparser.IntDivOp, sqlparser.ModOp:
+			return func(row map[string]any) (any, error) {
+				leftValue, err := left(row)
+				if err != nil {
+					return nil, err
+				}
+				rightValue, err := right(row)
+				if err != nil {
+					return nil, err
+				}
+				return arithmetic(expression.Operator, leftValue, rightValue)
+			}, nil
+		}
+
+	case *sqlparser.CurTimeFuncExpr:
+		name := expression.Name.Lowered()
+		if name == "now" || name == "current_timestamp" || name == "localtime" || name == "localtimestamp" {
+			return func(map[string]any) (any, error) {
+				return time.Now(), nil
+			}, nil
+		}
+
+	case *sqlparser.CaseExpr:
+		return buildCaseEvaluator(scope, expression)
+
+	case *sqlparser.FuncExpr:
+		return buildFunctionEvaluator(scope, expression)
+	}
+	return nil, fmt.Errorf("unsupported expression: %s", sqlparser.String(expr))
+}
+
+func constantEvaluator(value any) valueEvaluator {
+	return func(map[string]any) (any, error) {
+		return value, nil
+	}
+}
+
+func buildCaseEvaluator(scope *expressionScope, expression *sqlparser.CaseExpr) (valueEvaluator, error) {
+	var subject valueEvaluator
+	var err error
+	if expression.Expr != nil {
+		if subject, err = buildValueEvaluator(scope, expression.Expr); err != nil {
+			return nil, err
+		}
+	}
+	conditions := make([]valueEvaluator, len(expression.Whens))
+	results := make([]valueEvaluator, len(expression.Whens))
+	for i, when := range expression.Whens {
+		if conditions[i], err = buildValueEvaluator(scope, when.Cond); err != nil {
+			return nil, err
+		}
+		if results[i], err = buildValueEvaluator(scope, when.Val); err != nil {
+			return nil, err
+		}
+	}
+	elseResult := constantEvaluator(nil)
+	if expression.Else != nil {
+		if elseResult, err = buildValueEvaluator(scope, expression.Else); err != nil {
+			return nil, err
+		}
+	}
+	return func(row map[string]any) (any, error) {
+		var subjectValue any
+		if subject != nil {
+			value, err := subject(row)
+			if err != nil {
+				return nil, err
+			}
+			subjectValue = value
+		}
+		for i, condition := range conditions {
+			conditionValue, err := condition(row)
+			if err != nil {
+				return nil, err
+			}
+			var matched bool
+			if subject != nil {
+				matched = subjectValue != nil && conditionValue != nil && valuesEqual(subjectValue, conditionValue)
+			} else {
+				matched = isTrue(conditionValue)
+			}
+			if matched {
+				return results[i](row)
+			}
+		}
+		return elseResult(row)
+	}, nil
+}
+
+func buildFunctionEvaluator(scope *expressionScope, expression *sqlparser.FuncExpr) (valueEvaluator, error) {
+	arguments := make([]valueEvaluator, len(expression.Exprs))
+	for i, argument := range expression.Exprs {
+		evaluator, err := buildValueEvaluator(scope, argument)
+		if err != nil {
+			return nil, err
+		}
+		arguments[i] = evaluator
+	}
+	name := expression.Name.Lowered()
+	if isExpirationFunction(name) {
+		return buildExpirationEvaluator(scope, name, len(arguments))
+	}
+	function, ok := scalarFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported function: %s", name)
+	}
+	if len(arguments) < function.minArgs || (function.maxArgs >= 0 && len(arguments) > function.maxArgs) {
+		return nil, fmt.Errorf("incorrect parameter count in the call to function %s", name)
+	}
+	return func(row map[string]any) (any, error) {
+		values := make([]any, len(arguments))
+		for i, argument := range arguments {
+			value, err := argument(row)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return function.call(values)
+	}, nil
+}
+
+// buildExpirationEvaluator evaluates TTL(), the whole seconds a row has left like TTL of Redis and -1 for a row that never expires,
+// and EXPIRES_AT(), the time the row expires at or NULL.
+func buildExpirationEvaluator(scope *expressionScope, name string, argumentCount int) (valueEvaluator, error) {
+	if argumentCount != 0 {
+		return nil, fmt.Errorf("incorrect parameter count in the call to function %s", name)
+	}
+	if !scope.expirations {
+		return nil, fmt.Errorf("function %s is only supported on a single table", name)
+	}
+	return func(row map[string]any) (any, error) {
+		expiration, ok := row[expirationKey].(int64)
+		if !ok {
+			return nil, nil
+		}
+		if name == "expires_at" {
+			if expiration == -1 {
+				return nil, nil
+			}
+			return time.Unix(0, expiration), nil
+		}
+		if expiration == -1 {
+			return int64(-1), nil
+		}
+		left := time.Until(time.Unix(0, expiration))
+		return int64(max((left+time.Second-1)/time.Second, 0)), nil
+	}, nil
+}
+
+type scalarFunction struct {
+	minArgs int
+	// maxArgs is -1 for variadic functions
+	maxArgs int
+	call    func(args []any) (any, error)
+}
+
+var scalarFunctions = map[string]scalarFunction{
+	"concat": {1, -1, func(args []any) (any, error) {
+		var builder strings.Builder
+		for _, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			builder.WriteString(utils.FormatValue(arg))
+		}
+		return builder.String(), nil
+	}},
+	"upper": {1, 1, stringFunction(strings.ToUpper)},
+	"ucase": {1, 1, stringFunction(strings.ToUpper)},
+	"lower": {1, 1, stringFunction(strings.ToLower)},
+	"lcase": {1, 1, stringFunction(strings.ToLower)},
+	"length": {1, 1, func(args []any) (any, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return int64(len(utils.FormatValue(args[0]))), nil
+	}},
+	"char_length": {1, 1, func(args []any) (any, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return int64(len([]rune(utils.FormatValue(args[0])))), nil
+	}},
+	"abs": {1, 1, func(args []any) (any, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		if isNegative(args[0]) {
+			return arithmetic(sqlparser.MinusOp, int64(0), args[0])
+		}
+		return args[0], nil
+	}},
+	"round": {1, 2, func(args []any) (any, error) {
+		return roundNumber(args, func(f float64) float64 { return math.Round(f) })
+	}},
+	"floor": {1, 1, func(args []any) (any, error) {
+		return roundNumber(args, math.Floor)
+	}},
+	"ceil": {1, 1, func(args []any) (any, error) {
+		return roundNumber(args, math.Ceil)
+	}},
+	"ceiling": {1, 1, func(args []any) (any, error) {
+		return roundNumber(args, math.Ceil)
+	}},
+	"mod": {2, 2, func(args []any) (any, error) {
+		return arithmetic(sqlparser.ModOp, args[0], args[1])
+	}},
+	"coalesce": {1, -1, func(args []any) (any, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}},
+	"ifnull": {2, 2, func(args []any) (any, error) {
+		if args[0] != nil {
+			return args[0], nil
+		}
+		return args[1], nil
+	}},
+	"if": {3, 3, func(args []any) (any, error) {
+		if isTrue(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	}},
+}
+
+func stringFunction(transform func(string) string) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return transform(utils.FormatValue(args[0])), nil
+	}
+}
+
+// roundNumber applies rounding to args[0], the optional args[1] is the number of decimals to keep.
+func roundNumber(args []any, rounding func(float64) float64) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+	places := int64(0)
+	if len(args) > 1 {
+		if args[1] == nil {
+			return nil, nil
+		}
+		number, err := toNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+		integer, ok := number.(int64)
+		if !ok {
+			return nil, fmt.Errorf("number of decimals must be an integer")
+		}
+		places = integer
+	}
+	number, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch n := number.(type) {
+	case int64:
+		return n, nil
+	case decimal.Decimal:
+		if len(args) == 1 {
+			f, _ := n.Float64()
+			return decimal.NewFromFloat(rounding(f)), nil
+		}
+		return n.Round(int32(places)), nil
+	case float64:
+		scale := math.Pow(10, float64(places))
+		return rounding(n*scale) / scale, nil
+	}
+	return nil, fmt.Errorf("cannot round %T", number)
+}
+
+func isNegative(value any) bool {
+	result, err := utils.CompareValues(value, int64(0))
+	return err == nil && result < 0
+}
+
+// isTrue is the truth value of a condition, NULL and zero values are not true.
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return err == nil && f != 0
+	}
+	result, err := utils.CompareValues(value, int64(0))
+	return err == nil && result != 0
+}
+
+func valuesEqual(a, b any) bool {
+	result, err := utils.CompareValues(a, b)
+	return err == nil && result == 0
+}
+
+// toNumber converts a value to int64, float64 or decimal for arithmetic, strings are parsed like MySQL does.
+func toNumber(value any) (any, error) {
+	switch v := value.(type) {
+	case int64, float64, decimal.Decimal:
+		return v, nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		return decimal.NewFromUint(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		trimmed := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %T value %v as a number", value, value)
+}
+
+// arithmetic applies a binary operator, integers stay integers except for '/', decimals win over integers and floats over both.
+func arithmetic(op sqlparser.BinaryExprOperator, leftValue, rightValue any) (any, error) {
+	if leftValue == nil || rightValue == nil {
+		return nil, nil
+	}
+	left, err := toNumber(leftValue)
+	if err != nil {
+		return nil, err
+	}
+	right, err := toNumber(rightValue)
+	if err != nil {
+		return nil, err
+	}
+
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	if leftIsInt && rightIsInt {
+		switch op {
+		case sqlparser.PlusOp:
+			return leftInt + rightInt, nil
+		case sqlparser.MinusOp:
+			return leftInt - rightInt, nil
+		case sqlparser.MultOp:
+			return leftInt * rightInt, nil
+		case sqlparser.IntDivOp:
+			if rightInt == 0 {
+				return nil, nil
+			}
+			return leftInt / rightInt, nil
+		case sqlparser.ModOp:
+			if rightInt == 0 {
+				return nil, nil
+			}
+			return leftInt % rightInt, nil
+		}
+	}
+
+	_, leftIsFloat := left.(float64)
+	_, rightIsFloat := right.(float64)
+	if leftIsFloat || rightIsFloat || (op == sqlparser.DivOp && leftIsInt && rightIsInt) {
+		leftFloat, rightFloat := toFloat(left), toFloat(right)
+		switch op {
+		case sqlparser.PlusOp:
+			return leftFloat + rightFloat, nil
+		case sqlparser.MinusOp:
+			return leftFloat - rightFloat, nil
+		case sqlparser.MultOp:
+			return leftFloat * rightFloat, nil
+		case sqlparser.DivOp:
+			if rightFloat == 0 {
+				return nil, nil
+			}
+			return leftFloat / rightFloat, nil
+		case sqlparser.IntDivOp:
+			if rightFloat == 0 {
+				return nil, nil
+			}
+			return int64(leftFloat / rightFloat), nil
+		case sqlparser.ModOp:
+			if rightFloat == 0 {
+				return nil, nil
+			}
+			return math.Mod(leftFloat, rightFloat), nil
+		}
+	}
+
+	leftDecimal, rightDecimal := toDecimalNumber(left), toDecimalNumber(right)
+	switch op {
+	case sqlparser.PlusOp:
+		return leftDecimal.Add(rightDecimal), nil
+	case sqlparser.MinusOp:
+		return leftDecimal.Sub(rightDecimal), nil
+	case sqlparser.MultOp:
+		return leftDecimal.Mul(rightDecimal), nil
+	case sqlparser.DivOp:
+		if rightDecimal.IsZero() {
+			return nil, nil
+		}
+		return leftDecimal.Div(rightDecimal, 4), nil
+	case sqlparser.IntDivOp:
+		if rightDecimal.IsZero() {
+			return nil, nil
+		}
+		quotient, _ := leftDecimal.QuoRem(rightDecimal, 0)
+		result, _ := quotient.Int64()
+		return result, nil
+	case sqlparser.ModOp:
+		if rightDecimal.IsZero() {
+			return nil, nil
+		}
+		_, remainder := leftDecimal.QuoRem(rightDecimal, 0)
+		return remainder, nil
+	}
+	return nil, fmt.Errorf("unsupported arithmetic operator: %s", op.ToString())
+}
+
+func toFloat(number any) float64 {
+	switch n := number.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case decimal.Decimal:
+		f, _ := n.Float64()
+		return f
+	}
+	return 0
+}
+
+func toDecimalNumber(number any) decimal.Decimal {
+	switch n := number.(type) {
+	case int64:
+		return decimal.NewFromInt(n)
+	case float64:
+		return decimal.NewFromFloat(n)
+	case decimal.Decimal:
+		return n
+	}
+	return decimal.Decimal{}
+}
@@ -4,45 +4,177 @@ import (
 	"a-eighty/mem_cache/map_table"
 	"a-eighty/utils"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
-func HandleInsert(databaseName string, insertStm *sqlparser.Insert) error {
+type insertRow struct {
+	data map[string]any
+	ttl  time.Duration
+}
+
+// insertColumn is an entry of the INSERT column list resolved against the table schema.
+type insertColumn struct {
+	name string
+	// definition is nil for schemaless tables and for the TTL column
+	definition *map_table.ColumnDefinition
+	isTTL      bool
+}
+
+func HandleInsert(databaseName string, insertStm *sqlparser.Insert) (uint64, error) {
 	table, err := insertStm.Table.TableName()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if table.IsEmpty() {
-		return errors.New("table name is empty")
+		return 0, errors.New("table name is empty")
 	}
 	dataTable, err := map_table.GetTable(databaseName, table.Name.String())
 	if err != nil {
-		return err
-	}
-	var ttl time.Duration
-	ttl = -1
-	dataMap := make(map[string]any)
-	var columns []string
-	for _, col := range insertStm.Columns {
-		columns = append(columns, sqlparser.String(col))
-	}
-	if values, ok := insertStm.Rows.(sqlparser.Values); ok {
-		for _, row := range values {
-			for j, expr := range row {
-				colName := columns[j]
-				valueString := sqlparser.String(expr)
-				if strings.ToUpper(colName) == "TTL" {
-					if duration, convertErr := utils.ParseISO8601Duration(valueString); convertErr == nil {
-						ttl = duration
-					}
-					continue
-				}
-				dataMap[colName] = valueString
+		return 0, err
+	}
+	if len(insertStm.Columns) == 0 {
+		return 0, errors.New("INSERT without a column list is not supported")
+	}
+	schema := dataTable.Schema()
+	columns, err := resolveInsertColumns(schema, insertStm.Columns)
+	if err != nil {
+		return 0, err
+	}
+	values, ok := insertStm.Rows.(sqlparser.Values)
+	if !ok {
+		return 0, fmt.Errorf("unsupported INSERT source: %T", insertStm.Rows)
+	}
+
+	// rows without a TTL column live for the default TTL of the table
+	defaultTTL := tableDefaultTTL(dataTable)
+	// every tuple is converted before the first one is written, so a bad tuple rejects the whole statement
+	rows := make([]insertRow, 0, len(values))
+	for i, row := range values {
+		parsedRow, err := buildInsertRow(schema, columns, row, defaultTTL)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		rows = append(rows, parsedRow)
+	}
+	data := make([]map[string]any, len(rows))
+	ttls := make([]time.Duration, len(rows))
+	for i, row := range rows {
+		data[i], ttls[i] = row.data, row.ttl
+	}
+	switch {
+	case insertStm.Action == sqlparser.ReplaceAct:
+		// like MySQL the deleted rows are counted together with the inserted ones
+		return dataTable.ReplaceRows(data, ttls)
+	case len(insertStm.OnDup) > 0:
+		assignments, err := buildDuplicateKeyAssignments(insertStm, dataTable, table.Name.String())
+		if err != nil {
+			return 0, err
+		}
+		return upsertRows(dataTable, rows, assignments)
+	}
+
+	// duplicate keys are checked among the tuples as well, so a statement breaking a constraint writes nothing
+	if err := dataTable.InsertRows(data, ttls); err != nil {
+		return 0, err
+	}
+	return uint64(len(rows)), nil
+}
+
+func resolveInsertColumns(schema *map_table.TableSchema, columnNames sqlparser.Columns) ([]insertColumn, error) {
+	columns := make([]insertColumn, 0, len(columnNames))
+	seen := make(map[string]bool, len(columnNames))
+	for _, col := range columnNames {
+		column := insertColumn{name: col.String()}
+		if schema != nil {
+			if definition, ok := schema.Column(column.name); ok {
+				column.name = definition.Name
+				column.definition = definition
 			}
 		}
+		if column.definition == nil && strings.ToUpper(column.name) == "TTL" {
+			column.isTTL = true
+		} else if column.definition == nil && schema != nil {
+			return nil, fmt.Errorf("unknown column '%s' in field list", column.name)
+		}
+		if seen[strings.ToLower(column.name)] {
+			return nil, fmt.Errorf("column '%s' specified twice", column.name)
+		}
+		seen[strings.ToLower(column.name)] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// buildInsertRow converts a tuple of INSERT, ttl is how long the row lives unless the tuple has a TTL column, -1 for ever.
+func buildInsertRow(schema *map_table.TableSchema, columns []insertColumn, row sqlparser.ValTuple, ttl time.Duration) (insertRow, error) {
+	if len(row) != len(columns) {
+		return insertRow{}, fmt.Errorf("column count %d doesn't match value count %d", len(columns), len(row))
+	}
+	parsedRow := insertRow{
+		data: make(map[string]any, len(columns)),
+		ttl:  ttl,
+	}
+	for j, expr := range row {
+		column := columns[j]
+		if column.isTTL {
+			duration, err := parseTTLValue(expr)
+			if err != nil {
+				return insertRow{}, err
+			}
+			parsedRow.ttl = duration
+			continue
+		}
+		var value any
+		var err error
+		if column.definition != nil {
+			value, err = convertColumnValue(column.definition, expr)
+		} else {
+			value, err = literalValue(expr)
+		}
+		if err != nil {
+			return insertRow{}, err
+		}
+		parsedRow.data[column.name] = value
+	}
+	if schema != nil {
+		for _, definition := range schema.Columns {
+			if _, ok := parsedRow.data[definition.Name]; ok {
+				continue
+			}
+			if !definition.HasDefault {
+				return insertRow{}, fmt.Errorf("field '%s' doesn't have a default value", definition.Name)
+			}
+			parsedRow.data[definition.Name] = definition.Default
+		}
+	}
+	return parsedRow, nil
+}
+
+// tableDefaultTTL returns the ttl table setting, -1 when rows of the table never expire by default.
+func tableDefaultTTL(table *map_table.DataTable) time.Duration {
+	if ttl := table.Options().DefaultTTL; ttl > 0 {
+		return ttl
+	}
+	return -1
+}
+
+// parseTTLValue reads the TTL column, an ISO 8601 duration like 'PT30M' or NULL for a row that never expires
+// whatever the default TTL of the table.
+func parseTTLValue(expr sqlparser.Expr) (time.Duration, error) {
+	value, err := literalValue(expr)
+	if err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return -1, nil
+	}
+	ttlString, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("TTL must be an ISO 8601 duration string, got %s", sqlparser.String(expr))
 	}
-	return dataTable.Insert(dataMap, ttl)
+	return utils.ParseISO8601Duration(ttlString)
 }
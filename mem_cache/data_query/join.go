@@ -0,0 +1,369 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// joinRelation is a table or the result of joining tables, its rows store the columns of every table under "table.column".
+type joinRelation struct {
+	tables []*expressionScope
+	// table is the stored table of a relation over a single table, its value buckets serve as hash index
+	table *map_table.DataTable
+	rows  []map[string]any
+}
+
+// joinKey is an equality of the join condition between an expression of the left and one of the right relation.
+type joinKey struct {
+	left  valueEvaluator
+	right valueEvaluator
+	// indexColumn is set when the right side is a typed column of a stored table, rows are then looked up in its value buckets
+	indexColumn string
+	definition  *map_table.ColumnDefinition
+}
+
+func selectJoin(databaseName string, selectStmt *sqlparser.Select) (*QueryResult, error) {
+	relation, err := buildFromRelation(databaseName, selectStmt.From)
+	if err != nil {
+		return nil, err
+	}
+	scope := &expressionScope{tables: relation.tables}
+
+	rows := relation.loadRows()
+	if selectStmt.Where != nil {
+		where, err := buildValueEvaluator(scope, selectStmt.Where.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build WHERE clause predicate: %w", err)
+		}
+		filtered := make([]map[string]any, 0, len(rows))
+		for _, row := range rows {
+			value, err := where(row)
+			if err != nil {
+				return nil, err
+			}
+			if isTrue(value) {
+				filtered = append(filtered, row)
+			}
+		}
+		rows = filtered
+	}
+
+	if isAggregateSelect(selectStmt) {
+		return selectAggregate(scope, selectStmt, func(groupKeys []valueEvaluator, aggregates []aggregateDefinition) ([]map[string]any, error) {
+			return groupRows(rows, groupKeys, aggregates)
+		})
+	}
+	selectProjection, err := buildProjection(scope, selectStmt.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	return finishSelect(scope, selectStmt, selectProjection, rows)
+}
+
+// buildFromRelation joins the entries of a FROM list, entries separated by commas form a cross join.
+func buildFromRelation(databaseName string, tableExprs sqlparser.TableExprs) (*joinRelation, error) {
+	var result *joinRelation
+	for _, tableExpr := range tableExprs {
+		relation, err := buildTableRelation(databaseName, tableExpr)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = relation
+			continue
+		}
+		if result, err = joinRelations(result, relation, sqlparser.NormalJoinType, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func buildTableRelation(databaseName string, tableExpr sqlparser.TableExpr) (*joinRelation, error) {
+	switch expression := tableExpr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		tableDatabase, tableNameString, err := aliasedTableName(databaseName, expression)
+		if err != nil {
+			return nil, err
+		}
+		table, err := map_table.GetTable(tableDatabase, tableNameString)
+		if err != nil {
+			return nil, err
+		}
+		return &joinRelation{tables: []*expressionScope{newTableScope(expression, tableNameString, table)}, table: table}, nil
+	case *sqlparser.JoinTableExpr:
+		left, err := buildTableRelation(databaseName, expression.LeftExpr)
+		if err != nil {
+			return nil, err
+		}
+		right, err := buildTableRelation(databaseName, expression.RightExpr)
+		if err != nil {
+			return nil, err
+		}
+		return joinRelations(left, right, expression.Join, expression.Condition)
+	case *sqlparser.ParenTableExpr:
+		return buildFromRelation(databaseName, expression.Exprs)
+	}
+	return nil, fmt.Errorf("unsupported FROM expression: %s", sqlparser.String(tableExpr))
+}
+
+// loadRows returns the rows of the relation, a stored table is only read once its rows are needed.
+func (relation *joinRelation) loadRows() []map[string]any {
+	if relation.rows == nil && relation.table != nil {
+		allRows := relation.table.QueryWithCriteria(func(map[string]any) bool {
+			return true
+		}, nil, nil, nil)
+		relation.rows = prefixRows(allRows, relation.tables[0].tableName)
+	}
+	return relation.rows
+}
+
+func prefixRows(rows []map[string]any, tableName string) []map[string]any {
+	prefixed := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		prefixed[i] = make(map[string]any, len(row))
+		for key, value := range row {
+			prefixed[i][tableName+"."+key] = value
+		}
+	}
+	return prefixed
+}
+
+// joinRelations pairs the rows of both relations that satisfy the condition. Equalities of the condition are used as hash join keys,
+// through the value buckets of the right table when it is a stored one, other conditions are checked on every pair.
+func joinRelations(left, right *joinRelation, joinType sqlparser.JoinType, condition *sqlparser.JoinCondition) (*joinRelation, error) {
+	tables := make([]*expressionScope, 0, len(left.tables)+len(right.tables))
+	tables = append(tables, left.tables...)
+	for _, table := range right.tables {
+		for _, existing := range tables {
+			if strings.EqualFold(existing.tableName, table.tableName) {
+				return nil, fmt.Errorf("not unique table/alias: '%s'", table.tableName)
+			}
+		}
+		tables = append(tables, table)
+	}
+
+	outer := false
+	switch joinType {
+	case sqlparser.NormalJoinType, sqlparser.StraightJoinType:
+	case sqlparser.LeftJoinType:
+		outer = true
+	case sqlparser.RightJoinType:
+		// a right join is the left join with both sides swapped, the tables keep their order for SELECT *
+		outer = true
+		left, right = right, left
+	default:
+		return nil, errors.New("NATURAL JOIN is not currently supported")
+	}
+
+	var on valueEvaluator
+	var keys []joinKey
+	var err error
+	leftScope := &expressionScope{tables: left.tables}
+	rightScope := &expressionScope{tables: right.tables}
+	if condition != nil {
+		if condition.On != nil {
+			if on, err = buildValueEvaluator(&expressionScope{tables: tables}, condition.On); err != nil {
+				return nil, err
+			}
+			keys = equiJoinKeys(leftScope, rightScope, condition.On)
+		}
+		for _, column := range condition.Using {
+			colName := &sqlparser.ColName{Name: column}
+			key, err := buildJoinKey(leftScope, rightScope, colName, colName)
+			if err != nil {
+				return nil, fmt.Errorf("unknown column '%s' in 'from clause'", column.String())
+			}
+			keys = append(keys, key)
+		}
+		if len(condition.Using) > 0 {
+			// rows that are not found through the keys are paired with every right row, the columns must still be equal
+			on = usingCondition(keys)
+		}
+	}
+
+	var indexKey *joinKey
+	if right.table != nil {
+		for i := range keys {
+			if keys[i].indexColumn != "" && right.table.HasLookupIndex(keys[i].indexColumn) {
+				indexKey = &keys[i]
+				break
+			}
+		}
+	}
+	var hashed map[string][]map[string]any
+	if indexKey == nil && len(keys) > 0 {
+		hashed = make(map[string][]map[string]any)
+		for _, rightRow := range right.loadRows() {
+			key, ok, err := joinKeyValue(rightRow, keys, func(key joinKey) valueEvaluator { return key.right })
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				hashed[key] = append(hashed[key], rightRow)
+			}
+		}
+	}
+	lookedUp := make(map[any][]map[string]any)
+
+	rows := make([]map[string]any, 0)
+	for _, leftRow := range left.loadRows() {
+		var candidates []map[string]any
+		switch {
+		case indexKey != nil:
+			value, err := indexKey.left(leftRow)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				break
+			}
+			converted, ok := indexValue(indexKey.definition, value)
+			if !ok {
+				// equal rows may sit in several buckets, they are found by checking the condition on every right row
+				candidates = right.loadRows()
+				break
+			}
+			value = converted
+			valueKey := utils.ValueKey(value)
+			cached, ok := lookedUp[valueKey]
+			if !ok {
+				lookupRows, ok := right.table.LookupRows(indexKey.indexColumn, value)
+				if !ok {
+					// the index was dropped meanwhile
+					candidates = right.loadRows()
+					break
+				}
+				cached = prefixRows(lookupRows, right.tables[0].tableName)
+				lookedUp[valueKey] = cached
+			}
+			candidates = cached
+		case hashed != nil:
+			key, ok, err := joinKeyValue(leftRow, keys, func(key joinKey) valueEvaluator { return key.left })
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				candidates = hashed[key]
+			}
+		default:
+			candidates = right.loadRows()
+		}
+
+		matched := false
+		for _, rightRow := range candidates {
+			joined := make(map[string]any, len(leftRow)+len(rightRow))
+			for key, value := range leftRow {
+				joined[key] = value
+			}
+			for key, value := range rightRow {
+				joined[key] = value
+			}
+			if on != nil {
+				value, err := on(joined)
+				if err != nil {
+					return nil, err
+				}
+				if !isTrue(value) {
+					continue
+				}
+			}
+			rows = append(rows, joined)
+			matched = true
+		}
+		// the columns of the missing right row are absent and read as NULL
+		if outer && !matched {
+			rows = append(rows, leftRow)
+		}
+	}
+	return &joinRelation{tables: tables, rows: rows}, nil
+}
+
+// usingCondition evaluates the equalities of the columns of USING on a joined row like an ON condition would.
+func usingCondition(keys []joinKey) valueEvaluator {
+	return func(row map[string]any) (any, error) {
+		for _, key := range keys {
+			left, err := key.left(row)
+			if err != nil {
+				return nil, err
+			}
+			right, err := key.right(row)
+			if err != nil {
+				return nil, err
+			}
+			if left == nil || right == nil {
+				return nil, nil
+			}
+			if !valuesEqual(left, right) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+// equiJoinKeys finds the equalities between both relations among the conditions joined by AND.
+func equiJoinKeys(leftScope, rightScope *expressionScope, on sqlparser.Expr) []joinKey {
+	var keys []joinKey
+	for _, conjunct := range splitAnd(on) {
+		comparison, ok := conjunct.(*sqlparser.ComparisonExpr)
+		if !ok || comparison.Operator != sqlparser.EqualOp {
+			continue
+		}
+		if key, err := buildJoinKey(leftScope, rightScope, comparison.Left, comparison.Right); err == nil {
+			keys = append(keys, key)
+		} else if key, err := buildJoinKey(leftScope, rightScope, comparison.Right, comparison.Left); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func buildJoinKey(leftScope, rightScope *expressionScope, leftExpr, rightExpr sqlparser.Expr) (joinKey, error) {
+	left, err := buildValueEvaluator(leftScope, leftExpr)
+	if err != nil {
+		return joinKey{}, err
+	}
+	right, err := buildValueEvaluator(rightScope, rightExpr)
+	if err != nil {
+		return joinKey{}, err
+	}
+	key := joinKey{left: left, right: right}
+	if colName, ok := rightExpr.(*sqlparser.ColName); ok && len(rightScope.tables) == 1 {
+		rowKey, definition, err := rightScope.lookupColumn(colName)
+		if err != nil {
+			return joinKey{}, err
+		}
+		if definition != nil {
+			key.indexColumn = strings.TrimPrefix(rowKey, rightScope.tables[0].tableName+".")
+			key.definition = definition
+		}
+	}
+	return key, nil
+}
+
+// joinKeyValue combines the values of the join keys of a row, false when one of them is NULL since NULL never equals anything.
+func joinKeyValue(row map[string]any, keys []joinKey, side func(key joinKey) valueEvaluator) (string, bool, error) {
+	var builder strings.Builder
+	for _, key := range keys {
+		value, err := side(key)(row)
+		if err != nil || value == nil {
+			return "", false, err
+		}
+		writeValueKey(&builder, value)
+	}
+	return builder.String(), true, nil
+}
+
+// splitAnd returns the conditions joined by AND.
+func splitAnd(expr sqlparser.Expr) []sqlparser.Expr {
+	if and, ok := expr.(*sqlparser.AndExpr); ok {
+		return append(splitAnd(and.Left), splitAnd(and.Right)...)
+	}
+	return []sqlparser.Expr{expr}
+}
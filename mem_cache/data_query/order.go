@@ -0,0 +1,277 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"cmp"
+	"errors"
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// finishSelect evaluates the select list over the rows, then applies HAVING, DISTINCT, ORDER BY and LIMIT to the result.
+func finishSelect(scope *expressionScope, selectStmt *sqlparser.Select, selectProjection *projection, rows []map[string]any) (*QueryResult, error) {
+	aliasExprs := selectAliases(selectStmt)
+	resultScope := withSelectAliases(scope, aliasExprs)
+
+	var having valueEvaluator
+	var err error
+	if selectStmt.Having != nil {
+		if having, err = buildValueEvaluator(resultScope, selectStmt.Having.Expr); err != nil {
+			return nil, err
+		}
+	}
+	ordering, err := buildResultOrdering(resultScope, selectStmt)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := parseLimit(selectStmt.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if having == nil && len(ordering) == 0 && !selectStmt.Distinct {
+		// nothing reorders or drops rows, so only the rows within LIMIT have to be evaluated
+		rows = limitRows(rows, limit, offset)
+		limit, offset = nil, nil
+	}
+	columns, outputRows, err := selectProjection.apply(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// HAVING and ORDER BY see the row together with the values of the select list aliases
+	results := make([]selectResult, 0, len(rows))
+	distinct := newDistinctSet(selectStmt.Distinct)
+	values := make([]any, len(columns))
+	for i, row := range rows {
+		if len(aliasExprs) > 0 {
+			resultRow := make(map[string]any, len(row)+len(aliasExprs))
+			for key, value := range row {
+				resultRow[key] = value
+			}
+			for alias := range aliasExprs {
+				resultRow[alias] = outputRows[i][alias]
+			}
+			row = resultRow
+		}
+		if having != nil {
+			value, err := having(row)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(value) {
+				continue
+			}
+		}
+		// of the rows with equal output values the first one is kept, NULLs count as equal
+		for j, column := range columns {
+			values[j] = outputRows[i][column.Name]
+		}
+		if !distinct.firstSeen(values...) {
+			continue
+		}
+		results = append(results, selectResult{row: row, output: outputRows[i]})
+	}
+	if err := ordering.sort(results); err != nil {
+		return nil, err
+	}
+
+	results = limitRows(results, limit, offset)
+	resultRows := make([]map[string]any, len(results))
+	for i, result := range results {
+		resultRows[i] = result.output
+	}
+	return &QueryResult{Columns: columns, Rows: resultRows, RowsAffected: uint64(len(resultRows))}, nil
+}
+
+// withSelectAliases returns a copy of scope in which the aliases of the select list can be referenced.
+func withSelectAliases(scope *expressionScope, aliasExprs map[string]sqlparser.Expr) *expressionScope {
+	resultScope := *scope
+	resultScope.aliases = make(map[string]bool, len(aliasExprs))
+	for alias := range aliasExprs {
+		resultScope.aliases[alias] = true
+	}
+	return &resultScope
+}
+
+// selectResult is a row of the result, row is what ORDER BY sees and output what the client gets.
+type selectResult struct {
+	row    map[string]any
+	output map[string]any
+}
+
+// limitRows skips offset rows and keeps at most limit of the rest.
+func limitRows[T any](rows []T, limit, offset *uint64) []T {
+	if offset != nil {
+		if *offset >= uint64(len(rows)) {
+			return rows[:0]
+		}
+		rows = rows[*offset:]
+	}
+	if limit != nil && *limit < uint64(len(rows)) {
+		rows = rows[:*limit]
+	}
+	return rows
+}
+
+type orderKey struct {
+	evaluator  valueEvaluator
+	descending bool
+	// nullsFirst defaults to MySQL's order, NULL before other values ascending and after them descending
+	nullsFirst bool
+}
+
+type resultOrdering []orderKey
+
+// nullsFirstMarker and nullsLastMarker stand in for NULLS FIRST and NULLS LAST, which the parser does not accept,
+// as an extra ORDER BY item right after the item they belong to.
+const (
+	nullsFirstMarker = "\x00nulls_first"
+	nullsLastMarker  = "\x00nulls_last"
+)
+
+// rewriteNullsOrdering replaces NULLS FIRST and NULLS LAST in a query with marker items.
+func rewriteNullsOrdering(parser *sqlparser.Parser, query string) string {
+	if !strings.Contains(strings.ToLower(query), "nulls") {
+		return query
+	}
+	tokenizer := parser.NewStringTokenizer(query)
+	var builder strings.Builder
+	written := 0
+	previousType, previousStart := 0, 0
+	for {
+		tokenType, value := tokenizer.Scan()
+		if tokenType == 0 || tokenType == sqlparser.LEX_ERROR {
+			break
+		}
+		end := tokenizer.Pos
+		start := end - len(value)
+		if previousType == sqlparser.NULLS && (tokenType == sqlparser.FIRST || tokenType == sqlparser.LAST) {
+			marker := nullsFirstMarker
+			if tokenType == sqlparser.LAST {
+				marker = nullsLastMarker
+			}
+			builder.WriteString(query[written:previousStart])
+			builder.WriteString(", `" + marker + "`")
+			written = end
+		}
+		previousType, previousStart = tokenType, start
+	}
+	if written == 0 {
+		return query
+	}
+	builder.WriteString(query[written:])
+	return builder.String()
+}
+
+// buildResultOrdering resolves ORDER BY against the result, positions refer to the select list.
+func buildResultOrdering(scope *expressionScope, selectStmt *sqlparser.Select) (resultOrdering, error) {
+	ordering := make(resultOrdering, 0, len(selectStmt.OrderBy))
+	for _, order := range selectStmt.OrderBy {
+		orderExpr := order.Expr
+		if colName, ok := orderExpr.(*sqlparser.ColName); ok && colName.Qualifier.IsEmpty() {
+			if marker := colName.Name.String(); marker == nullsFirstMarker || marker == nullsLastMarker {
+				if len(ordering) == 0 {
+					return nil, errors.New("NULLS FIRST or NULLS LAST must follow an ORDER BY expression")
+				}
+				ordering[len(ordering)-1].nullsFirst = marker == nullsFirstMarker
+				continue
+			}
+		}
+		if literal, ok := orderExpr.(*sqlparser.Literal); ok && literal.Type == sqlparser.IntVal {
+			resolved, err := resolveSelectReference(scope, selectStmt, nil, literal, "order clause")
+			if err != nil {
+				return nil, err
+			}
+			orderExpr = resolved
+		}
+		evaluator, err := buildValueEvaluator(scope, orderExpr)
+		if err != nil {
+			return nil, err
+		}
+		descending := order.Direction == sqlparser.DescOrder
+		ordering = append(ordering, orderKey{evaluator: evaluator, descending: descending, nullsFirst: !descending})
+	}
+	return ordering, nil
+}
+
+// sort orders the results stably, rows with equal keys keep the order they came in.
+func (ordering resultOrdering) sort(results []selectResult) error {
+	if len(ordering) == 0 {
+		return nil
+	}
+	type sortEntry struct {
+		result selectResult
+		keys   []any
+	}
+	entries := make([]sortEntry, len(results))
+	for i, result := range results {
+		entries[i] = sortEntry{result: result, keys: make([]any, len(ordering))}
+		for j, key := range ordering {
+			value, err := key.evaluator(result.row)
+			if err != nil {
+				return err
+			}
+			entries[i].keys[j] = value
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		for j, key := range ordering {
+			if result := key.compare(entries[a].keys[j], entries[b].keys[j]); result != 0 {
+				return result < 0
+			}
+		}
+		return false
+	})
+	for i, entry := range entries {
+		results[i] = entry.result
+	}
+	return nil
+}
+
+// compare orders two values of the key, NULL goes where nullsFirst puts it whatever the direction.
+func (key orderKey) compare(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case (a == nil) == key.nullsFirst:
+			return -1
+		default:
+			return 1
+		}
+	}
+	result := compareOrdered(a, b)
+	if key.descending {
+		return -result
+	}
+	return result
+}
+
+// compareOrdered orders two non-NULL values, values that cannot be compared with each other are ordered by their type:
+// numbers, then text, then times and then binary values.
+func compareOrdered(a, b any) int {
+	if result, err := utils.CompareValues(a, b); err == nil {
+		return result
+	}
+	return cmp.Compare(typeRank(a), typeRank(b))
+}
+
+func typeRank(value any) int {
+	columnType, ok := map_table.ColumnTypeOf(value)
+	if !ok {
+		return 4
+	}
+	switch columnType {
+	case map_table.ColumnTypeString:
+		return 1
+	case map_table.ColumnTypeTime:
+		return 2
+	case map_table.ColumnTypeBytes:
+		return 3
+	}
+	return 0
+}
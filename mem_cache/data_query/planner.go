@@ -0,0 +1,660 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// rowSet holds the indexes of the rows a condition can match.
+type rowSet map[int]struct{}
+
+// tableAccess is how a statement reaches the rows of one table: the candidate rows found through the value buckets,
+// or a scan of every row when candidates is nil, and the WHERE clause every candidate is checked against.
+type tableAccess struct {
+	table      *map_table.DataTable
+	candidates []int
+	predicate  func(map[string]any) bool
+	// filter is the WHERE clause of a scan compiled for batches, nil without WHERE clause, see scanBatches
+	filter batchFilter
+	// columns are the columns a scan reads, all of them when nil
+	columns []string
+	// expirations hands the predicate and the returned rows the expiration of each row under expirationKey
+	expirations bool
+}
+
+// planTableAccess compiles the WHERE clause and looks up the rows it can match, through the primary key when the clause fixes it
+// and in the value buckets or the indexes of the table otherwise.
+func planTableAccess(scope *expressionScope, table *map_table.DataTable, where *sqlparser.Where) (*tableAccess, error) {
+	access := &tableAccess{
+		table:       table,
+		expirations: scope.expirations,
+		predicate: func(map[string]any) bool {
+			return true
+		},
+	}
+	if where == nil {
+		return access, nil
+	}
+	predicate, err := buildRowPredicate(scope, where.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build WHERE clause predicate: %w", err)
+	}
+	access.predicate = predicate
+	if index, found, ok := primaryKeyRow(scope, table, where.Expr); ok {
+		access.candidates = []int{}
+		if found {
+			access.candidates = append(access.candidates, index)
+		}
+	} else if rows, ok := planCondition(scope, table, where.Expr); ok {
+		access.candidates = make([]int, 0, len(rows))
+		for index := range rows {
+			access.candidates = append(access.candidates, index)
+		}
+		sort.Ints(access.candidates)
+	}
+	if access.scans() {
+		if access.filter, err = buildBatchFilter(scope, where.Expr); err != nil {
+			return nil, fmt.Errorf("failed to build WHERE clause predicate: %w", err)
+		}
+	}
+	return access, nil
+}
+
+func (access *tableAccess) rows() []map[string]any {
+	if access.scans() {
+		return access.scan(nil)
+	}
+	if !access.expirations && !access.table.TracksAccess() {
+		return access.table.QueryIndexes(access.candidates, access.predicate, nil, nil, nil)
+	}
+	indexes := access.matchingIndexes()
+	rows := make([]map[string]any, 0, len(indexes))
+	for _, index := range indexes {
+		if row, ok := access.rowWithExpiration(index); ok {
+			rows = append(rows, row)
+		}
+	}
+	access.touch(indexes)
+	return rows
+}
+
+func (access *tableAccess) delete() (uint64, error) {
+	if !access.expirations {
+		return access.table.DeleteIndexes(access.writeCandidates(), access.predicate)
+	}
+	indexes := access.matchingIndexes()
+	if len(indexes) == 0 {
+		// a nil candidate list stands for all rows
+		return 0, nil
+	}
+	return access.table.DeleteIndexes(indexes, alwaysTrue)
+}
+
+// update rewrites the matching rows with updater, a non-nil ttl then restarts their expiration like EXPIRE of Redis, or removes it for -1.
+func (access *tableAccess) update(updater func(map[string]any) (map[string]any, error), ttl *time.Duration) (uint64, error) {
+	if !access.expirations && ttl == nil {
+		return access.table.UpdateIndexes(access.writeCandidates(), access.predicate, updater)
+	}
+	indexes := access.matchingIndexes()
+	if len(indexes) == 0 {
+		return 0, nil
+	}
+	updated, err := access.table.UpdateIndexes(indexes, alwaysTrue, updater)
+	if err != nil || ttl == nil {
+		return updated, err
+	}
+	for _, index := range indexes {
+		access.table.Expire(index, *ttl)
+	}
+	return updated, nil
+}
+
+// matchingIndexes returns the indexes of the candidate rows the WHERE clause matches, in ascending order.
+func (access *tableAccess) matchingIndexes() []int {
+	return access.table.MatchingRowIndexes(access.candidates, func(index int, row map[string]any) bool {
+		if !access.expirations {
+			return access.predicate(row)
+		}
+		row, ok := access.rowWithExpiration(index)
+		return ok && access.predicate(row)
+	})
+}
+
+// rowWithExpiration returns the row at index, holding its expiration under expirationKey when the statement reads it.
+func (access *tableAccess) rowWithExpiration(index int) (map[string]any, bool) {
+	row, ok := access.table.GetDataByIndex(index)
+	if !ok || !access.expirations {
+		return row, ok
+	}
+	expiration, ok := access.table.Expiration(index)
+	if !ok {
+		return nil, false
+	}
+	row = maps.Clone(row)
+	row[expirationKey] = expiration
+	return row, true
+}
+
+// touch reports the rows a SELECT read, which restarts their expiration under sliding_ttl and counts for LRU and LFU eviction.
+func (access *tableAccess) touch(indexes []int) {
+	if access.table.TracksAccess() {
+		access.table.Accessed(indexes)
+	}
+}
+
+func alwaysTrue(map[string]any) bool {
+	return true
+}
+
+// selectRows returns the rows a SELECT has to order and limit. For ORDER BY ... LIMIT on a column with an ordered index only the first
+// offset + limit matching rows in the order of the column are read, together with the rows tied with the last of them,
+// so ordering them gives the same result as ordering every matching row.
+func (access *tableAccess) selectRows(scope *expressionScope, selectStmt *sqlparser.Select) ([]map[string]any, error) {
+	limit, offset, err := parseLimit(selectStmt.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if limit != nil && len(selectStmt.OrderBy) == 0 && !selectStmt.Distinct && selectStmt.Having == nil && access.scans() {
+		// without ORDER BY, LIMIT keeps the first matching rows of the scan
+		count := *limit
+		if offset != nil {
+			if count += *offset; count < *limit {
+				return access.rows(), nil
+			}
+		}
+		return access.scan(&count), nil
+	}
+	if limit == nil || len(selectStmt.OrderBy) == 0 || selectStmt.Distinct || selectStmt.Having != nil || access.expirations {
+		return access.rows(), nil
+	}
+	count := *limit
+	if offset != nil {
+		if count += *offset; count < *limit {
+			return access.rows(), nil
+		}
+	}
+	column, ok := selectStmt.OrderBy[0].Expr.(*sqlparser.ColName)
+	if !ok {
+		return access.rows(), nil
+	}
+	// ORDER BY sees the aliases of the select list, an alias named like a column hides it
+	_, definition, err := withSelectAliases(scope, selectAliases(selectStmt)).lookupColumn(column)
+	if err != nil || definition == nil || !access.table.HasOrderedIndex(definition.Name) {
+		return access.rows(), nil
+	}
+	descending := selectStmt.OrderBy[0].Direction == sqlparser.DescOrder
+	nullsFirst := !descending
+	if len(selectStmt.OrderBy) > 1 {
+		if marker, ok := selectStmt.OrderBy[1].Expr.(*sqlparser.ColName); ok && marker.Qualifier.IsEmpty() {
+			switch marker.Name.String() {
+			case nullsFirstMarker:
+				nullsFirst = true
+			case nullsLastMarker:
+				nullsFirst = false
+			}
+		}
+	}
+
+	from, to, empty := access.columnBounds(scope, definition, selectStmt.Where)
+	if empty || count == 0 {
+		return nil, nil
+	}
+	var candidates rowSet
+	if access.candidates != nil {
+		if from == nil && to == nil {
+			// the rows found through other columns are fewer to sort than the column has rows to walk
+			return access.rows(), nil
+		}
+		candidates = make(rowSet, len(access.candidates))
+		for _, index := range access.candidates {
+			candidates[index] = struct{}{}
+		}
+	}
+
+	var matches []indexedRow
+	var last any
+	access.table.OrderedRows(definition.Name, from, to, descending, nullsFirst, func(index int, row map[string]any) bool {
+		value := row[definition.Name]
+		if uint64(len(matches)) >= count && utils.ValueKey(value) != utils.ValueKey(last) {
+			return false
+		}
+		if candidates != nil {
+			if _, ok := candidates[index]; !ok {
+				return true
+			}
+		}
+		if access.predicate(row) {
+			matches = append(matches, indexedRow{index: index, row: row})
+			last = value
+		}
+		return true
+	})
+	// rows with equal keys have to reach the final sort in the order of a scan
+	sort.Slice(matches, func(a, b int) bool {
+		return matches[a].index < matches[b].index
+	})
+	rows := make([]map[string]any, len(matches))
+	indexes := make([]int, len(matches))
+	for i, match := range matches {
+		rows[i] = match.row
+		indexes[i] = match.index
+	}
+	access.touch(indexes)
+	return rows, nil
+}
+
+type indexedRow struct {
+	index int
+	row   map[string]any
+}
+
+// columnBounds narrows the walk over the ordered index of a column to the ranges the WHERE clause puts on it with AND,
+// empty is set when a bound is NULL and nothing can match.
+func (access *tableAccess) columnBounds(scope *expressionScope, definition *map_table.ColumnDefinition, where *sqlparser.Where) (from, to *map_table.RangeBound, empty bool) {
+	if where == nil {
+		return nil, nil, false
+	}
+	for _, conjunct := range splitAnd(where.Expr) {
+		condition, ok := parseRangeCondition(conjunct)
+		if !ok {
+			continue
+		}
+		conditionDefinition, conditionFrom, conditionTo, conditionEmpty, ok := condition.bounds(scope)
+		if !ok || conditionDefinition != definition {
+			continue
+		}
+		if conditionEmpty {
+			return nil, nil, true
+		}
+		from = tighterBound(from, conditionFrom, 1)
+		to = tighterBound(to, conditionTo, -1)
+	}
+	return from, to, false
+}
+
+// tighterBound keeps the bound that lets fewer values through, direction is 1 for lower bounds and -1 for upper ones.
+func tighterBound(current, candidate *map_table.RangeBound, direction int) *map_table.RangeBound {
+	if candidate == nil {
+		return current
+	}
+	if current == nil {
+		return candidate
+	}
+	result, err := utils.CompareValues(candidate.Value, current.Value)
+	if err != nil {
+		return current
+	}
+	if result*direction > 0 || result == 0 && !candidate.Inclusive {
+		return candidate
+	}
+	return current
+}
+
+// planCondition returns a superset of the rows matching the condition, false when it cannot be narrowed without a scan.
+// Equalities and IN lists on a column read the value buckets or an index of the column, ranges read an ordered index of the column,
+// AND intersects and OR unites the sets of its sides.
+func planCondition(scope *expressionScope, table *map_table.DataTable, expr sqlparser.Expr) (rowSet, bool) {
+	switch expression := expr.(type) {
+	case *sqlparser.AndExpr:
+		return planConjunction(scope, table, splitAnd(expression))
+	case *sqlparser.OrExpr:
+		left, leftOk := planCondition(scope, table, expression.Left)
+		if !leftOk {
+			return nil, false
+		}
+		right, rightOk := planCondition(scope, table, expression.Right)
+		if !rightOk {
+			return nil, false
+		}
+		for index := range right {
+			left[index] = struct{}{}
+		}
+		return left, true
+	case *sqlparser.ComparisonExpr:
+		switch expression.Operator {
+		case sqlparser.EqualOp:
+			if column, valueExpr, ok := parseEquality(expression); ok {
+				return lookupRows(scope, table, column, valueExpr)
+			}
+		case sqlparser.InOp:
+			column, ok := expression.Left.(*sqlparser.ColName)
+			list, isList := expression.Right.(sqlparser.ValTuple)
+			if !ok || !isList {
+				return nil, false
+			}
+			rows := make(rowSet)
+			for _, element := range list {
+				elementRows, ok := lookupRows(scope, table, column, element)
+				if !ok {
+					return nil, false
+				}
+				for index := range elementRows {
+					rows[index] = struct{}{}
+				}
+			}
+			return rows, true
+		}
+	}
+	if condition, ok := parseRangeCondition(expr); ok {
+		return rangeRows(scope, table, condition)
+	}
+	return nil, false
+}
+
+// planConjunction intersects the rows of the conditions joined by AND that can be narrowed,
+// equalities on several columns are also looked up together in a composite index.
+func planConjunction(scope *expressionScope, table *map_table.DataTable, conjuncts []sqlparser.Expr) (rowSet, bool) {
+	var rows rowSet
+	planned := false
+	intersect := func(conjunctRows rowSet) {
+		if planned {
+			rows = intersectRows(rows, conjunctRows)
+		} else {
+			rows, planned = conjunctRows, true
+		}
+	}
+	for _, conjunct := range conjuncts {
+		if conjunctRows, ok := planCondition(scope, table, conjunct); ok {
+			intersect(conjunctRows)
+		}
+	}
+	if equalities, _ := conjunctEqualities(scope, conjuncts); len(equalities) > 1 {
+		if indexes, ok := table.CompositeRowIndexes(equalities); ok {
+			intersect(toRowSet(indexes))
+		}
+	}
+	return rows, planned
+}
+
+// conjunctEqualities collects the constants columns are compared with by the equalities among conditions joined by AND,
+// keyed by column name. empty is set when a column is compared with NULL, then no row matches.
+func conjunctEqualities(scope *expressionScope, conjuncts []sqlparser.Expr) (equalities map[string]any, empty bool) {
+	equalities = make(map[string]any)
+	for _, conjunct := range conjuncts {
+		comparison, ok := conjunct.(*sqlparser.ComparisonExpr)
+		if !ok || comparison.Operator != sqlparser.EqualOp {
+			continue
+		}
+		column, valueExpr, ok := parseEquality(comparison)
+		if !ok {
+			continue
+		}
+		definition, value, isNull, ok := equalityValue(scope, column, valueExpr)
+		if !ok {
+			continue
+		}
+		if isNull {
+			empty = true
+			continue
+		}
+		equalities[definition.Name] = value
+	}
+	return equalities, empty
+}
+
+// primaryKeyRow finds the only row a WHERE clause can match when its conditions joined by AND fix every column of the primary key
+// with equalities, found is false when no row holds the key. It returns false when the clause does not fix the key.
+func primaryKeyRow(scope *expressionScope, table *map_table.DataTable, where sqlparser.Expr) (index int, found, ok bool) {
+	primaryKey := table.PrimaryKey()
+	if primaryKey == nil {
+		return 0, false, false
+	}
+	equalities, empty := conjunctEqualities(scope, splitAnd(where))
+	if empty {
+		return 0, false, true
+	}
+	values := make([]any, len(primaryKey))
+	for i, column := range primaryKey {
+		value, ok := equalities[column]
+		if !ok {
+			return 0, false, false
+		}
+		values[i] = value
+	}
+	index, found = table.PrimaryKeyRowIndex(values...)
+	return index, found, true
+}
+
+// parseEquality recognizes an equality between a column and another expression.
+func parseEquality(comparison *sqlparser.ComparisonExpr) (*sqlparser.ColName, sqlparser.Expr, bool) {
+	if column, ok := comparison.Left.(*sqlparser.ColName); ok {
+		return column, comparison.Right, true
+	}
+	if column, ok := comparison.Right.(*sqlparser.ColName); ok {
+		return column, comparison.Left, true
+	}
+	return nil, nil, false
+}
+
+// rangeCondition is a comparison of a column with constants that bounds it on one or both sides.
+type rangeCondition struct {
+	column                     *sqlparser.ColName
+	from, to                   sqlparser.Expr
+	fromInclusive, toInclusive bool
+}
+
+// parseRangeCondition recognizes <, <=, >, >= and BETWEEN between a column and other expressions.
+func parseRangeCondition(expr sqlparser.Expr) (*rangeCondition, bool) {
+	switch expression := expr.(type) {
+	case *sqlparser.ComparisonExpr:
+		operator := expression.Operator
+		column, ok := expression.Left.(*sqlparser.ColName)
+		valueExpr := expression.Right
+		if !ok {
+			if column, ok = expression.Right.(*sqlparser.ColName); !ok {
+				return nil, false
+			}
+			valueExpr = expression.Left
+			// 5 < id is id > 5
+			switch operator {
+			case sqlparser.LessThanOp:
+				operator = sqlparser.GreaterThanOp
+			case sqlparser.LessEqualOp:
+				operator = sqlparser.GreaterEqualOp
+			case sqlparser.GreaterThanOp:
+				operator = sqlparser.LessThanOp
+			case sqlparser.GreaterEqualOp:
+				operator = sqlparser.LessEqualOp
+			}
+		}
+		switch operator {
+		case sqlparser.LessThanOp, sqlparser.LessEqualOp:
+			return &rangeCondition{column: column, to: valueExpr, toInclusive: operator == sqlparser.LessEqualOp}, true
+		case sqlparser.GreaterThanOp, sqlparser.GreaterEqualOp:
+			return &rangeCondition{column: column, from: valueExpr, fromInclusive: operator == sqlparser.GreaterEqualOp}, true
+		}
+	case *sqlparser.BetweenExpr:
+		column, ok := expression.Left.(*sqlparser.ColName)
+		if !ok || !expression.IsBetween {
+			return nil, false
+		}
+		return &rangeCondition{column: column, from: expression.From, to: expression.To, fromInclusive: true, toInclusive: true}, true
+	}
+	return nil, false
+}
+
+// bounds evaluates the bounds of the range for the ordered index of its column, empty is set when a bound is NULL
+// since no value compares with NULL.
+func (condition *rangeCondition) bounds(scope *expressionScope) (definition *map_table.ColumnDefinition, from, to *map_table.RangeBound, empty, ok bool) {
+	_, definition, err := scope.lookupColumn(condition.column)
+	if err != nil || definition == nil {
+		return nil, nil, nil, false, false
+	}
+	bound := func(valueExpr sqlparser.Expr, inclusive bool) (*map_table.RangeBound, bool) {
+		if valueExpr == nil {
+			return nil, true
+		}
+		value, ok := constantValue(scope, valueExpr)
+		if !ok {
+			return nil, false
+		}
+		if value == nil {
+			empty = true
+			return nil, true
+		}
+		value, ok = rangeValue(definition, value)
+		if !ok {
+			return nil, false
+		}
+		return &map_table.RangeBound{Value: value, Inclusive: inclusive}, true
+	}
+	if from, ok = bound(condition.from, condition.fromInclusive); !ok {
+		return nil, nil, nil, false, false
+	}
+	if to, ok = bound(condition.to, condition.toInclusive); !ok {
+		return nil, nil, nil, false, false
+	}
+	return definition, from, to, empty, true
+}
+
+func rangeRows(scope *expressionScope, table *map_table.DataTable, condition *rangeCondition) (rowSet, bool) {
+	definition, from, to, empty, ok := condition.bounds(scope)
+	if !ok {
+		return nil, false
+	}
+	if empty {
+		return rowSet{}, true
+	}
+	indexes, ok := table.RangeRowIndexes(definition.Name, from, to)
+	if !ok {
+		return nil, false
+	}
+	return toRowSet(indexes), true
+}
+
+// rangeValue converts a non-NULL constant to a bound of the ordered index of a column, false when the column compares with it
+// in another order than its index, e.g. a VARCHAR column compares with a number numerically but its index is in text order.
+func rangeValue(definition *map_table.ColumnDefinition, value any) (any, bool) {
+	switch definition.Type {
+	case map_table.ColumnTypeString, map_table.ColumnTypeBytes:
+		switch value.(type) {
+		case string, []byte:
+			return value, true
+		}
+	case map_table.ColumnTypeTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			parsed, err := utils.ParseSQLTime(v)
+			return parsed, err == nil
+		}
+	default:
+		switch value.(type) {
+		case int64, uint64, float64, decimal.Decimal, bool:
+			return value, true
+		case string:
+			return convertToColumnType(map_table.ColumnTypeDecimal, value)
+		}
+	}
+	return nil, false
+}
+
+// lookupRows reads the rows holding a constant in a column from the value buckets or an index of the column.
+// Without either the equality is left to the batch filter of the scan, which compares dictionary codes.
+func lookupRows(scope *expressionScope, table *map_table.DataTable, column *sqlparser.ColName, valueExpr sqlparser.Expr) (rowSet, bool) {
+	definition, value, empty, ok := equalityValue(scope, column, valueExpr)
+	if !ok || !table.HasLookupIndex(definition.Name) {
+		return nil, false
+	}
+	if empty {
+		return rowSet{}, true
+	}
+	indexes, ok := table.RowIndexes(definition.Name, value)
+	if !ok {
+		return nil, false
+	}
+	return toRowSet(indexes), true
+}
+
+// equalityValue resolves the constant a column is compared with to the value the indexes of the column key it under,
+// empty is set for NULL since nothing equals NULL.
+func equalityValue(scope *expressionScope, column *sqlparser.ColName, valueExpr sqlparser.Expr) (definition *map_table.ColumnDefinition, value any, empty, ok bool) {
+	_, definition, err := scope.lookupColumn(column)
+	if err != nil || definition == nil {
+		return nil, nil, false, false
+	}
+	if value, ok = constantValue(scope, valueExpr); !ok {
+		return nil, nil, false, false
+	}
+	if value == nil {
+		return definition, nil, true, true
+	}
+	if value, ok = indexValue(definition, value); !ok {
+		return nil, nil, false, false
+	}
+	return definition, value, false, true
+}
+
+// indexValue converts a non-NULL value to the value the buckets of a column key it under. Buckets are keyed by the stored value,
+// so only values that equal exactly one value of the column type can use them, e.g. 5 for an INT column but not for a VARCHAR one
+// where '5' and '05' both equal 5.
+func indexValue(definition *map_table.ColumnDefinition, value any) (any, bool) {
+	switch definition.Type {
+	case map_table.ColumnTypeString, map_table.ColumnTypeBytes:
+		switch value.(type) {
+		case string, []byte:
+		default:
+			return nil, false
+		}
+	}
+	return convertToColumnType(definition.Type, value)
+}
+
+// constantValue evaluates an expression that is the same for every row, false for other expressions.
+func constantValue(scope *expressionScope, expr sqlparser.Expr) (any, bool) {
+	if !isConstantExpr(expr) {
+		return nil, false
+	}
+	evaluator, err := buildValueEvaluator(scope, expr)
+	if err != nil {
+		return nil, false
+	}
+	value, err := evaluator(nil)
+	return value, err == nil
+}
+
+// isConstantExpr tells whether an expression is the same for every row, it reads no column and calls no function like NOW().
+func isConstantExpr(expr sqlparser.Expr) bool {
+	constant := true
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node.(type) {
+		case *sqlparser.Literal, *sqlparser.NullVal, sqlparser.BoolVal, *sqlparser.UnaryExpr, *sqlparser.BinaryExpr:
+			return true, nil
+		}
+		if _, ok := node.(sqlparser.Expr); ok {
+			constant = false
+			return false, nil
+		}
+		return true, nil
+	}, expr)
+	return constant
+}
+
+func toRowSet(indexes []int) rowSet {
+	rows := make(rowSet, len(indexes))
+	for _, index := range indexes {
+		rows[index] = struct{}{}
+	}
+	return rows
+}
+
+func intersectRows(left, right rowSet) rowSet {
+	if len(right) < len(left) {
+		left, right = right, left
+	}
+	rows := make(rowSet, len(left))
+	for index := range left {
+		if _, ok := right[index]; ok {
+			rows[index] = struct{}{}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,190 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"fmt"
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// outputColumn is one entry of the select list.
+type outputColumn struct {
+	name      string
+	evaluator valueEvaluator
+	// columnType is known up front for columns of a table with a schema
+	columnType *map_table.ColumnType
+	// expandStar marks a * of a schemaless table, its columns are only known from the rows
+	expandStar bool
+	// keyPrefix selects the row keys of one table of a join when a * is expanded
+	keyPrefix string
+	// qualifiedName replaces name when another column of a join has the same name, e.g. "d.id"
+	qualifiedName string
+}
+
+type projection struct {
+	columns []outputColumn
+}
+
+func buildProjection(scope *expressionScope, selectExprs *sqlparser.SelectExprs) (*projection, error) {
+	result := &projection{}
+	for _, selectExpr := range selectExprs.Exprs {
+		switch expression := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			tables := scope.tables
+			if len(tables) == 0 {
+				tables = []*expressionScope{scope}
+			}
+			found := false
+			for _, table := range tables {
+				if !expression.TableName.IsEmpty() && !strings.EqualFold(expression.TableName.Name.String(), table.tableName) {
+					continue
+				}
+				found = true
+				keyPrefix := ""
+				if len(scope.tables) > 0 {
+					keyPrefix = table.tableName + "."
+				}
+				if table.schema == nil {
+					result.columns = append(result.columns, outputColumn{expandStar: true, keyPrefix: keyPrefix})
+					continue
+				}
+				for i := range table.schema.Columns {
+					result.columns = append(result.columns, schemaOutputColumn(keyPrefix, &table.schema.Columns[i]))
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown table '%s'", sqlparser.String(expression.TableName))
+			}
+		case *sqlparser.AliasedExpr:
+			evaluator, err := buildValueEvaluator(scope, expression.Expr)
+			if err != nil {
+				return nil, err
+			}
+			column := outputColumn{
+				name:      expressionName(expression.Expr),
+				evaluator: evaluator,
+			}
+			if colName, ok := expression.Expr.(*sqlparser.ColName); ok {
+				column.name = colName.Name.String()
+				key, definition, err := scope.lookupColumn(colName)
+				if err != nil {
+					return nil, err
+				}
+				if definition != nil {
+					column.name = definition.Name
+					column.columnType = &definition.Type
+				}
+				column.qualifiedName = key
+			}
+			if !expression.As.IsEmpty() {
+				column.name = expression.As.String()
+				column.qualifiedName = ""
+			}
+			result.columns = append(result.columns, column)
+		default:
+			return nil, fmt.Errorf("unsupported select expression: %s", sqlparser.String(selectExpr))
+		}
+	}
+	return result, nil
+}
+
+// expressionName is the column name MySQL gives an expression of the select list, its text without quoted identifiers.
+func expressionName(expr sqlparser.Expr) string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.SetEscapeNoIdentifier()
+	buf.Myprintf("%v", expr)
+	return buf.String()
+}
+
+func schemaOutputColumn(keyPrefix string, definition *map_table.ColumnDefinition) outputColumn {
+	key := keyPrefix + definition.Name
+	return outputColumn{
+		name: definition.Name,
+		evaluator: func(row map[string]any) (any, error) {
+			return row[key], nil
+		},
+		columnType:    &definition.Type,
+		qualifiedName: key,
+	}
+}
+
+// apply evaluates the select list for every row, the result keeps the order of rows and columns.
+func (projection *projection) apply(rows []map[string]any) ([]ColumnMetadata, []map[string]any, error) {
+	columns := projection.expandColumns(rows)
+	resultRows := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		resultRow := make(map[string]any, len(columns))
+		for _, column := range columns {
+			value, err := column.evaluator(row)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to evaluate '%s': %w", column.name, err)
+			}
+			resultRow[column.name] = value
+		}
+		resultRows = append(resultRows, resultRow)
+	}
+
+	metadata := make([]ColumnMetadata, len(columns))
+	for i, column := range columns {
+		metadata[i] = ColumnMetadata{Name: column.name, Type: "NULL"}
+		if column.columnType != nil {
+			metadata[i].Type = column.columnType.String()
+			continue
+		}
+		for _, row := range resultRows {
+			if columnType, ok := map_table.ColumnTypeOf(row[column.name]); ok {
+				metadata[i].Type = columnType.String()
+				break
+			}
+		}
+	}
+	return metadata, resultRows, nil
+}
+
+// expandColumns replaces the * of a schemaless table with the sorted union of the row keys,
+// and qualifies the columns of a join that would otherwise share a name.
+func (projection *projection) expandColumns(rows []map[string]any) []outputColumn {
+	columns := make([]outputColumn, 0, len(projection.columns))
+	for _, column := range projection.columns {
+		if !column.expandStar {
+			columns = append(columns, column)
+			continue
+		}
+		keySet := make(map[string]bool)
+		for _, row := range rows {
+			for key := range row {
+				if strings.HasPrefix(key, aggregateKeyPrefix) || !strings.HasPrefix(key, column.keyPrefix) {
+					continue
+				}
+				keySet[key] = true
+			}
+		}
+		keys := make([]string, 0, len(keySet))
+		for key := range keySet {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			columns = append(columns, outputColumn{
+				name: strings.TrimPrefix(key, column.keyPrefix),
+				evaluator: func(row map[string]any) (any, error) {
+					return row[key], nil
+				},
+				qualifiedName: key,
+			})
+		}
+	}
+
+	nameCount := make(map[string]int, len(columns))
+	for _, column := range columns {
+		nameCount[column.name]++
+	}
+	for i, column := range columns {
+		if nameCount[column.name] > 1 && column.qualifiedName != "" && strings.Contains(column.qualifiedName, ".") {
+			columns[i].name = column.qualifiedName
+		}
+	}
+	return columns
+}
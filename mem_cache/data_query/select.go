@@ -9,93 +9,83 @@ import (
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
-func HandleSelect(databaseName string, selectStmt *sqlparser.Select) ([]map[string]any, error) {
-	tableName := selectStmt.From[0].(*sqlparser.AliasedTableExpr)
-	tableNameString := tableName.TableNameString()
-	table, err := map_table.GetTable(databaseName, tableNameString)
+func HandleSelect(databaseName string, selectStmt *sqlparser.Select) (*QueryResult, error) {
+	tableName, ok := selectStmt.From[0].(*sqlparser.AliasedTableExpr)
+	if len(selectStmt.From) != 1 || !ok {
+		return selectJoin(databaseName, selectStmt)
+	}
+	tableDatabase, tableNameString, err := aliasedTableName(databaseName, tableName)
 	if err != nil {
 		return nil, err
 	}
-
-	predicateFunction := func(map[string]any) bool {
-		return true
+	if tableNameString == "dual" {
+		return selectWithoutTable(selectStmt)
 	}
-	if selectStmt.Where != nil {
-		predicateFunction, err = BuildPredicateFromExpr[map[string]any](selectStmt.Where.Expr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build WHERE clause predicate: %w", err)
-		}
+	table, err := map_table.GetTable(tableDatabase, tableNameString)
+	if err != nil {
+		return nil, err
 	}
 
-	sortFunction := func(a, b map[string]any) bool {
-		return true
+	scope := newTableScope(tableName, tableNameString, table)
+	scope.expirations = usesExpiration(selectStmt)
+	access, err := planTableAccess(scope, table, selectStmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	if columns, ok := referencedColumns(scope, selectStmt); ok {
+		access.columns = columns
+	}
+	if isAggregateSelect(selectStmt) {
+		return selectAggregate(scope, selectStmt, access.group)
 	}
-	if len(selectStmt.OrderBy) > 0 {
-		if len(selectStmt.OrderBy) > 1 {
-			return nil, errors.New("ORDER BY with multiple columns is not currently supported")
-		}
-		order := selectStmt.OrderBy[0]
-		colName, ok := order.Expr.(*sqlparser.ColName)
-		if !ok {
-			return nil, errors.New("ORDER BY expression must be a column name")
-		}
-		fieldName := colName.Name.String()
-		isDesc := order.Direction == sqlparser.DescOrder
-
-		sortFunction = func(a, b map[string]any) bool {
-			mapA, errA := objectToMap(a)
-			mapB, errB := objectToMap(b)
-			if errA != nil || errB != nil {
-				return false
-			}
-
-			valA, okA := mapA[fieldName]
-			valB, okB := mapB[fieldName]
-			if !okA || !okB {
-				return false
-			}
-
-			var isLess bool
-			switch vA := valA.(type) {
-			case float64:
-				if vB, ok := valB.(float64); ok {
-					isLess = vA < vB
-				}
-			case string:
-				if vB, ok := valB.(string); ok {
-					isLess = vA < vB
-				}
-			default:
-
-				isLess = fmt.Sprint(valA) < fmt.Sprint(valB)
-			}
 
-			if isDesc {
-				return !isLess
-			}
-			return isLess
-		}
+	selectProjection, err := buildProjection(scope, selectStmt.SelectExprs)
+	if err != nil {
+		return nil, err
 	}
+	rows, err := access.selectRows(scope, selectStmt)
+	if err != nil {
+		return nil, err
+	}
+	return finishSelect(scope, selectStmt, selectProjection, rows)
+}
 
-	var limitVal *uint64 = nil
-	var offsetVal *uint64 = nil
-	if selectStmt.Limit != nil {
-		if selectStmt.Limit.Offset != nil {
-			parsedVal, err := strconv.ParseUint(sqlparser.String(selectStmt.Limit.Offset), 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid OFFSET value: %w", err)
-			}
-			offsetVal = &parsedVal
-		}
-		parsedVal, err := strconv.ParseUint(sqlparser.String(selectStmt.Limit.Rowcount), 10, 64)
-		limitVal = &parsedVal
+func parseLimit(limit *sqlparser.Limit) (*uint64, *uint64, error) {
+	if limit == nil {
+		return nil, nil, nil
+	}
+	var offsetVal *uint64
+	if limit.Offset != nil {
+		parsedVal, err := strconv.ParseUint(sqlparser.String(limit.Offset), 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid LIMIT value: %w", err)
+			return nil, nil, fmt.Errorf("invalid OFFSET value: %w", err)
 		}
+		offsetVal = &parsedVal
+	}
+	if limit.Rowcount == nil {
+		return nil, offsetVal, nil
+	}
+	parsedVal, err := strconv.ParseUint(sqlparser.String(limit.Rowcount), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid LIMIT value: %w", err)
 	}
+	return &parsedVal, offsetVal, nil
+}
 
-	result := table.QueryWithCriteria(predicateFunction, sortFunction, limitVal, offsetVal)
-	return result, nil
+// selectWithoutTable evaluates a select list of constants like SELECT 1 + 1.
+func selectWithoutTable(selectStmt *sqlparser.Select) (*QueryResult, error) {
+	if selectStmt.Where != nil {
+		return nil, errors.New("WHERE without a table is not supported")
+	}
+	selectProjection, err := buildProjection(&expressionScope{tableName: "dual", schema: &map_table.TableSchema{}}, selectStmt.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	columns, resultRows, err := selectProjection.apply([]map[string]any{{}})
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{Columns: columns, Rows: resultRows, RowsAffected: uint64(len(resultRows))}, nil
 }
 
 type sliceDataProvider[T any] struct {
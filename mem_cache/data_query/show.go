@@ -0,0 +1,64 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"fmt"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// showIndexColumns are the columns of SHOW INDEX, a subset of the ones MySQL returns.
+var showIndexColumns = []ColumnMetadata{
+	{Name: "Table", Type: map_table.ColumnTypeString.String()},
+	{Name: "Non_unique", Type: map_table.ColumnTypeInt.String()},
+	{Name: "Key_name", Type: map_table.ColumnTypeString.String()},
+	{Name: "Seq_in_index", Type: map_table.ColumnTypeInt.String()},
+	{Name: "Column_name", Type: map_table.ColumnTypeString.String()},
+	{Name: "Collation", Type: map_table.ColumnTypeString.String()},
+	{Name: "Index_type", Type: map_table.ColumnTypeString.String()},
+}
+
+func HandleShow(databaseName string, showStm *sqlparser.Show) (*QueryResult, error) {
+	showBasic, ok := showStm.Internal.(*sqlparser.ShowBasic)
+	if !ok || showBasic.Command != sqlparser.Index || showBasic.Filter != nil {
+		return nil, fmt.Errorf("unsupported SHOW statement: %s", sqlparser.String(showStm))
+	}
+	return showIndex(databaseName, showBasic)
+}
+
+// showIndex lists the indexes created on a table with one row per column of each index.
+func showIndex(databaseName string, showBasic *sqlparser.ShowBasic) (*QueryResult, error) {
+	tableDatabase := tableDatabaseName(databaseName, showBasic.Tbl)
+	if !showBasic.DbName.IsEmpty() {
+		tableDatabase = showBasic.DbName.String()
+	}
+	tableNameString := showBasic.Tbl.Name.String()
+	table, err := map_table.GetTable(tableDatabase, tableNameString)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]any, 0)
+	for _, index := range table.Indexes() {
+		// only BTREE indexes keep their rows sorted, in ascending order
+		var collation any
+		if index.Kind == map_table.IndexKindBTree {
+			collation = "A"
+		}
+		nonUnique := int64(1)
+		if index.Unique {
+			nonUnique = 0
+		}
+		for i, column := range index.Columns {
+			rows = append(rows, map[string]any{
+				"Table":        tableNameString,
+				"Non_unique":   nonUnique,
+				"Key_name":     index.Name,
+				"Seq_in_index": int64(i + 1),
+				"Column_name":  column,
+				"Collation":    collation,
+				"Index_type":   index.Kind.String(),
+			})
+		}
+	}
+	return &QueryResult{Columns: append([]ColumnMetadata(nil), showIndexColumns...), Rows: rows, RowsAffected: uint64(len(rows))}, nil
+}
@@ -1,13 +1,20 @@
 package data_query
 
 import (
-	"errors"
 	"fmt"
 
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
+// ColumnMetadata describes one column of a SELECT result, Type is the name of a map_table.ColumnType or NULL.
+type ColumnMetadata struct {
+	Name string
+	Type string
+}
+
 type QueryResult struct {
+	// Columns lists the result columns in select list order, Rows are keyed by their names
+	Columns      []ColumnMetadata
 	Rows         []map[string]any
 	RowsAffected uint64
 }
@@ -21,7 +28,7 @@ func (sqlSession *SqlSession) ExecuteSQL(query string) (*QueryResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := parser.Parse(query)
+	stmt, err := parser.Parse(rewriteNullsOrdering(parser, query))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse SQL query: %w", err)
 	}
@@ -32,18 +39,25 @@ func (sqlSession *SqlSession) ExecuteSQL(query string) (*QueryResult, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &QueryResult{RowsAffected: uint64(len(result)), Rows: result}, nil
+		return result, nil
 	case *sqlparser.Insert:
-		err := HandleInsert(sqlSession.DatabaseName, s)
+		rowsAffected, err := HandleInsert(sqlSession.DatabaseName, s)
 		if err != nil {
 			return nil, err
 		}
-		return &QueryResult{RowsAffected: 1}, nil
+		return &QueryResult{RowsAffected: rowsAffected}, nil
+	case *sqlparser.Update:
+		rowsAffected, err := HandleUpdate(sqlSession.DatabaseName, s)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{RowsAffected: rowsAffected}, nil
 	case *sqlparser.Delete:
-		err := HandleDelete(sqlSession.DatabaseName, s)
+		rowsAffected, err := HandleDelete(sqlSession.DatabaseName, s)
 		if err != nil {
 			return nil, err
 		}
+		return &QueryResult{RowsAffected: rowsAffected}, nil
 	case *sqlparser.CreateTable:
 		err := HandleCreateTable(sqlSession.DatabaseName, s)
 		if err != nil {
@@ -51,11 +65,60 @@ func (sqlSession *SqlSession) ExecuteSQL(query string) (*QueryResult, error) {
 		}
 		return &QueryResult{RowsAffected: 1}, nil
 	case *sqlparser.CreateDatabase:
-		{
-			panic("")
+		err := HandleCreateDatabase(s)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{RowsAffected: 1}, nil
+	case *sqlparser.DropDatabase:
+		err := HandleDropDatabase(s)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{}, nil
+	case *sqlparser.DropTable:
+		rowsAffected, err := HandleDropTable(sqlSession.DatabaseName, s)
+		if err != nil {
+			return nil, err
 		}
+		return &QueryResult{RowsAffected: rowsAffected}, nil
+	case *sqlparser.AlterTable:
+		err := HandleAlterTable(sqlSession.DatabaseName, s)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{}, nil
+	case *sqlparser.Show:
+		result, err := HandleShow(sqlSession.DatabaseName, s)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case *sqlparser.TruncateTable:
+		err := HandleTruncateTable(sqlSession.DatabaseName, s)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryResult{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %T", stmt)
 	}
-	return nil, errors.New("not implement")
+}
+
+// tableDatabaseName returns the database a table belongs to, a qualified name like db.table wins over the session database.
+func tableDatabaseName(databaseName string, tableName sqlparser.TableName) string {
+	if !tableName.Qualifier.IsEmpty() {
+		return tableName.Qualifier.String()
+	}
+	return databaseName
+}
+
+// aliasedTableName returns the database and name of the table a FROM entry refers to,
+// TableName and TableNameString of the entry return its alias instead.
+func aliasedTableName(databaseName string, tableExpr *sqlparser.AliasedTableExpr) (string, string, error) {
+	tableName, ok := tableExpr.Expr.(sqlparser.TableName)
+	if !ok {
+		return "", "", fmt.Errorf("unsupported table expression: %s", sqlparser.String(tableExpr))
+	}
+	return tableDatabaseName(databaseName, tableName), tableName.Name.String(), nil
 }
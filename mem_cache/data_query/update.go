@@ -0,0 +1,123 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func HandleUpdate(databaseName string, updateStm *sqlparser.Update) (uint64, error) {
+	if len(updateStm.TableExprs) != 1 {
+		return 0, errors.New("UPDATE with multiple tables is not currently supported")
+	}
+	tableName, ok := updateStm.TableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return 0, fmt.Errorf("unsupported UPDATE table expression: %s", sqlparser.String(updateStm.TableExprs[0]))
+	}
+	if len(updateStm.OrderBy) > 0 || updateStm.Limit != nil {
+		return 0, errors.New("UPDATE with ORDER BY or LIMIT is not currently supported")
+	}
+	tableDatabase, tableNameString, err := aliasedTableName(databaseName, tableName)
+	if err != nil {
+		return 0, err
+	}
+	table, err := map_table.GetTable(tableDatabase, tableNameString)
+	if err != nil {
+		return 0, err
+	}
+
+	schema := table.Schema()
+	scope := newTableScope(tableName, tableNameString, table)
+	scope.expirations = usesExpiration(updateStm)
+	assignments := make([]updateAssignment, 0, len(updateStm.Exprs))
+	// SET TTL = 'PT1H' restarts the expiration of the rows, NULL makes them never expire and DEFAULT applies the ttl table setting
+	var ttl *time.Duration
+	for _, updateExpr := range updateStm.Exprs {
+		colName := updateExpr.Name.Name.String()
+		var column *map_table.ColumnDefinition
+		if schema != nil {
+			column, _ = schema.Column(colName)
+		}
+		if column == nil && strings.ToUpper(colName) == "TTL" {
+			value := tableDefaultTTL(table)
+			if _, ok := updateExpr.Expr.(*sqlparser.Default); !ok {
+				if value, err = parseTTLValue(updateExpr.Expr); err != nil {
+					return 0, err
+				}
+			}
+			ttl = &value
+			continue
+		}
+		if column == nil && schema != nil {
+			return 0, fmt.Errorf("unknown column '%s' in field list", colName)
+		}
+		assignment, err := buildUpdateAssignment(scope, column, colName, updateExpr.Expr)
+		if err != nil {
+			return 0, err
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	access, err := planTableAccess(scope, table, updateStm.Where)
+	if err != nil {
+		return 0, err
+	}
+	return access.update(func(row map[string]any) (map[string]any, error) {
+		// like MySQL each assignment sees the columns set before it
+		newRow := maps.Clone(row)
+		for _, assignment := range assignments {
+			value, err := assignment.evaluate(newRow)
+			if err != nil {
+				return nil, err
+			}
+			newRow[assignment.column] = value
+		}
+		return newRow, nil
+	}, ttl)
+}
+
+// updateAssignment is an assignment of SET, a literal is converted once and any other expression for every row.
+type updateAssignment struct {
+	column string
+	// definition is nil for schemaless tables
+	definition *map_table.ColumnDefinition
+	value      valueEvaluator
+	constant   any
+}
+
+func buildUpdateAssignment(scope *expressionScope, column *map_table.ColumnDefinition, colName string, expr sqlparser.Expr) (updateAssignment, error) {
+	assignment := updateAssignment{column: colName, definition: column}
+	if column != nil {
+		assignment.column = column.Name
+	}
+	if literal, err := literalValue(expr); err == nil {
+		if column == nil {
+			assignment.constant = literal
+			return assignment, nil
+		}
+		assignment.constant, err = convertColumnValue(column, expr)
+		return assignment, err
+	}
+	value, err := buildValueEvaluator(scope, expr)
+	if err != nil {
+		return updateAssignment{}, err
+	}
+	assignment.value = value
+	return assignment, nil
+}
+
+func (assignment updateAssignment) evaluate(row map[string]any) (any, error) {
+	if assignment.value == nil {
+		return assignment.constant, nil
+	}
+	value, err := assignment.value(row)
+	if err != nil || assignment.definition == nil {
+		return value, err
+	}
+	return computedColumnValue(assignment.definition, value)
+}
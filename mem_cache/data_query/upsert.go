@@ -0,0 +1,135 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// duplicateKeyAssignment is an assignment of ON DUPLICATE KEY UPDATE.
+type duplicateKeyAssignment struct {
+	column string
+	// definition is nil for schemaless tables
+	definition *map_table.ColumnDefinition
+	value      valueEvaluator
+	// isTTL restarts the expiration of the row with ttl, or with the TTL of the inserted row for TTL = VALUES(TTL)
+	isTTL       bool
+	ttl         time.Duration
+	insertedTTL bool
+}
+
+func buildDuplicateKeyAssignments(insertStm *sqlparser.Insert, table *map_table.DataTable, tableName string) ([]duplicateKeyAssignment, error) {
+	scope := newTableScope(insertStm.Table, tableName, table)
+	scope.inserted = true
+	if insertStm.RowAlias != nil {
+		if len(insertStm.RowAlias.Columns) > 0 {
+			return nil, errors.New("column aliases of the inserted row are not currently supported")
+		}
+		scope.insertAlias = insertStm.RowAlias.TableName.String()
+	}
+	schema := table.Schema()
+	assignments := make([]duplicateKeyAssignment, 0, len(insertStm.OnDup))
+	for _, updateExpr := range insertStm.OnDup {
+		assignment := duplicateKeyAssignment{column: updateExpr.Name.Name.String()}
+		if schema != nil {
+			assignment.definition, _ = schema.Column(assignment.column)
+		}
+		if assignment.definition == nil && strings.ToUpper(assignment.column) == "TTL" {
+			assignment.isTTL = true
+			if values, ok := updateExpr.Expr.(*sqlparser.ValuesFuncExpr); ok && strings.ToUpper(values.Name.Name.String()) == "TTL" {
+				assignment.insertedTTL = true
+			} else if ttl, err := parseTTLValue(updateExpr.Expr); err != nil {
+				return nil, err
+			} else {
+				assignment.ttl = ttl
+			}
+			assignments = append(assignments, assignment)
+			continue
+		}
+		if assignment.definition != nil {
+			assignment.column = assignment.definition.Name
+		} else if schema != nil {
+			return nil, fmt.Errorf("unknown column '%s' in field list", assignment.column)
+		}
+		value, err := buildValueEvaluator(scope, updateExpr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		assignment.value = value
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+// upsertRows writes the rows of INSERT ... ON DUPLICATE KEY UPDATE like MySQL, a row sharing the values of a PRIMARY KEY
+// or UNIQUE index with a stored row or a row before it updates the first such row instead of being inserted. An inserted row counts 1
+// and an updated one 2, an update changing neither a value nor the TTL counts 0. A row failing to update writes none of the rows.
+func upsertRows(table *map_table.DataTable, rows []insertRow, assignments []duplicateKeyAssignment) (uint64, error) {
+	data := make([]map[string]any, len(rows))
+	ttls := make([]time.Duration, len(rows))
+	for i, row := range rows {
+		data[i], ttls[i] = row.data, row.ttl
+	}
+	return table.UpsertRows(data, ttls, func(i int, stored map[string]any) (map[string]any, *time.Duration, error) {
+		updated, ttl, err := applyDuplicateKeyUpdate(stored, rows[i], assignments)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if ttl == nil && !rowChanged(stored, updated) {
+			return nil, nil, nil
+		}
+		return updated, ttl, nil
+	})
+}
+
+// applyDuplicateKeyUpdate computes the stored row after the assignments, which see the values of the row the statement tried to insert
+// through VALUES(column) and each see the columns set before it. ttl is nil unless the TTL is assigned.
+func applyDuplicateKeyUpdate(stored map[string]any, row insertRow, assignments []duplicateKeyAssignment) (map[string]any, *time.Duration, error) {
+	updated := maps.Clone(stored)
+	evaluated := maps.Clone(stored)
+	for column, value := range row.data {
+		evaluated[insertedKey(column)] = value
+	}
+	var ttl *time.Duration
+	for _, assignment := range assignments {
+		if assignment.isTTL {
+			value := assignment.ttl
+			if assignment.insertedTTL {
+				value = row.ttl
+			}
+			ttl = &value
+			continue
+		}
+		value, err := assignment.value(evaluated)
+		if err != nil {
+			return nil, nil, err
+		}
+		if assignment.definition != nil {
+			if value, err = computedColumnValue(assignment.definition, value); err != nil {
+				return nil, nil, err
+			}
+		}
+		updated[assignment.column] = value
+		evaluated[assignment.column] = value
+	}
+	return updated, ttl, nil
+}
+
+func rowChanged(oldRow, newRow map[string]any) bool {
+	if len(oldRow) != len(newRow) {
+		return true
+	}
+	for column, value := range newRow {
+		oldValue, ok := oldRow[column]
+		if !ok || utils.ValueKey(oldValue) != utils.ValueKey(value) {
+			return true
+		}
+	}
+	return false
+}
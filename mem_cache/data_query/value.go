@@ -0,0 +1,244 @@
+package data_query
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"a-eighty/utils"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+var columnTypes = map[string]map_table.ColumnType{
+	"tinyint":    map_table.ColumnTypeInt,
+	"smallint":   map_table.ColumnTypeInt,
+	"mediumint":  map_table.ColumnTypeInt,
+	"int":        map_table.ColumnTypeInt,
+	"integer":    map_table.ColumnTypeInt,
+	"bigint":     map_table.ColumnTypeInt,
+	"year":       map_table.ColumnTypeInt,
+	"float":      map_table.ColumnTypeFloat,
+	"double":     map_table.ColumnTypeFloat,
+	"real":       map_table.ColumnTypeFloat,
+	"decimal":    map_table.ColumnTypeDecimal,
+	"numeric":    map_table.ColumnTypeDecimal,
+	"bool":       map_table.ColumnTypeBool,
+	"boolean":    map_table.ColumnTypeBool,
+	"char":       map_table.ColumnTypeString,
+	"varchar":    map_table.ColumnTypeString,
+	"tinytext":   map_table.ColumnTypeString,
+	"text":       map_table.ColumnTypeString,
+	"mediumtext": map_table.ColumnTypeString,
+	"longtext":   map_table.ColumnTypeString,
+	"enum":       map_table.ColumnTypeString,
+	"set":        map_table.ColumnTypeString,
+	"json":       map_table.ColumnTypeString,
+	"binary":     map_table.ColumnTypeBytes,
+	"varbinary":  map_table.ColumnTypeBytes,
+	"tinyblob":   map_table.ColumnTypeBytes,
+	"blob":       map_table.ColumnTypeBytes,
+	"mediumblob": map_table.ColumnTypeBytes,
+	"longblob":   map_table.ColumnTypeBytes,
+	"date":       map_table.ColumnTypeTime,
+	"datetime":   map_table.ColumnTypeTime,
+	"timestamp":  map_table.ColumnTypeTime,
+	"time":       map_table.ColumnTypeTime,
+}
+
+func columnTypeFromSQL(sqlType string) (map_table.ColumnType, error) {
+	if columnType, ok := columnTypes[strings.ToLower(sqlType)]; ok {
+		return columnType, nil
+	}
+	return 0, fmt.Errorf("unsupported column type: %s", sqlType)
+}
+
+// literalValue converts a literal of the SQL text into the Go value it stands for.
+func literalValue(expr sqlparser.Expr) (any, error) {
+	switch value := expr.(type) {
+	case *sqlparser.NullVal:
+		return nil, nil
+	case sqlparser.BoolVal:
+		return bool(value), nil
+	case *sqlparser.UnaryExpr:
+		if literal, ok := value.Expr.(*sqlparser.Literal); ok && value.Operator == sqlparser.UMinusOp && isNumericLiteral(literal) {
+			return literalValue(&sqlparser.Literal{Type: literal.Type, Val: "-" + literal.Val})
+		}
+	case *sqlparser.Literal:
+		switch value.Type {
+		case sqlparser.StrVal:
+			return value.Val, nil
+		case sqlparser.IntVal:
+			if i, err := strconv.ParseInt(value.Val, 10, 64); err == nil {
+				return i, nil
+			}
+			if u, err := strconv.ParseUint(value.Val, 10, 64); err == nil {
+				return u, nil
+			}
+			return decimal.NewFromString(value.Val)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(value.Val, 64)
+		case sqlparser.DecimalVal:
+			return decimal.NewFromString(value.Val)
+		case sqlparser.HexVal:
+			return value.HexDecode()
+		case sqlparser.HexNum:
+			digits := strings.TrimPrefix(strings.ToLower(value.Val), "0x")
+			if len(digits)%2 == 1 {
+				digits = "0" + digits
+			}
+			return hex.DecodeString(digits)
+		case sqlparser.BitNum:
+			bits, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(value.Val), "0b"), 2)
+			if !ok {
+				return nil, fmt.Errorf("invalid bit literal: %s", value.Val)
+			}
+			return bits.Bytes(), nil
+		case sqlparser.DateVal, sqlparser.TimeVal, sqlparser.TimestampVal:
+			return utils.ParseSQLTime(value.Val)
+		}
+	}
+	return nil, fmt.Errorf("unsupported value expression: %s", sqlparser.String(expr))
+}
+
+// convertColumnValue converts a literal into the type stored by column and rejects literals the column cannot store.
+func convertColumnValue(column *map_table.ColumnDefinition, expr sqlparser.Expr) (any, error) {
+	value, err := literalValue(expr)
+	if err != nil {
+		return nil, fmt.Errorf("column '%s': %w", column.Name, err)
+	}
+	if value == nil {
+		if !column.Nullable {
+			return nil, fmt.Errorf("column '%s' cannot be null", column.Name)
+		}
+		return nil, nil
+	}
+	converted, ok := convertToColumnType(column.Type, value)
+	if !ok {
+		return nil, fmt.Errorf("incorrect %s value %s for column '%s'", column.SQLType, sqlparser.String(expr), column.Name)
+	}
+	return converted, nil
+}
+
+// computedColumnValue converts the result of an expression to the type of a column like convertColumnValue does for a literal.
+func computedColumnValue(column *map_table.ColumnDefinition, value any) (any, error) {
+	if value == nil {
+		if !column.Nullable {
+			return nil, fmt.Errorf("column '%s' cannot be null", column.Name)
+		}
+		return nil, nil
+	}
+	converted, ok := convertToColumnType(column.Type, value)
+	if !ok {
+		return nil, fmt.Errorf("incorrect %s value '%s' for column '%s'", column.SQLType, utils.FormatValue(value), column.Name)
+	}
+	return converted, nil
+}
+
+func convertToColumnType(columnType map_table.ColumnType, value any) (any, bool) {
+	switch columnType {
+	case map_table.ColumnTypeInt:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case bool:
+			if v {
+				return int64(1), true
+			}
+			return int64(0), true
+		case []byte:
+			if len(v) > 8 {
+				return nil, false
+			}
+			var i uint64
+			for _, b := range v {
+				i = i<<8 | uint64(b)
+			}
+			return int64(i), i <= math.MaxInt64
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return i, err == nil
+		}
+	case map_table.ColumnTypeFloat:
+		switch v := value.(type) {
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		case float64:
+			return v, true
+		case decimal.Decimal:
+			f, ok := v.Float64()
+			return f, ok
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return f, err == nil
+		}
+	case map_table.ColumnTypeDecimal:
+		switch v := value.(type) {
+		case int64:
+			return decimal.NewFromInt(v), true
+		case uint64:
+			return decimal.NewFromUint(v), true
+		case float64:
+			return decimal.NewFromFloat(v), true
+		case decimal.Decimal:
+			return v, true
+		case string:
+			d, err := decimal.NewFromString(strings.TrimSpace(v))
+			return d, err == nil
+		}
+	case map_table.ColumnTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case uint64:
+			return strconv.FormatUint(v, 10), true
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), true
+		case decimal.Decimal:
+			return v.String(), true
+		}
+	case map_table.ColumnTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case int64:
+			return v == 1, v == 0 || v == 1
+		case string:
+			b, err := strconv.ParseBool(v)
+			return b, err == nil
+		}
+	case map_table.ColumnTypeBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, true
+		case string:
+			return []byte(v), true
+		}
+	case map_table.ColumnTypeTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			t, err := utils.ParseSQLTime(v)
+			return t, err == nil
+		}
+	}
+	return nil, false
+}
+
+func isNumericLiteral(literal *sqlparser.Literal) bool {
+	switch literal.Type {
+	case sqlparser.IntVal, sqlparser.FloatVal, sqlparser.DecimalVal:
+		return true
+	}
+	return false
+}
@@ -1,154 +1,161 @@
 package data_query
 
 import (
-	"fmt"
-	"strconv"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 
-	"github.com/bytedance/sonic"
-	"github.com/davecgh/go-spew/spew"
 	"vitess.io/vitess/go/vt/sqlparser"
 )
 
+// BuildPredicateFromExpr compiles a WHERE condition for rows of any type, the columns are not checked against a schema.
+// A row is a map with string keys or a struct, whose exported fields are columns named by their json tag or else their name.
+// Field values are read as they are, integers as int64 and floats as float64, a nil pointer is NULL.
 func BuildPredicateFromExpr[T any](expr sqlparser.Expr) (func(T) bool, error) {
-	mapPredicate, err := buildMapPredicate(expr)
+	mapPredicate, err := buildRowPredicate(&expressionScope{}, expr)
 	if err != nil {
 		return nil, err
 	}
 
+	var readers sync.Map
 	return func(obj T) bool {
-		objMap, err := objectToMap(obj)
-		if err != nil {
-
+		if row, ok := any(obj).(map[string]any); ok {
+			return mapPredicate(row)
+		}
+		value := reflect.ValueOf(obj)
+		if !value.IsValid() {
 			return false
 		}
-		return mapPredicate(objMap)
+		reader, ok := readers.Load(value.Type())
+		if !ok {
+			reader, _ = readers.LoadOrStore(value.Type(), newRowReader(value.Type()))
+		}
+		row, ok := reader.(rowReader)(value)
+		return ok && mapPredicate(row)
 	}, nil
 }
 
-func buildMapPredicate(expr sqlparser.Expr) (func(map[string]interface{}) bool, error) {
-	switch expression := expr.(type) {
-	case *sqlparser.AndExpr:
-		left, err := buildMapPredicate(expression.Left)
-		if err != nil {
-			return nil, err
-		}
-		right, err := buildMapPredicate(expression.Right)
-		if err != nil {
-			return nil, err
-		}
-		return func(m map[string]interface{}) bool { return left(m) && right(m) }, nil
-
-	case *sqlparser.OrExpr:
-		left, err := buildMapPredicate(expression.Left)
-		if err != nil {
-			return nil, err
-		}
-		right, err := buildMapPredicate(expression.Right)
-		if err != nil {
-			return nil, err
-		}
-		return func(m map[string]interface{}) bool { return left(m) || right(m) }, nil
-
-	case *sqlparser.ComparisonExpr:
-		return buildComparisonPredicate(expression)
-
-	default:
-		return nil, fmt.Errorf("unsupported WHERE expression type: %T", expr)
+// buildRowPredicate compiles a WHERE condition, a row matches when the condition is true.
+// NULL does not match, neither does a row the condition cannot be evaluated on, e.g. arithmetic on a text that is no number.
+func buildRowPredicate(scope *expressionScope, expr sqlparser.Expr) (func(map[string]any) bool, error) {
+	evaluator, err := buildValueEvaluator(scope, expr)
+	if err != nil {
+		return nil, err
 	}
+	return func(row map[string]any) bool {
+		value, err := evaluator(row)
+		return err == nil && isTrue(value)
+	}, nil
 }
 
-func buildComparisonPredicate(expr *sqlparser.ComparisonExpr) (func(map[string]interface{}) bool, error) {
-	col, ok := expr.Left.(*sqlparser.ColName)
-	if !ok {
-		return nil, fmt.Errorf("left side of comparison must be a column name, got %T", expr.Left)
-	}
-	fieldName := col.Name.String()
+// rowReader reads the columns of a row of one type into a map, false when the value is no row.
+type rowReader func(value reflect.Value) (map[string]any, bool)
 
-	lit, ok := expr.Right.(*sqlparser.Literal)
-	if !ok {
-		return nil, fmt.Errorf("right side of comparison must be a literal value, got %T", expr.Right)
-	}
-
-	return func(objMap map[string]interface{}) bool {
-		fieldValue, ok := objMap[fieldName]
-		if !ok {
-			return false
-		}
-		return compare(fieldValue, lit, expr.Operator)
-	}, nil
+// structField is a column of a struct row, index is the path of the field through embedded structs.
+type structField struct {
+	name  string
+	index []int
 }
 
-func compare(fieldValue interface{}, literal *sqlparser.Literal, op sqlparser.ComparisonExprOperator) bool {
-	stringFieldValue := spew.Sprintf("%v", fieldValue)
-	if f64Val, err := strconv.ParseFloat(stringFieldValue, 64); err == nil {
-		litStr := sqlparser.String(literal)
-		litVal, err := strconv.ParseFloat(litStr, 64)
-		if err != nil {
-			return false
+// newRowReader builds the reader of rowType once, so evaluating a row does not look at its type again.
+func newRowReader(rowType reflect.Type) rowReader {
+	switch rowType.Kind() {
+	case reflect.Pointer:
+		element := newRowReader(rowType.Elem())
+		return func(value reflect.Value) (map[string]any, bool) {
+			if value.IsNil() {
+				return nil, false
+			}
+			return element(value.Elem())
 		}
-		switch op {
-		case sqlparser.EqualOp:
-			return f64Val == litVal
-		case sqlparser.NotEqualOp:
-			return f64Val != litVal
-		case sqlparser.LessThanOp:
-			return f64Val < litVal
-		case sqlparser.LessEqualOp:
-			return f64Val <= litVal
-		case sqlparser.GreaterThanOp:
-			return f64Val > litVal
-		case sqlparser.GreaterEqualOp:
-			return f64Val >= litVal
-		default:
-			panic("unhandled default case")
-		}
-	} else if booleanVal, err := strconv.ParseBool(stringFieldValue); err == nil {
-		litStr := sqlparser.String(literal)
-		value, err := strconv.ParseBool(litStr)
-		if err != nil {
-			return false
+	case reflect.Map:
+		if rowType.Key().Kind() != reflect.String {
+			break
 		}
-		switch op {
-		case sqlparser.EqualOp:
-			return booleanVal == value
-		case sqlparser.NotEqualOp:
-			return booleanVal != value
-		default:
-			panic("unhandled default case")
-		}
-	} else if strVal, ok := fieldValue.(string); ok {
-		litStr := sqlparser.String(literal)
-		switch op {
-		case sqlparser.EqualOp:
-			return strVal == litStr
-		case sqlparser.NotEqualOp:
-			return strVal != litStr
-		case sqlparser.LessThanOp:
-			return strVal < litStr
-		case sqlparser.LessEqualOp:
-			return strVal <= litStr
-		case sqlparser.GreaterThanOp:
-			return strVal > litStr
-		case sqlparser.GreaterEqualOp:
-			return strVal >= litStr
-		default:
-			panic("unhandled default case")
+		return func(value reflect.Value) (map[string]any, bool) {
+			row := make(map[string]any, value.Len())
+			entries := value.MapRange()
+			for entries.Next() {
+				row[entries.Key().String()] = rowValue(entries.Value())
+			}
+			return row, true
 		}
+	case reflect.Struct:
+		fields := structFields(rowType, nil)
+		return func(value reflect.Value) (map[string]any, bool) {
+			row := make(map[string]any, len(fields))
+			for _, field := range fields {
+				row[field.name] = rowValue(value.FieldByIndex(field.index))
+			}
+			return row, true
+		}
+	}
+	return func(reflect.Value) (map[string]any, bool) {
+		return nil, false
 	}
-	return false
 }
 
-func objectToMap(obj any) (map[string]interface{}, error) {
-	jsonValue, err := sonic.Marshal(obj)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal data to JSON: %w", err)
+// structFields lists the columns of a struct, the fields of an embedded struct without a json name are its own.
+func structFields(structType reflect.Type, index []int) []structField {
+	var fields []structField
+	for _, field := range reflect.VisibleFields(structType) {
+		if len(field.Index) > 1 {
+			// reached through the embedded struct below
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), field.Index...)
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(field.Type, fieldIndex)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, structField{name: name, index: fieldIndex})
 	}
+	return fields
+}
 
-	var objectStructureMap map[string]interface{}
-	err = sonic.Unmarshal(jsonValue, &objectStructureMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON to map: %w", err)
+// rowValue converts a field into the value a stored row would hold.
+func rowValue(value reflect.Value) any {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return rowValue(value.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := value.Uint()
+		if u > math.MaxInt64 {
+			return u
+		}
+		return int64(u)
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Bytes()
+		}
 	}
-
-	return objectStructureMap, nil
+	return value.Interface()
 }
@@ -0,0 +1,127 @@
+package map_table
+
+import (
+	"slices"
+)
+
+// BatchRows is the most rows a Batch holds, the rows of one segment of the column store.
+const BatchRows = segmentRows
+
+// ChunkKind tells which slice of a Chunk holds its values.
+type ChunkKind int
+
+const (
+	ChunkAny ChunkKind = iota
+	ChunkInt
+	ChunkFloat
+	ChunkString
+	ChunkBool
+)
+
+// Chunk holds the values of one column for the rows of a Batch in the slice of its kind, Values for ChunkAny.
+// Present is false where a row lacks the column and Null is true where it holds NULL, the typed slice holds the zero value there.
+// A dictionary encoded string column also comes with the codes of the strings, Strings[i] is Dictionary[Codes[i]].
+type Chunk struct {
+	Kind       ChunkKind
+	Ints       []int64
+	Floats     []float64
+	Strings    []string
+	Bools      []bool
+	Values     []any
+	Codes      []uint8
+	Dictionary []string
+	Present    []bool
+	Null       []bool
+}
+
+func newChunk(size int) *Chunk {
+	return &Chunk{Present: make([]bool, size), Null: make([]bool, size)}
+}
+
+func setChunkValues[T int64 | float64 | string | bool](chunk *Chunk, values []T) {
+	switch typed := any(values).(type) {
+	case []int64:
+		chunk.Kind, chunk.Ints = ChunkInt, typed
+	case []float64:
+		chunk.Kind, chunk.Floats = ChunkFloat, typed
+	case []string:
+		chunk.Kind, chunk.Strings = ChunkString, typed
+	case []bool:
+		chunk.Kind, chunk.Bools = ChunkBool, typed
+	}
+}
+
+// Value returns the value of the row at position, false when the row lacks the column.
+func (chunk *Chunk) Value(position int) (any, bool) {
+	if !chunk.Present[position] {
+		return nil, false
+	}
+	if chunk.Null[position] {
+		return nil, true
+	}
+	switch chunk.Kind {
+	case ChunkInt:
+		return chunk.Ints[position], true
+	case ChunkFloat:
+		return chunk.Floats[position], true
+	case ChunkString:
+		return chunk.Strings[position], true
+	case ChunkBool:
+		return chunk.Bools[position], true
+	default:
+		return chunk.Values[position], true
+	}
+}
+
+// Batch holds consecutive rows of a table column by column, position i of every chunk belongs to the row with the row ID IDs[i].
+type Batch struct {
+	IDs    []int
+	chunks map[string]*Chunk
+	// selection lists the positions of the live rows, expiring marks the rows that may have expired since they were stored
+	selection []int
+	expiring  []bool
+}
+
+// Len returns the number of positions of the batch, rows that expired included.
+func (batch *Batch) Len() int {
+	return len(batch.IDs)
+}
+
+// Selection returns the positions of the live rows in ascending order, a new slice the caller may change.
+func (batch *Batch) Selection() []int {
+	return slices.Clone(batch.selection)
+}
+
+// Column returns the chunk of column, nil when no row of the batch has the column or it was not read.
+func (batch *Batch) Column(column string) *Chunk {
+	return batch.chunks[column]
+}
+
+// Row builds the row at position from the chunks read, a new map the caller may change.
+func (batch *Batch) Row(position int) map[string]any {
+	row := make(map[string]any, len(batch.chunks))
+	for column, chunk := range batch.chunks {
+		if value, ok := chunk.Value(position); ok {
+			row[column] = value
+		}
+	}
+	return row
+}
+
+// ScanBatches hands the rows of the table to consumer a Batch at a time in ascending row ID order, until it returns false.
+// Only the chunks of columns are read, every column when columns is nil. A batch holds a copy of the rows taken under
+// the lock of the column store, consumer runs without the lock and may change the table.
+func (tdm *DataTable) ScanBatches(columns []string, consumer func(batch *Batch) bool) {
+	tdm.columns.scan(columns, func(batch *Batch) bool {
+		if slices.Contains(batch.expiring, true) {
+			batch.selection = slices.DeleteFunc(batch.selection, func(position int) bool {
+				if !batch.expiring[position] {
+					return false
+				}
+				_, live := tdm.liveRows.Expiration(batch.IDs[position])
+				return !live
+			})
+		}
+		return len(batch.selection) == 0 || consumer(batch)
+	})
+}
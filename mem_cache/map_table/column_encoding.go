@@ -0,0 +1,303 @@
+package map_table
+
+import (
+	"sort"
+)
+
+const (
+	// maxDictionarySize bounds the distinct strings a segment keeps in the dictionary of a column, so a code takes at most 8 bits.
+	// A column with more falls back to a plain vector in that segment.
+	maxDictionarySize = 256
+	// maxRuns bounds the runs a full segment stores a column in, a column changing value more often stays as it is
+	maxRuns = segmentRows / 16
+)
+
+// packedCodes holds a code of width bits per slot. width grows 0, 1, 2, 4, 8 with the largest code,
+// a column holding one value takes no bits at all.
+type packedCodes struct {
+	width int
+	words []uint64
+}
+
+func (codes *packedCodes) get(slot int) int {
+	if codes.width == 0 {
+		return 0
+	}
+	perWord := 64 / codes.width
+	return int(codes.words[slot/perWord]>>(slot%perWord*codes.width)) & (1<<codes.width - 1)
+}
+
+func (codes *packedCodes) set(slot, code int) {
+	for code >= 1<<codes.width {
+		codes.grow()
+	}
+	if codes.width == 0 {
+		return
+	}
+	perWord := 64 / codes.width
+	shift := slot % perWord * codes.width
+	word := &codes.words[slot/perWord]
+	*word = *word&^(uint64(1<<codes.width-1)<<shift) | uint64(code)<<shift
+}
+
+func (codes *packedCodes) grow() {
+	grown := packedCodes{width: max(codes.width*2, 1)}
+	grown.words = make([]uint64, segmentRows*grown.width/64)
+	if codes.width > 0 {
+		for slot := 0; slot < segmentRows; slot++ {
+			grown.set(slot, codes.get(slot))
+		}
+	}
+	*codes = grown
+}
+
+// dictionaryVector stores the strings of a column as codes into a dictionary of the distinct strings of the segment,
+// so a value repeated by many rows is kept once.
+type dictionaryVector struct {
+	dictionary []string
+	codes      map[string]int
+	packed     packedCodes
+	present    bitmap
+	nulls      bitmap
+}
+
+func (vector *dictionaryVector) get(slot int) (any, bool) {
+	if !vector.present.get(slot) {
+		return nil, false
+	}
+	if vector.nulls.get(slot) {
+		return nil, true
+	}
+	return vector.dictionary[vector.packed.get(slot)], true
+}
+
+func (vector *dictionaryVector) set(slot int, value any) bool {
+	if value == nil {
+		vector.nulls.set(slot)
+		vector.present.set(slot)
+		return true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	code, ok := vector.codes[s]
+	if !ok {
+		if len(vector.dictionary) == maxDictionarySize {
+			return false
+		}
+		code = len(vector.dictionary)
+		vector.dictionary = append(vector.dictionary, s)
+		vector.codes[s] = code
+	}
+	vector.packed.set(slot, code)
+	vector.nulls.clear(slot)
+	vector.present.set(slot)
+	return true
+}
+
+// remove keeps the string in the dictionary, it goes with the segment.
+func (vector *dictionaryVector) remove(slot int) {
+	vector.present.clear(slot)
+	vector.nulls.clear(slot)
+}
+
+func (vector *dictionaryVector) match(key any, matches *bitmap) {
+	s, ok := key.(string)
+	if !ok {
+		return
+	}
+	code, ok := vector.codes[s]
+	if !ok {
+		return
+	}
+	for slot := 0; slot < segmentRows; slot++ {
+		if vector.present.get(slot) && !vector.nulls.get(slot) && vector.packed.get(slot) == code {
+			matches.set(slot)
+		}
+	}
+}
+
+func (vector *dictionaryVector) extract(slots []int) *Chunk {
+	chunk := newChunk(len(slots))
+	chunk.Kind = ChunkString
+	chunk.Strings = make([]string, len(slots))
+	chunk.Codes = make([]uint8, len(slots))
+	// the dictionary only grows, the chunk keeps the part its codes refer to
+	chunk.Dictionary = vector.dictionary[:len(vector.dictionary):len(vector.dictionary)]
+	for position, slot := range slots {
+		if !vector.present.get(slot) {
+			continue
+		}
+		chunk.Present[position] = true
+		if vector.nulls.get(slot) {
+			chunk.Null[position] = true
+			continue
+		}
+		code := vector.packed.get(slot)
+		chunk.Codes[position] = uint8(code)
+		chunk.Strings[position] = vector.dictionary[code]
+	}
+	return chunk
+}
+
+// runVector stores the column of a full segment as runs of equal values, which suits sorted and low-cardinality columns.
+// starts holds the first slot of each run after the first one, the slots without a value or with NULL join any run.
+type runVector[T int64 | float64 | string | bool] struct {
+	starts  []uint16
+	values  []T
+	present bitmap
+	nulls   bitmap
+}
+
+func (vector *runVector[T]) run(slot int) int {
+	return sort.Search(len(vector.starts), func(i int) bool {
+		return int(vector.starts[i]) > slot
+	})
+}
+
+func (vector *runVector[T]) get(slot int) (any, bool) {
+	if !vector.present.get(slot) {
+		return nil, false
+	}
+	if vector.nulls.get(slot) {
+		return nil, true
+	}
+	return vector.values[vector.run(slot)], true
+}
+
+// set only takes NULL or the value of the run of slot, a run is not split in place.
+func (vector *runVector[T]) set(slot int, value any) bool {
+	if value == nil {
+		vector.nulls.set(slot)
+		vector.present.set(slot)
+		return true
+	}
+	typed, ok := value.(T)
+	if !ok || vector.values[vector.run(slot)] != typed {
+		return false
+	}
+	vector.nulls.clear(slot)
+	vector.present.set(slot)
+	return true
+}
+
+func (vector *runVector[T]) remove(slot int) {
+	vector.present.clear(slot)
+	vector.nulls.clear(slot)
+}
+
+func (vector *runVector[T]) match(key any, matches *bitmap) {
+	typed, ok := vectorKey[T](key)
+	if !ok {
+		return
+	}
+	start := 0
+	for run, value := range vector.values {
+		end := segmentRows
+		if run < len(vector.starts) {
+			end = int(vector.starts[run])
+		}
+		if value == typed {
+			for slot := start; slot < end; slot++ {
+				if vector.present.get(slot) && !vector.nulls.get(slot) {
+					matches.set(slot)
+				}
+			}
+		}
+		start = end
+	}
+}
+
+// extract walks the runs along slots, which are in ascending order.
+func (vector *runVector[T]) extract(slots []int) *Chunk {
+	chunk := newChunk(len(slots))
+	values := make([]T, len(slots))
+	run := 0
+	for position, slot := range slots {
+		for run < len(vector.starts) && int(vector.starts[run]) <= slot {
+			run++
+		}
+		if !vector.present.get(slot) {
+			continue
+		}
+		chunk.Present[position] = true
+		if vector.nulls.get(slot) {
+			chunk.Null[position] = true
+			continue
+		}
+		values[position] = vector.values[run]
+	}
+	setChunkValues(chunk, values)
+	return chunk
+}
+
+// encodeRuns stores vector as runs, false when it holds more than maxRuns of them.
+func encodeRuns[T int64 | float64 | string | bool](vector columnVector) (*runVector[T], bool) {
+	runs := &runVector[T]{}
+	for slot := 0; slot < segmentRows; slot++ {
+		value, ok := vector.get(slot)
+		if !ok {
+			continue
+		}
+		runs.present.set(slot)
+		if value == nil {
+			runs.nulls.set(slot)
+			continue
+		}
+		typed := value.(T)
+		if count := len(runs.values); count == 0 || runs.values[count-1] != typed {
+			if count == maxRuns {
+				return nil, false
+			}
+			if count > 0 {
+				runs.starts = append(runs.starts, uint16(slot))
+			}
+			runs.values = append(runs.values, typed)
+		}
+	}
+	if len(runs.values) == 0 {
+		var zero T
+		runs.values = append(runs.values, zero)
+	}
+	return runs, true
+}
+
+// seal encodes the columns of a segment whose slots were all written as runs where that pays off.
+func (current *segment) seal() {
+	for column, vector := range current.columns {
+		var sealed columnVector
+		var ok bool
+		switch vector.(type) {
+		case *typedVector[int64]:
+			sealed, ok = encodeRuns[int64](vector)
+		case *typedVector[float64]:
+			sealed, ok = encodeRuns[float64](vector)
+		case *typedVector[bool]:
+			sealed, ok = encodeRuns[bool](vector)
+		case *typedVector[string], *dictionaryVector:
+			sealed, ok = encodeRuns[string](vector)
+		}
+		if ok {
+			current.columns[column] = sealed
+		}
+	}
+}
+
+// reencode copies vector into a plain vector that can also hold value, an untyped one when value is of another type.
+func reencode(vector columnVector, value any) columnVector {
+	if plain, ok := copyVector(newPlainVector(kindOf(value)), vector); ok {
+		return plain
+	}
+	widened, _ := copyVector(&anyVector{}, vector)
+	return widened
+}
+
+func copyVector(to, from columnVector) (columnVector, bool) {
+	for slot := 0; slot < segmentRows; slot++ {
+		if value, ok := from.get(slot); ok && !to.set(slot, value) {
+			return nil, false
+		}
+	}
+	return to, true
+}
@@ -0,0 +1,487 @@
+package map_table
+
+import (
+	"a-eighty/utils"
+	"math/bits"
+	"reflect"
+	"sync"
+)
+
+// segmentRows is how many consecutive row IDs a segment of the column store holds.
+const segmentRows = 1024
+
+// bitmap holds a bit per row of a segment.
+type bitmap [segmentRows / 64]uint64
+
+func (b *bitmap) get(slot int) bool {
+	return b[slot/64]&(1<<(slot%64)) != 0
+}
+
+func (b *bitmap) set(slot int) {
+	b[slot/64] |= 1 << (slot % 64)
+}
+
+func (b *bitmap) clear(slot int) {
+	b[slot/64] &^= 1 << (slot % 64)
+}
+
+func (b *bitmap) count() int {
+	count := 0
+	for _, word := range b {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// columnVector holds the values of one column for the rows of a segment. A row may lack the column, which is not the same
+// as holding NULL in it: the rows of a schemaless table only have the columns they were written with.
+type columnVector interface {
+	get(slot int) (value any, present bool)
+	// set returns false when value does not fit the type of the vector
+	set(slot int, value any) bool
+	remove(slot int)
+	// match sets the slots holding a value whose utils.ValueKey is key in matches
+	match(key any, matches *bitmap)
+	// extract copies the values of slots to a chunk
+	extract(slots []int) *Chunk
+}
+
+type vectorKind int
+
+const (
+	vectorAny vectorKind = iota
+	vectorInt
+	vectorFloat
+	vectorString
+	vectorBool
+)
+
+func kindOf(value any) vectorKind {
+	switch value.(type) {
+	case int64:
+		return vectorInt
+	case float64:
+		return vectorFloat
+	case string:
+		return vectorString
+	case bool:
+		return vectorBool
+	default:
+		return vectorAny
+	}
+}
+
+// newVector returns the vector a segment starts a column of kind with, strings are dictionary encoded.
+func newVector(kind vectorKind) columnVector {
+	if kind == vectorString {
+		return &dictionaryVector{codes: make(map[string]int)}
+	}
+	return newPlainVector(kind)
+}
+
+func newPlainVector(kind vectorKind) columnVector {
+	switch kind {
+	case vectorInt:
+		return &typedVector[int64]{}
+	case vectorFloat:
+		return &typedVector[float64]{}
+	case vectorString:
+		return &typedVector[string]{}
+	case vectorBool:
+		return &typedVector[bool]{}
+	default:
+		return &anyVector{}
+	}
+}
+
+// typedVector stores values of one Go type unboxed, NULL is a bit of nulls.
+type typedVector[T int64 | float64 | string | bool] struct {
+	values  [segmentRows]T
+	present bitmap
+	nulls   bitmap
+}
+
+func (vector *typedVector[T]) get(slot int) (any, bool) {
+	if !vector.present.get(slot) {
+		return nil, false
+	}
+	if vector.nulls.get(slot) {
+		return nil, true
+	}
+	return vector.values[slot], true
+}
+
+func (vector *typedVector[T]) set(slot int, value any) bool {
+	var typed T
+	if value != nil {
+		var ok bool
+		if typed, ok = value.(T); !ok {
+			return false
+		}
+		vector.nulls.clear(slot)
+	} else {
+		vector.nulls.set(slot)
+	}
+	vector.values[slot] = typed
+	vector.present.set(slot)
+	return true
+}
+
+func (vector *typedVector[T]) remove(slot int) {
+	var zero T
+	vector.values[slot] = zero
+	vector.present.clear(slot)
+	vector.nulls.clear(slot)
+}
+
+func (vector *typedVector[T]) match(key any, matches *bitmap) {
+	typed, ok := vectorKey[T](key)
+	if !ok {
+		return
+	}
+	for slot := 0; slot < segmentRows; slot++ {
+		if vector.present.get(slot) && !vector.nulls.get(slot) && vector.values[slot] == typed {
+			matches.set(slot)
+		}
+	}
+}
+
+func (vector *typedVector[T]) extract(slots []int) *Chunk {
+	chunk := newChunk(len(slots))
+	values := make([]T, len(slots))
+	for position, slot := range slots {
+		if !vector.present.get(slot) {
+			continue
+		}
+		chunk.Present[position] = true
+		if vector.nulls.get(slot) {
+			chunk.Null[position] = true
+			continue
+		}
+		values[position] = vector.values[slot]
+	}
+	setChunkValues(chunk, values)
+	return chunk
+}
+
+// vectorKey converts a utils.ValueKey to the type of a typed vector, the key of an integral float is an int64.
+func vectorKey[T int64 | float64 | string | bool](key any) (T, bool) {
+	var typed T
+	if i, ok := key.(int64); ok {
+		if f, ok := any(&typed).(*float64); ok {
+			*f = float64(i)
+			return typed, true
+		}
+	}
+	typed, ok := key.(T)
+	return typed, ok
+}
+
+// anyVector stores the values no typed vector fits, like decimals, times and bytes, or a column mixing types.
+type anyVector struct {
+	values  [segmentRows]any
+	present bitmap
+}
+
+func (vector *anyVector) get(slot int) (any, bool) {
+	return vector.values[slot], vector.present.get(slot)
+}
+
+func (vector *anyVector) set(slot int, value any) bool {
+	vector.values[slot] = value
+	vector.present.set(slot)
+	return true
+}
+
+func (vector *anyVector) remove(slot int) {
+	vector.values[slot] = nil
+	vector.present.clear(slot)
+}
+
+func (vector *anyVector) match(key any, matches *bitmap) {
+	for slot := 0; slot < segmentRows; slot++ {
+		if !vector.present.get(slot) || vector.values[slot] == nil {
+			continue
+		}
+		stored := utils.ValueKey(vector.values[slot])
+		if reflect.TypeOf(stored).Comparable() && stored == key {
+			matches.set(slot)
+		}
+	}
+}
+
+func (vector *anyVector) extract(slots []int) *Chunk {
+	chunk := newChunk(len(slots))
+	chunk.Values = make([]any, len(slots))
+	for position, slot := range slots {
+		if vector.present.get(slot) {
+			chunk.Present[position] = true
+			chunk.Null[position] = vector.values[slot] == nil
+			chunk.Values[position] = vector.values[slot]
+		}
+	}
+	return chunk
+}
+
+// segment holds the rows of segmentRows consecutive row IDs column by column. tombstones marks the slots without a row,
+// both the deleted ones and the ones not written yet.
+type segment struct {
+	tombstones bitmap
+	// expiring marks the rows given an expiration at some point, only they have to be checked against liveRows by a scan
+	expiring bitmap
+	columns  map[string]columnVector
+	// written counts the slots ever written or skipped, a segment whose slots were all written and then deleted is dropped
+	written int
+}
+
+func newSegment() *segment {
+	current := &segment{columns: make(map[string]columnVector)}
+	for i := range current.tombstones {
+		current.tombstones[i] = ^uint64(0)
+	}
+	return current
+}
+
+// columnStore keeps the rows of a table in segments of typed column vectors, addressed by row IDs that are never reused.
+type columnStore struct {
+	mu       sync.RWMutex
+	segments []*segment
+	// kinds remembers the vector kind of each column, so a segment starting with NULL in a column still gets a typed vector
+	kinds map[string]vectorKind
+	// lastID is the ID of the latest row, it is taken under mu so an ID is never below floor
+	lastID int
+	// floor is the lowest ID a row can still be written under, the slots below it count as written in a new segment
+	floor int
+}
+
+func newColumnStore() *columnStore {
+	return &columnStore{kinds: make(map[string]vectorKind), floor: 1}
+}
+
+func locate(id int) (segmentIndex, slot int) {
+	return id / segmentRows, id % segmentRows
+}
+
+// insert stores row under a new row ID and returns the ID, IDs start at 1. expiring tells whether the row has an expiration.
+func (store *columnStore) insert(row map[string]any, expiring bool) int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.lastID++
+	id := store.lastID
+	segmentIndex, slot := locate(id)
+	for len(store.segments) <= segmentIndex {
+		store.segments = append(store.segments, nil)
+	}
+	current := store.segments[segmentIndex]
+	if current == nil {
+		current = newSegment()
+		current.written = min(max(store.floor-segmentIndex*segmentRows, 0), segmentRows)
+		store.segments[segmentIndex] = current
+	}
+	current.written++
+	current.tombstones.clear(slot)
+	if expiring {
+		current.expiring.set(slot)
+	}
+	store.write(current, slot, row)
+	if current.written == segmentRows {
+		current.seal()
+	}
+	return id
+}
+
+// update replaces the row stored under id, it returns false when there is none.
+func (store *columnStore) update(id int, row map[string]any) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	current, slot := store.live(id)
+	if current == nil {
+		return false
+	}
+	for _, vector := range current.columns {
+		vector.remove(slot)
+	}
+	store.write(current, slot, row)
+	return true
+}
+
+func (store *columnStore) write(current *segment, slot int, row map[string]any) {
+	for column, value := range row {
+		vector, ok := current.columns[column]
+		if !ok {
+			kind, known := store.kinds[column]
+			if !known && value != nil {
+				kind = kindOf(value)
+				store.kinds[column] = kind
+			}
+			vector = newVector(kind)
+			current.columns[column] = vector
+		}
+		if !vector.set(slot, value) {
+			vector = reencode(vector, value)
+			vector.set(slot, value)
+			current.columns[column] = vector
+			if _, ok := vector.(*anyVector); ok {
+				// a value of another type turns the column into an untyped one from this segment on
+				store.kinds[column] = vectorAny
+			}
+		}
+	}
+}
+
+// live returns the segment and slot of the row stored under id, a nil segment when there is none. The caller holds mu.
+func (store *columnStore) live(id int) (*segment, int) {
+	segmentIndex, slot := locate(id)
+	if id <= 0 || segmentIndex >= len(store.segments) {
+		return nil, 0
+	}
+	current := store.segments[segmentIndex]
+	if current == nil || current.tombstones.get(slot) {
+		return nil, 0
+	}
+	return current, slot
+}
+
+// row returns the row stored under id as a new map.
+func (store *columnStore) row(id int) (map[string]any, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	current, slot := store.live(id)
+	if current == nil {
+		return nil, false
+	}
+	return current.row(slot), true
+}
+
+func (current *segment) row(slot int) map[string]any {
+	row := make(map[string]any, len(current.columns))
+	for column, vector := range current.columns {
+		if value, ok := vector.get(slot); ok {
+			row[column] = value
+		}
+	}
+	return row
+}
+
+// delete marks the row stored under id deleted and returns it, only one of several callers deleting the same row gets it.
+func (store *columnStore) delete(id int) (map[string]any, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	current, slot := store.live(id)
+	if current == nil {
+		return nil, false
+	}
+	row := current.row(slot)
+	for _, vector := range current.columns {
+		vector.remove(slot)
+	}
+	current.tombstones.set(slot)
+	current.expiring.clear(slot)
+	if current.written >= segmentRows && current.tombstones.count() == segmentRows {
+		store.segments[id/segmentRows] = nil
+	}
+	return row, true
+}
+
+// markExpiring notes that the row stored under id got an expiration.
+func (store *columnStore) markExpiring(id int) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if current, slot := store.live(id); current != nil {
+		current.expiring.set(slot)
+	}
+}
+
+// scan hands the rows of one segment at a time to consumer as a batch of the chunks of columns, of every column when columns is nil.
+// Every stored row is selected, the ones marked expiring are marked in the batch too.
+func (store *columnStore) scan(columns []string, consumer func(batch *Batch) bool) {
+	for segmentIndex := 0; ; segmentIndex++ {
+		batch, ok := store.batch(segmentIndex, columns)
+		if !ok {
+			return
+		}
+		if batch != nil && !consumer(batch) {
+			return
+		}
+	}
+}
+
+// batch copies the rows of a segment, false when there is no segment at segmentIndex or later.
+func (store *columnStore) batch(segmentIndex int, columns []string) (*Batch, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if segmentIndex >= len(store.segments) {
+		return nil, false
+	}
+	current := store.segments[segmentIndex]
+	if current == nil {
+		return nil, true
+	}
+	slots := make([]int, 0, segmentRows)
+	for slot := 0; slot < segmentRows; slot++ {
+		if !current.tombstones.get(slot) {
+			slots = append(slots, slot)
+		}
+	}
+	if len(slots) == 0 {
+		return nil, true
+	}
+	batch := &Batch{
+		IDs:       make([]int, len(slots)),
+		chunks:    make(map[string]*Chunk),
+		selection: make([]int, len(slots)),
+		expiring:  make([]bool, len(slots)),
+	}
+	for position, slot := range slots {
+		batch.IDs[position] = segmentIndex*segmentRows + slot
+		batch.selection[position] = position
+		batch.expiring[position] = current.expiring.get(slot)
+	}
+	if columns == nil {
+		for column, vector := range current.columns {
+			batch.chunks[column] = vector.extract(slots)
+		}
+		return batch, true
+	}
+	for _, column := range columns {
+		if vector, ok := current.columns[column]; ok {
+			batch.chunks[column] = vector.extract(slots)
+		}
+	}
+	return batch, true
+}
+
+// matching returns the IDs of the rows holding a value whose utils.ValueKey is key in column, in ascending order.
+// It compares the encoded values of each segment, e.g. the dictionary code of key against the codes of the rows.
+func (store *columnStore) matching(column string, key any) []int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var ids []int
+	for segmentIndex, current := range store.segments {
+		if current == nil {
+			continue
+		}
+		vector, ok := current.columns[column]
+		if !ok {
+			continue
+		}
+		var matches bitmap
+		vector.match(key, &matches)
+		for i, word := range matches {
+			for word != 0 {
+				slot := i*64 + bits.TrailingZeros64(word)
+				ids = append(ids, segmentIndex*segmentRows+slot)
+				word &= word - 1
+			}
+		}
+	}
+	return ids
+}
+
+// clear drops every row, IDs handed out later still never repeat the ones handed out before.
+func (store *columnStore) clear() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.segments = nil
+	store.floor = store.lastID + 1
+}
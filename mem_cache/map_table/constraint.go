@@ -0,0 +1,402 @@
+package map_table
+
+import (
+	"a-eighty/utils"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PrimaryKeyName is the name of the index holding the PRIMARY KEY of a table, like in MySQL.
+const PrimaryKeyName = "PRIMARY"
+
+var ErrDuplicateEntry = errors.New("duplicate entry")
+
+// duplicateEntry reports the values row holds in a unique index the way MySQL does, e.g. duplicate entry '1-a' for key 'PRIMARY'.
+func duplicateEntry(index *tableIndex, row map[string]any) error {
+	values := index.values(row)
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = utils.FormatValue(value)
+	}
+	return fmt.Errorf("%w '%s' for key '%s'", ErrDuplicateEntry, strings.Join(formatted, "-"), index.definition.Name)
+}
+
+func hasNull(values []any) bool {
+	for _, value := range values {
+		if value == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictingRows returns the indexes of the stored rows other than the replaced ones holding the values row has in a unique index.
+func (tdm *DataTable) conflictingRows(index *tableIndex, row map[string]any, replaced map[int]struct{}) []int {
+	var conflicting []int
+	for _, rowIndex := range index.lookup(index.values(row)) {
+		if _, ok := replaced[rowIndex]; ok {
+			continue
+		}
+		// the entry of an expired row stays in the index, and the entry of a row being updated may still hold its old values
+		if stored, ok := tdm.row(rowIndex); ok && !index.changed(stored, row) {
+			conflicting = append(conflicting, rowIndex)
+		}
+	}
+	return conflicting
+}
+
+// checkUnique makes sure rows can be written without two rows sharing the values of a unique index, neither with a stored row
+// nor with each other. replaced are the indexes of the stored rows that rows replace, their values no longer count.
+// A row with NULL in a column of the index never conflicts, like in MySQL.
+func (tdm *DataTable) checkUnique(rows []map[string]any, replaced map[int]struct{}) error {
+	for _, index := range tdm.indexes.Load().created {
+		if !index.definition.Unique || !index.ready.Load() {
+			continue
+		}
+		var seen map[any]struct{}
+		if len(rows) > 1 {
+			seen = make(map[any]struct{}, len(rows))
+		}
+		for _, row := range rows {
+			values := index.values(row)
+			if hasNull(values) {
+				continue
+			}
+			if seen != nil {
+				key := hashKey(values)
+				if _, ok := seen[key]; ok {
+					return duplicateEntry(index, row)
+				}
+				seen[key] = struct{}{}
+			}
+			if len(tdm.conflictingRows(index, row, replaced)) > 0 {
+				return duplicateEntry(index, row)
+			}
+		}
+	}
+	return nil
+}
+
+// DuplicateRowIndexes returns the indexes of the stored rows holding the values row has in a PRIMARY KEY or UNIQUE index,
+// ordered like the indexes of the table with the primary key first, each index once.
+func (tdm *DataTable) DuplicateRowIndexes(row map[string]any) []int {
+	var duplicates []int
+	for _, index := range tdm.indexes.Load().uniqueIndexes() {
+		if hasNull(index.values(row)) {
+			continue
+		}
+		conflicting := tdm.conflictingRows(index, row, nil)
+		slices.Sort(conflicting)
+		for _, rowIndex := range conflicting {
+			if !slices.Contains(duplicates, rowIndex) {
+				duplicates = append(duplicates, rowIndex)
+			}
+		}
+	}
+	return duplicates
+}
+
+// uniqueIndexes returns the PRIMARY KEY and UNIQUE indexes holding every row, the primary key first.
+func (set *indexSet) uniqueIndexes() []*tableIndex {
+	uniqueIndexes := make([]*tableIndex, 0, len(set.created))
+	if primaryKey := set.primaryKey(); primaryKey != nil && primaryKey.ready.Load() {
+		uniqueIndexes = append(uniqueIndexes, primaryKey)
+	}
+	for _, index := range set.created {
+		if index.definition.Unique && !index.definition.Primary && index.ready.Load() {
+			uniqueIndexes = append(uniqueIndexes, index)
+		}
+	}
+	return uniqueIndexes
+}
+
+// Replace inserts a row after deleting the stored rows it shares the values of a PRIMARY KEY or UNIQUE index with, like REPLACE
+// of MySQL, and returns how many rows were deleted.
+func (tdm *DataTable) Replace(data map[string]any, ttl time.Duration) (uint64, error) {
+	rowsAffected, err := tdm.ReplaceRows([]map[string]any{data}, []time.Duration{ttl})
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected - 1, nil
+}
+
+// ReplaceRows writes rows like Replace, the row at i expiring after ttls[i], and a row also replaces the rows before it
+// it shares the values of a unique index with. The rows to delete are found and room is made for the rows to insert before
+// anything is written, so ErrTableFull writes none of them. It returns the deleted rows together with the inserted ones like MySQL,
+// a row replaced by a later one counting as both.
+func (tdm *DataTable) ReplaceRows(rows []map[string]any, ttls []time.Duration) (uint64, error) {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	uniqueIndexes := tdm.indexes.Load().uniqueIndexes()
+	replaced := make(map[int]struct{})
+	kept := make([]bool, len(rows))
+	// holders map the values of each unique index to the last of rows holding them
+	holders := make([]map[any]int, len(uniqueIndexes))
+	for i := range holders {
+		holders[i] = make(map[any]int)
+	}
+	rowsAffected := uint64(len(rows))
+	for i, row := range rows {
+		kept[i] = true
+		for j, index := range uniqueIndexes {
+			values := index.values(row)
+			if hasNull(values) {
+				continue
+			}
+			for _, rowIndex := range tdm.conflictingRows(index, row, replaced) {
+				replaced[rowIndex] = struct{}{}
+				rowsAffected++
+			}
+			key := hashKey(values)
+			if holder, ok := holders[j][key]; ok && kept[holder] {
+				kept[holder] = false
+				rowsAffected++
+			}
+			holders[j][key] = i
+		}
+	}
+
+	keptRows := make([]map[string]any, 0, len(rows))
+	keptTTLs := make([]time.Duration, 0, len(rows))
+	for i, row := range rows {
+		if kept[i] {
+			keptRows = append(keptRows, row)
+			keptTTLs = append(keptTTLs, ttls[i])
+		}
+	}
+	if err := tdm.checkUnique(keptRows, replaced); err != nil {
+		return 0, err
+	}
+	if tdm.usage.Load() != nil {
+		var size int64
+		for _, row := range keptRows {
+			size += tdm.rowSize(row)
+		}
+		if err := tdm.makeRoom(int64(len(keptRows)), size, replaced); err != nil {
+			return 0, err
+		}
+	}
+	for _, index := range slices.Sorted(maps.Keys(replaced)) {
+		tdm.deleteRow(index, RowDeleted)
+	}
+	for i, row := range keptRows {
+		tdm.store(row, keptTTLs[i])
+	}
+	return rowsAffected, nil
+}
+
+// Upsert inserts data like Insert unless it shares the values of a PRIMARY KEY or UNIQUE index with stored rows, then the first
+// of them is replaced with the row update returns for it, like INSERT ... ON DUPLICATE KEY UPDATE of MySQL. update returns a nil row
+// to leave the stored row as it is, and a non-nil ttl to restart its expiration like UpdateRow. No other write comes between
+// the lookup of the duplicates and the write. It returns the affected rows counted like MySQL: 1 for an insert, 2 for an update
+// and 0 for a row left as it is.
+func (tdm *DataTable) Upsert(data map[string]any, ttl time.Duration, update func(stored map[string]any) (map[string]any, *time.Duration, error)) (uint64, error) {
+	return tdm.UpsertRows([]map[string]any{data}, []time.Duration{ttl}, func(_ int, stored map[string]any) (map[string]any, *time.Duration, error) {
+		return update(stored)
+	})
+}
+
+// UpsertRows writes rows like Upsert, the row at i expiring after ttls[i], and update is called with i. A row updates the row
+// a row before it inserted or updated when they share the values of a unique index, like MySQL handles the rows one after the other.
+// Every row is worked out and checked against the unique indexes, and room is made for the rows to insert, before anything is written,
+// so an error of update, a duplicate entry or ErrTableFull writes none of them. It returns the affected rows of all rows.
+func (tdm *DataTable) UpsertRows(rows []map[string]any, ttls []time.Duration, update func(i int, stored map[string]any) (map[string]any, *time.Duration, error)) (uint64, error) {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	// upsertedRow is a row as the statement leaves it, index is -1 for an inserted row and the row ID of an updated stored one
+	type upsertedRow struct {
+		index  int
+		stored map[string]any
+		row    map[string]any
+		ttl    *time.Duration
+	}
+	uniqueIndexes := tdm.indexes.Load().uniqueIndexes()
+	// holders map the values of each unique index to the upserted row holding them, the stored rows in updated no longer count
+	holders := make([]map[any]*upsertedRow, len(uniqueIndexes))
+	for i := range holders {
+		holders[i] = make(map[any]*upsertedRow)
+	}
+	hold := func(upserted *upsertedRow, holding bool) {
+		for j, index := range uniqueIndexes {
+			values := index.values(upserted.row)
+			if hasNull(values) {
+				continue
+			}
+			key := hashKey(values)
+			if holding {
+				holders[j][key] = upserted
+			} else if holders[j][key] == upserted {
+				delete(holders[j], key)
+			}
+		}
+	}
+	updated := make(map[int]struct{})
+	var upserted []*upsertedRow
+
+	var rowsAffected uint64
+	for i, row := range rows {
+		var duplicate *upsertedRow
+		for j, index := range uniqueIndexes {
+			values := index.values(row)
+			if hasNull(values) {
+				continue
+			}
+			if holder, ok := holders[j][hashKey(values)]; ok {
+				duplicate = holder
+				break
+			}
+			if conflicting := tdm.conflictingRows(index, row, updated); len(conflicting) > 0 {
+				rowIndex := slices.Min(conflicting)
+				if stored, ok := tdm.row(rowIndex); ok {
+					duplicate = &upsertedRow{index: rowIndex, stored: stored, row: stored}
+					break
+				}
+			}
+		}
+		if duplicate == nil {
+			inserted := &upsertedRow{index: -1, row: row, ttl: &ttls[i]}
+			upserted = append(upserted, inserted)
+			hold(inserted, true)
+			rowsAffected++
+			continue
+		}
+
+		newRow, ttl, err := update(i, duplicate.row)
+		if err != nil {
+			return 0, err
+		}
+		if newRow == nil {
+			continue
+		}
+		hold(duplicate, false)
+		if _, ok := updated[duplicate.index]; !ok && duplicate.index != -1 {
+			updated[duplicate.index] = struct{}{}
+			upserted = append(upserted, duplicate)
+		}
+		for j, index := range uniqueIndexes {
+			values := index.values(newRow)
+			if hasNull(values) {
+				continue
+			}
+			if _, ok := holders[j][hashKey(values)]; ok || len(tdm.conflictingRows(index, newRow, updated)) > 0 {
+				return 0, duplicateEntry(index, newRow)
+			}
+		}
+		duplicate.row = newRow
+		if ttl != nil {
+			duplicate.ttl = ttl
+		}
+		hold(duplicate, true)
+		rowsAffected += 2
+	}
+
+	var pendingUpdates []pendingUpdate
+	var insertedRows []*upsertedRow
+	var size int64
+	for _, row := range upserted {
+		if row.index != -1 {
+			pendingUpdates = append(pendingUpdates, pendingUpdate{index: row.index, oldRow: row.stored, newRow: row.row})
+			continue
+		}
+		insertedRows = append(insertedRows, row)
+		if tdm.usage.Load() != nil {
+			size += tdm.rowSize(row.row)
+		}
+	}
+	if err := tdm.makeRoom(int64(len(insertedRows)), size, nil); err != nil {
+		return 0, err
+	}
+	if _, err := tdm.updateRows(pendingUpdates); err != nil {
+		return 0, err
+	}
+	for _, row := range upserted {
+		if row.index != -1 && row.ttl != nil {
+			tdm.Expire(row.index, *row.ttl)
+		}
+	}
+	for _, row := range insertedRows {
+		tdm.store(row.row, *row.ttl)
+	}
+	return rowsAffected, nil
+}
+
+// UpdateRow replaces the row at index with row, checking the unique indexes like Update. A nil ttl keeps the expiration of the row,
+// otherwise the row expires after ttl from now, or never for -1.
+func (tdm *DataTable) UpdateRow(index int, row map[string]any, ttl *time.Duration) error {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	return tdm.updateRow(index, row, ttl)
+}
+
+// updateRow works like UpdateRow, the caller holds writeMutex.
+func (tdm *DataTable) updateRow(index int, row map[string]any, ttl *time.Duration) error {
+	updated, err := tdm.updateIndexes([]int{index}, func(map[string]any) bool {
+		return true
+	}, func(map[string]any) (map[string]any, error) {
+		return row, nil
+	})
+	if err == nil && updated > 0 && ttl != nil {
+		tdm.Expire(index, *ttl)
+	}
+	return err
+}
+
+func (set *indexSet) primaryKey() *tableIndex {
+	for _, index := range set.created {
+		if index.definition.Primary {
+			return index
+		}
+	}
+	return nil
+}
+
+// PrimaryKey returns the columns of the primary key of the table, nil when it has none.
+func (tdm *DataTable) PrimaryKey() []string {
+	if index := tdm.indexes.Load().primaryKey(); index != nil {
+		return append([]string(nil), index.definition.Columns...)
+	}
+	return nil
+}
+
+// PrimaryKeyRowIndex returns the index of the row holding values in the primary key, given in the order of its columns.
+// It returns false when no row holds them or the table has no primary key.
+func (tdm *DataTable) PrimaryKeyRowIndex(values ...any) (int, bool) {
+	index := tdm.indexes.Load().primaryKey()
+	if index == nil || !index.ready.Load() || len(values) != len(index.definition.Columns) {
+		return 0, false
+	}
+	for _, rowIndex := range index.lookup(values) {
+		row, ok := tdm.row(rowIndex)
+		if !ok {
+			continue
+		}
+		found := true
+		for i, column := range index.definition.Columns {
+			if utils.ValueKey(row[column]) != utils.ValueKey(values[i]) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return rowIndex, true
+		}
+	}
+	return 0, false
+}
+
+// GetByPrimaryKey returns the row holding values in the primary key, given in the order of its columns, and records the read like Accessed.
+func (tdm *DataTable) GetByPrimaryKey(values ...any) (map[string]any, bool) {
+	rowIndex, ok := tdm.PrimaryKeyRowIndex(values...)
+	if !ok {
+		return nil, false
+	}
+	row, ok := tdm.GetDataByIndex(rowIndex)
+	if ok && tdm.TracksAccess() {
+		tdm.Accessed([]int{rowIndex})
+	}
+	return row, ok
+}
@@ -2,23 +2,44 @@ package map_table
 
 import (
 	datastructure "a-eighty/data_structure/map"
-	data_structure_slice "a-eighty/data_structure/slice"
-	"a-eighty/data_structure/stream"
 	"a-eighty/utils"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// WrapperNode is an entry of a value bucket, it points at the row by its row ID.
 type WrapperNode struct {
 	Index int
-	Value map[string]any
+}
+
+// valueBucket holds the rows whose column holds one value. Entries are keyed by row ID, so the entry of a row is found
+// without walking the bucket, and size counts them since TTLMap.Len would walk it.
+type valueBucket struct {
+	rows *datastructure.TTLMap[int, WrapperNode]
+	size atomic.Int64
+}
+
+func newValueBucket() *valueBucket {
+	bucket := &valueBucket{rows: datastructure.NewTTLMap[int, WrapperNode]()}
+	bucket.rows.OnExpire(func(int, *WrapperNode) {
+		bucket.size.Add(-1)
+	})
+	return bucket
 }
 
 type DataTable struct {
 	tableName string
 	sharedKey string
-	listData  data_structure_slice.TTLSlice[map[string]any]
+	// schema is nil for tables created without column definitions, they accept any column
+	schema *TableSchema
+	// columns stores the rows column by column under row IDs that are never reused, the buckets and indexes refer to rows by them
+	columns *columnStore
+	// liveRows holds the expiration of every stored row, a row whose entry expired is no longer part of the table
+	liveRows *datastructure.TTLMap[int, struct{}]
 	/*
 		there are 3 objects below going to insert into table
 		object1 = {
@@ -46,107 +67,474 @@ type DataTable struct {
 			"val3" -> object1, object2
 			"val2" -> object3
 	*/
-	valueToReferenceMap datastructure.TTLMap[string, datastructure.TTLMap[any, data_structure_slice.TTLSlice[WrapperNode]]]
+	valueToReferenceMap *datastructure.TTLMap[string, datastructure.TTLMap[any, valueBucket]]
+	// indexes holds the settings and the indexes of the table besides the value buckets, indexMutex serializes their changes
+	indexes    atomic.Pointer[indexSet]
+	indexMutex sync.Mutex
+	// listeners receive the rows leaving the table, listenerMutex serializes their changes
+	listeners     atomic.Pointer[[]*rowListener]
+	listenerMutex sync.Mutex
+	// usage follows the size and the reads of the rows while a limit applies to the table, nil otherwise
+	usage atomic.Pointer[usageTracker]
+	// writeMutex serializes the writes checked against the unique indexes, so no other write comes between a check and its write
+	writeMutex sync.Mutex
 }
 
 func NewDataTable(tableName string) *DataTable {
 	if tableName == "" {
 		tableName = "unknown"
 	}
-	return &DataTable{
+	table := &DataTable{
+		tableName:           tableName,
 		sharedKey:           uuid.NewString(),
-		listData:            *data_structure_slice.NewTTLSlice[map[string]any](),
-		valueToReferenceMap: *datastructure.NewTTLMap[string, datastructure.TTLMap[any, data_structure_slice.TTLSlice[WrapperNode]]](),
+		columns:             newColumnStore(),
+		liveRows:            datastructure.NewTTLMap[int, struct{}](),
+		valueToReferenceMap: datastructure.NewTTLMap[string, datastructure.TTLMap[any, valueBucket]](),
 	}
+	table.indexes.Store(&indexSet{})
+	table.liveRows.OnExpire(table.rowExpired)
+	return table
+}
+
+// Schema returns the column definitions of the table, nil when the table is schemaless.
+func (tdm *DataTable) Schema() *TableSchema {
+	return tdm.schema
 }
 
+// Insert adds a row to the table, it fails with ErrDuplicateEntry when the row breaks a PRIMARY KEY or UNIQUE constraint.
 func (tdm *DataTable) Insert(data map[string]any, ttl time.Duration) error {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	return tdm.insert(data, ttl)
+}
+
+// InsertRows adds rows together, the row at i expiring after ttls[i]. The rows are checked against the unique indexes,
+// each other included, and room is made for all of them before the first one is written, so a duplicate entry or
+// ErrTableFull writes none of them.
+func (tdm *DataTable) InsertRows(rows []map[string]any, ttls []time.Duration) error {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	if err := tdm.checkUnique(rows, nil); err != nil {
+		return err
+	}
+	if tdm.usage.Load() != nil {
+		var size int64
+		for _, row := range rows {
+			size += tdm.rowSize(row)
+		}
+		if err := tdm.makeRoom(int64(len(rows)), size, nil); err != nil {
+			return err
+		}
+	}
+	for i, row := range rows {
+		tdm.store(row, ttls[i])
+	}
+	return nil
+}
+
+// insert works like Insert, the caller holds writeMutex.
+func (tdm *DataTable) insert(data map[string]any, ttl time.Duration) error {
+	if err := tdm.checkUnique([]map[string]any{data}, nil); err != nil {
+		return err
+	}
+	if tdm.usage.Load() != nil {
+		if err := tdm.makeRoom(1, tdm.rowSize(data), nil); err != nil {
+			return err
+		}
+	}
+	tdm.store(data, ttl)
+	return nil
+}
+
+// store writes a row that was checked against the unique indexes and the limits of the table.
+func (tdm *DataTable) store(data map[string]any, ttl time.Duration) {
+	// the row is stored before it is made live, so whoever finds it live can read it
+	lastedIndex := tdm.columns.insert(data, ttl != -1)
+	tdm.liveRows.Set(lastedIndex, &struct{}{}, ttl)
+	expiration, ok := tdm.liveRows.Expiration(lastedIndex)
+	if !ok {
+		return
+	}
+	tdm.trackRow(lastedIndex, data)
+
+	indexes := tdm.indexes.Load()
+	if !indexes.options.DisableAutoIndex {
+		wrappedNode := WrapperNode{Index: lastedIndex}
+		for key, value := range data {
+			tdm.addReference(key, value, wrappedNode, expiration)
+		}
+	}
+	indexes.addRow(data, lastedIndex)
+}
+
+// Update replaces every row matching predicate with the row returned by updater.
+// Rows keep their expiration, and the index buckets of changed columns are moved from the old value to the new one.
+// All new rows are computed and checked against the unique indexes before anything is written, so an updater error
+// or a duplicate entry leaves the table untouched.
+func (tdm *DataTable) Update(predicate func(map[string]any) bool, updater func(map[string]any) (map[string]any, error)) (uint64, error) {
+	return tdm.UpdateIndexes(nil, predicate, updater)
+}
+
+// UpdateIndexes works like Update but only looks at the rows at indexes, all rows when indexes is nil.
+func (tdm *DataTable) UpdateIndexes(candidates []int, predicate func(map[string]any) bool, updater func(map[string]any) (map[string]any, error)) (uint64, error) {
+	tdm.writeMutex.Lock()
+	defer tdm.writeMutex.Unlock()
+	return tdm.updateIndexes(candidates, predicate, updater)
+}
 
-	tdm.listData.Append(data, ttl)
-	lastedIndex := tdm.listData.Len()
+// pendingUpdate is a stored row together with the row replacing it.
+type pendingUpdate struct {
+	index  int
+	oldRow map[string]any
+	newRow map[string]any
+}
+
+// updateIndexes works like UpdateIndexes, the caller holds writeMutex.
+func (tdm *DataTable) updateIndexes(candidates []int, predicate func(map[string]any) bool, updater func(map[string]any) (map[string]any, error)) (uint64, error) {
+	matches := tdm.matchingRows(candidates, predicate)
+	pendingUpdates := make([]pendingUpdate, 0, len(matches))
+	for _, match := range matches {
+		newRow, err := updater(match.row)
+		if err != nil {
+			return 0, err
+		}
+		pendingUpdates = append(pendingUpdates, pendingUpdate{index: match.index, oldRow: match.row, newRow: newRow})
+	}
+	return tdm.updateRows(pendingUpdates)
+}
+
+// updateRows checks the new rows against the unique indexes together and then writes them, the caller holds writeMutex.
+func (tdm *DataTable) updateRows(pendingUpdates []pendingUpdate) (uint64, error) {
+	newRows := make([]map[string]any, len(pendingUpdates))
+	replaced := make(map[int]struct{}, len(pendingUpdates))
+	for i, pending := range pendingUpdates {
+		newRows[i] = pending.newRow
+		replaced[pending.index] = struct{}{}
+	}
+	if err := tdm.checkUnique(newRows, replaced); err != nil {
+		return 0, err
+	}
 
-	for key, value := range data {
-		wrappedNode := WrapperNode{
-			Index: lastedIndex,
-			Value: data,
+	var rowsAffected uint64
+	for _, pending := range pendingUpdates {
+		expiration, ok := tdm.liveRows.Expiration(pending.index)
+		if !ok || !tdm.columns.update(pending.index, pending.newRow) {
+			continue
 		}
-		if innerValueMap, ok := tdm.valueToReferenceMap.Get(key); !ok {
-
-			newDataList := data_structure_slice.NewTTLSlice[WrapperNode]()
-			newDataList.Append(wrappedNode, ttl)
-			newInnerValueMap := datastructure.NewTTLMap[any, data_structure_slice.TTLSlice[WrapperNode]]()
-			newInnerValueMap.Set(value, newDataList, -1)
-			tdm.valueToReferenceMap.Set(key, newInnerValueMap, -1)
-		} else {
-
-			containedFieldValueMap, contain := innerValueMap.Get(value)
-			if contain {
-				containedFieldValueMap.Append(wrappedNode, ttl)
-			} else {
-				containedFieldValueMap = data_structure_slice.NewTTLSlice[WrapperNode]()
-				containedFieldValueMap.Append(wrappedNode, ttl)
-				innerValueMap.Set(value, containedFieldValueMap, -1)
+		indexes := tdm.indexes.Load()
+		if !indexes.options.DisableAutoIndex {
+			wrappedNode := WrapperNode{Index: pending.index}
+			for key, oldValue := range pending.oldRow {
+				if newValue, ok := pending.newRow[key]; !ok || utils.ValueKey(newValue) != utils.ValueKey(oldValue) {
+					tdm.removeReference(key, oldValue, pending.index)
+				}
+			}
+			for key, newValue := range pending.newRow {
+				if oldValue, ok := pending.oldRow[key]; !ok || utils.ValueKey(oldValue) != utils.ValueKey(newValue) {
+					tdm.addReference(key, newValue, wrappedNode, expiration)
+				}
 			}
 		}
+		indexes.each(func(index *tableIndex) {
+			if index.changed(pending.oldRow, pending.newRow) {
+				index.remove(pending.oldRow, pending.index)
+				index.add(pending.newRow, pending.index)
+			}
+		})
+		tdm.trackRow(pending.index, pending.newRow)
+		rowsAffected++
 	}
+	return rowsAffected, nil
+}
 
-	return nil
+// addReference adds the row to the bucket of value, buckets are keyed by utils.ValueKey so equal values of different Go types share one.
+func (tdm *DataTable) addReference(key string, value any, wrappedNode WrapperNode, expiration int64) {
+	value = utils.ValueKey(value)
+	// concurrent writers may create the map of a column or the bucket of a value at the same time, only one of them is kept
+	innerValueMap, ok := tdm.valueToReferenceMap.Get(key)
+	if !ok {
+		newInnerValueMap := datastructure.NewTTLMap[any, valueBucket]()
+		if innerValueMap, ok = tdm.valueToReferenceMap.GetOrSet(key, newInnerValueMap, -1); ok {
+			newInnerValueMap.Release()
+		}
+	}
+	bucket, ok := innerValueMap.Get(value)
+	if !ok {
+		newBucket := newValueBucket()
+		if bucket, ok = innerValueMap.GetOrSet(value, newBucket, -1); ok {
+			newBucket.rows.Release()
+		}
+	}
+	// counted first, so a removal of the row right after it is stored never finds the bucket empty
+	bucket.size.Add(1)
+	bucket.rows.SetWithExpiration(wrappedNode.Index, &wrappedNode, expiration)
+}
+
+// removeReference drops the row at index from the bucket of value, and drops the bucket once it is empty.
+func (tdm *DataTable) removeReference(key string, value any, index int) {
+	bucket, ok := tdm.referenceBucket(key, value)
+	if !ok {
+		return
+	}
+	if bucket.rows.Remove(index) && bucket.size.Add(-1) == 0 {
+		if innerValueMap, ok := tdm.valueToReferenceMap.Get(key); ok {
+			innerValueMap.Delete(utils.ValueKey(value))
+		}
+		bucket.rows.Release()
+	}
+}
+
+// referenceBucket returns the bucket of value in the buckets of column key.
+func (tdm *DataTable) referenceBucket(key string, value any) (*valueBucket, bool) {
+	innerValueMap, ok := tdm.valueToReferenceMap.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return innerValueMap.Get(utils.ValueKey(value))
+}
+
+func (tdm *DataTable) referenceBucketItems(key string, value any, consumer func(node *WrapperNode) bool) {
+	if bucket, ok := tdm.referenceBucket(key, value); ok {
+		bucket.rows.Items(func(_ int, node *WrapperNode) bool {
+			return consumer(node)
+		})
+	}
 }
 
+// GetDataByIndex returns the row with the row ID index, a new map the caller may change.
 func (tdm *DataTable) GetDataByIndex(index int) (map[string]any, bool) {
-	if value, isOk := tdm.listData.Get(index); isOk {
-		return *value, true
+	return tdm.row(index)
+}
+
+// row returns the row with the row ID index when it is live.
+func (tdm *DataTable) row(index int) (map[string]any, bool) {
+	if _, ok := tdm.liveRows.Expiration(index); !ok {
+		return nil, false
 	}
-	return nil, false
+	return tdm.columns.row(index)
 }
 
+// eachRow walks the live rows in no particular order.
+func (tdm *DataTable) eachRow(consumer func(index int, row map[string]any) bool) {
+	tdm.liveRows.Items(func(index int, _ *struct{}) bool {
+		row, ok := tdm.columns.row(index)
+		return !ok || consumer(index, row)
+	})
+}
+
+// LookupRows returns the rows whose column holds value, found in the value buckets of the column or in an index created on it.
+// It returns false when neither exists, see HasLookupIndex.
+func (tdm *DataTable) LookupRows(column string, value any) ([]map[string]any, bool) {
+	indexes := tdm.indexes.Load()
+	var rows []map[string]any
+	if !indexes.options.DisableAutoIndex {
+		tdm.referenceBucketItems(column, value, func(node *WrapperNode) bool {
+			if row, ok := tdm.columns.row(node.Index); ok {
+				rows = append(rows, row)
+			}
+			return true
+		})
+		return rows, true
+	}
+	index := indexes.equalityIndex(column)
+	if index == nil {
+		return nil, false
+	}
+	for _, rowIndex := range index.lookup([]any{value}) {
+		if row, ok := tdm.row(rowIndex); ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, true
+}
+
+// RowIndexes works like LookupRows but returns the indexes of the rows. Without value buckets or an index
+// on column it compares the encoded values the column store keeps of every row instead, so it always succeeds.
+func (tdm *DataTable) RowIndexes(column string, value any) ([]int, bool) {
+	indexes := tdm.indexes.Load()
+	if !indexes.options.DisableAutoIndex {
+		var rowIndexes []int
+		tdm.referenceBucketItems(column, value, func(node *WrapperNode) bool {
+			rowIndexes = append(rowIndexes, node.Index)
+			return true
+		})
+		return rowIndexes, true
+	}
+	if index := indexes.equalityIndex(column); index != nil {
+		return index.lookup([]any{value}), true
+	}
+	rowIndexes := tdm.columns.matching(column, utils.ValueKey(value))
+	return slices.DeleteFunc(rowIndexes, func(index int) bool {
+		_, live := tdm.liveRows.Expiration(index)
+		return !live
+	}), true
+}
+
+// QueryWithCriteria returns the rows matching predicate in the order of their index, sorted stably by sort when it is set,
+// offset and limit apply to the matching rows after sorting.
 func (tdm *DataTable) QueryWithCriteria(predicate func(map[string]any) bool, sort func(a, b map[string]any) bool, limit, offset *uint64) []map[string]any {
-	filteredValuesMap := make(map[uint64]map[string]any)
-	tdm.valueToReferenceMap.Items(func(parentKey string, mapValue *datastructure.TTLMap[any, data_structure_slice.TTLSlice[WrapperNode]]) bool {
-		mapValue.Items(func(key any, sliceValue *data_structure_slice.TTLSlice[WrapperNode]) bool {
-			builtMap := map[string]any{
-				parentKey: key,
+	return tdm.QueryIndexes(nil, predicate, sort, limit, offset)
+}
+
+// QueryIndexes works like QueryWithCriteria but only looks at the rows at indexes, all rows when indexes is nil.
+func (tdm *DataTable) QueryIndexes(indexes []int, predicate func(map[string]any) bool, sort func(a, b map[string]any) bool, limit, offset *uint64) []map[string]any {
+	matches := tdm.matchingRows(indexes, predicate)
+	filteredValues := make([]map[string]any, len(matches))
+	for i, match := range matches {
+		filteredValues[i] = match.row
+	}
+	if sort != nil {
+		slices.SortStableFunc(filteredValues, func(a, b map[string]any) int {
+			if sort(a, b) {
+				return -1
 			}
-			if predicate(builtMap) {
-				sliceValue.Range(func(index int, value WrapperNode) bool {
-					val := value.Value
-					hashVal, err := utils.HashObject_XXHash(val)
-					if err != nil {
-						return true
-					}
-					filteredValuesMap[hashVal] = val
-					return true
-				}, nil, nil)
+			if sort(b, a) {
+				return 1
 			}
-			return true
+			return 0
 		})
-		return true
-	})
-	var filteredValues = make([]map[string]any, 0)
-	for _, val := range filteredValuesMap {
-		filteredValues = append(filteredValues, val)
 	}
+	if offset != nil {
+		if *offset >= uint64(len(filteredValues)) {
+			return filteredValues[:0]
+		}
+		filteredValues = filteredValues[*offset:]
+	}
+	if limit != nil && *limit < uint64(len(filteredValues)) {
+		filteredValues = filteredValues[:*limit]
+	}
+	return filteredValues
+}
 
-	wrappedArray := data_structure_slice.ArraySlice[map[string]any]{
-		Array: filteredValues,
+// MatchingRowIndexes returns the indexes of the rows at indexes, or of every row when indexes is nil, that predicate accepts
+// in ascending order. predicate gets the index of the row as well, e.g. to read its expiration.
+func (tdm *DataTable) MatchingRowIndexes(indexes []int, predicate func(index int, row map[string]any) bool) []int {
+	var matches []int
+	if indexes == nil {
+		tdm.eachRow(func(index int, row map[string]any) bool {
+			if predicate(index, row) {
+				matches = append(matches, index)
+			}
+			return true
+		})
+	} else {
+		for _, index := range indexes {
+			if row, ok := tdm.row(index); ok && predicate(index, row) {
+				matches = append(matches, index)
+			}
+		}
 	}
-	dataStream := stream.From[map[string]any](&wrappedArray)
-	return dataStream.Sort(sort).Limit(limit).Offset(offset).Collect()
+	slices.Sort(matches)
+	return matches
 }
 
-func (tdm *DataTable) Delete(predicate func(map[string]any) bool) error {
-	tdm.listData.DeleteAll(predicate)
-	tdm.valueToReferenceMap.Items(func(parentKey string, mapValue *datastructure.TTLMap[any, data_structure_slice.TTLSlice[WrapperNode]]) bool {
-		mapValue.Items(func(key any, _ *data_structure_slice.TTLSlice[WrapperNode]) bool {
-			builtMap := map[string]any{
-				parentKey: key,
+type indexedRow struct {
+	index int
+	row   map[string]any
+}
+
+// matchingRows evaluates predicate on the rows at indexes, or on every row when indexes is nil, and returns the matches by index.
+func (tdm *DataTable) matchingRows(indexes []int, predicate func(map[string]any) bool) []indexedRow {
+	var matches []indexedRow
+	if indexes == nil {
+		// the predicate sees whole rows, a condition over several columns cannot be decided on a single bucket
+		tdm.eachRow(func(index int, row map[string]any) bool {
+			if predicate(row) {
+				matches = append(matches, indexedRow{index: index, row: row})
 			}
-			if predicate(builtMap) {
-				mapValue.Delete(key)
+			return true
+		})
+	} else {
+		for _, index := range indexes {
+			if row, ok := tdm.row(index); ok && predicate(row) {
+				matches = append(matches, indexedRow{index: index, row: row})
 			}
+		}
+	}
+	slices.SortFunc(matches, func(a, b indexedRow) int {
+		return a.index - b.index
+	})
+	return matches
+}
+
+// Delete removes every row matching predicate together with its bucket entries and returns how many rows were removed.
+func (tdm *DataTable) Delete(predicate func(map[string]any) bool) (uint64, error) {
+	return tdm.DeleteIndexes(nil, predicate)
+}
+
+// DeleteIndexes works like Delete but only looks at the rows at indexes, all rows when indexes is nil.
+func (tdm *DataTable) DeleteIndexes(candidates []int, predicate func(map[string]any) bool) (uint64, error) {
+	matches := tdm.matchingRows(candidates, predicate)
+	indexes := make([]int, len(matches))
+	for i, match := range matches {
+		indexes[i] = match.index
+	}
+	for _, index := range indexes {
+		tdm.deleteRow(index, RowDeleted)
+	}
+	return uint64(len(indexes)), nil
+}
+
+// deleteRow removes the row at index with its bucket entries and index entries and reports it with reason.
+func (tdm *DataTable) deleteRow(index int, reason RowEventReason) {
+	tdm.untrackRow(index)
+	// the store hands the row to one caller only, so a row deleted and expiring at the same time is reported once
+	row, ok := tdm.columns.delete(index)
+	tdm.liveRows.Delete(index)
+	if !ok {
+		return
+	}
+	for key, value := range row {
+		tdm.removeReference(key, value, index)
+	}
+	tdm.indexes.Load().removeRow(row, index)
+	tdm.notify(row, reason)
+}
+
+// Truncate removes every row of the table and keeps the table itself usable.
+func (tdm *DataTable) Truncate() {
+	var rows []map[string]any
+	if tdm.hasListeners() {
+		tdm.eachRow(func(_ int, row map[string]any) bool {
+			rows = append(rows, row)
 			return true
 		})
+	}
+	tdm.releaseReferences()
+	tdm.valueToReferenceMap.Clear()
+	tdm.indexes.Load().each(func(index *tableIndex) {
+		index.clear()
+	})
+	tdm.liveRows.Clear()
+	tdm.columns.clear()
+	if usage := tdm.usage.Load(); usage != nil {
+		usage.clear()
+	}
+	for _, row := range rows {
+		tdm.notify(row, RowDeleted)
+	}
+}
+
+// Release drops every row and releases all maps of the table, so the cleaner forgets their entries,
+// the table must not be used afterwards.
+func (tdm *DataTable) Release() {
+	tdm.releaseReferences()
+	tdm.valueToReferenceMap.Release()
+	tdm.indexes.Load().each(func(index *tableIndex) {
+		index.clear()
+	})
+	tdm.liveRows.Release()
+	tdm.columns.clear()
+	tdm.usage.Store(nil)
+}
+
+func (tdm *DataTable) releaseReferences() {
+	tdm.valueToReferenceMap.Items(func(_ string, mapValue *datastructure.TTLMap[any, valueBucket]) bool {
+		mapValue.Items(func(_ any, bucket *valueBucket) bool {
+			bucket.rows.Release()
+			return true
+		})
+		mapValue.Release()
 		return true
 	})
-	return nil
 }
@@ -0,0 +1,110 @@
+package map_table
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// RowEventReason tells why a row left a table.
+type RowEventReason int
+
+const (
+	// RowExpired is sent for a row whose TTL ran out
+	RowExpired RowEventReason = iota + 1
+	// RowDeleted is sent for a row removed by DELETE, REPLACE or TRUNCATE
+	RowDeleted
+	// RowEvicted is sent for a row removed to make room for others
+	RowEvicted
+)
+
+func (reason RowEventReason) String() string {
+	switch reason {
+	case RowExpired:
+		return "expired"
+	case RowDeleted:
+		return "deleted"
+	case RowEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// RowEvent reports a row that left a table, Row must not be changed.
+type RowEvent struct {
+	Table  string
+	Row    map[string]any
+	Reason RowEventReason
+}
+
+type rowListener struct {
+	callback func(RowEvent)
+}
+
+// Subscribe calls callback with every row that leaves the table from now on, until the returned function is called.
+// callback runs on the goroutine removing the row, which may be the cleaner or a statement that found the row expired,
+// so it must return quickly and must not wait for statements on the table.
+func (tdm *DataTable) Subscribe(callback func(RowEvent)) (unsubscribe func()) {
+	listener := &rowListener{callback: callback}
+	tdm.listenerMutex.Lock()
+	defer tdm.listenerMutex.Unlock()
+	// listeners are replaced rather than changed, so rows can be reported while a listener is added
+	listeners := append(slices.Clone(tdm.loadListeners()), listener)
+	tdm.listeners.Store(&listeners)
+	return func() {
+		tdm.listenerMutex.Lock()
+		defer tdm.listenerMutex.Unlock()
+		listeners := slices.DeleteFunc(slices.Clone(tdm.loadListeners()), func(current *rowListener) bool {
+			return current == listener
+		})
+		tdm.listeners.Store(&listeners)
+	}
+}
+
+// SubscribeChannel sends every row that leaves the table from now on to events, until unsubscribe is called.
+// The send never waits, since the goroutine removing the row may be the cleaner or a statement holding the table,
+// so a row leaving while events is full is dropped and counted by dropped.
+func (tdm *DataTable) SubscribeChannel(events chan<- RowEvent) (unsubscribe func(), dropped func() uint64) {
+	var droppedEvents atomic.Uint64
+	unsubscribe = tdm.Subscribe(func(event RowEvent) {
+		select {
+		case events <- event:
+		default:
+			droppedEvents.Add(1)
+		}
+	})
+	return unsubscribe, droppedEvents.Load
+}
+
+func (tdm *DataTable) loadListeners() []*rowListener {
+	if listeners := tdm.listeners.Load(); listeners != nil {
+		return *listeners
+	}
+	return nil
+}
+
+func (tdm *DataTable) hasListeners() bool {
+	return len(tdm.loadListeners()) > 0
+}
+
+func (tdm *DataTable) notify(row map[string]any, reason RowEventReason) {
+	listeners := tdm.loadListeners()
+	if len(listeners) == 0 {
+		return
+	}
+	event := RowEvent{Table: tdm.tableName, Row: row, Reason: reason}
+	for _, listener := range listeners {
+		listener.callback(event)
+	}
+}
+
+// rowExpired deletes a row once its entry in liveRows expired and reports it, the bucket entries of the row expire by themselves.
+func (tdm *DataTable) rowExpired(index int, _ *struct{}) {
+	tdm.untrackRow(index)
+	row, ok := tdm.columns.delete(index)
+	if !ok {
+		return
+	}
+	tdm.indexes.Load().removeRow(row, index)
+	tdm.notify(row, RowExpired)
+}
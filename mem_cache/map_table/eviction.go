@@ -0,0 +1,437 @@
+package map_table
+
+import (
+	map_data_structure "a-eighty/data_structure/map"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+)
+
+// EvictionPolicy picks the row to evict once a table or all tables together reach a limit.
+// Rows are picked among a few sampled ones like Redis does, not among every row of the table.
+type EvictionPolicy int
+
+const (
+	// EvictionLRU evicts the row read or written least recently
+	EvictionLRU EvictionPolicy = iota
+	// EvictionLFU evicts the row read least often, the count of a row halves for every minute it is not read
+	EvictionLFU
+	// EvictionRandom evicts any row
+	EvictionRandom
+	// EvictionTTL evicts the row expiring soonest, rows that never expire go last
+	EvictionTTL
+	// EvictionNone rejects inserts with ErrTableFull instead of evicting
+	EvictionNone
+)
+
+var evictionPolicyNames = []string{"lru", "lfu", "random", "ttl", "none"}
+
+func (policy EvictionPolicy) String() string {
+	if policy >= 0 && int(policy) < len(evictionPolicyNames) {
+		return evictionPolicyNames[policy]
+	}
+	return "unknown"
+}
+
+// ParseEvictionPolicy reads a policy by the name String gives it, ignoring case.
+func ParseEvictionPolicy(name string) (EvictionPolicy, bool) {
+	for policy, policyName := range evictionPolicyNames {
+		if strings.EqualFold(name, policyName) {
+			return EvictionPolicy(policy), true
+		}
+	}
+	return 0, false
+}
+
+// evictionSamples is how many rows are compared to pick one to evict.
+const evictionSamples = 8
+
+var ErrTableFull = errors.New("table is full")
+
+// GlobalLimits bound the rows of every table of every database together, on top of the limits of each table.
+type GlobalLimits struct {
+	// MaxRows is the most rows all tables hold together, 0 for no limit
+	MaxRows int64
+	// MaxMemory is the most bytes all tables hold together as estimated for each row, 0 for no limit
+	MaxMemory int64
+	// Eviction picks the row to evict among the rows of every table
+	Eviction EvictionPolicy
+}
+
+var globalLimits atomic.Pointer[GlobalLimits]
+
+// SetGlobalLimits changes the limits of all tables together, zero limits remove them.
+func SetGlobalLimits(limits GlobalLimits) {
+	if limits.MaxRows > 0 || limits.MaxMemory > 0 {
+		globalLimits.Store(&limits)
+	} else {
+		globalLimits.Store(nil)
+	}
+	eachTable(func(table *DataTable) {
+		table.indexMutex.Lock()
+		defer table.indexMutex.Unlock()
+		table.updateUsageTracking()
+	})
+}
+
+// Usage returns how many rows the table holds and how many bytes they take as estimated for eviction.
+// It returns false when no limit applies to the table, usage is only tracked then.
+func (tdm *DataTable) Usage() (rows, memory int64, ok bool) {
+	usage := tdm.usage.Load()
+	if usage == nil {
+		return 0, 0, false
+	}
+	rows, memory = usage.totals()
+	return rows, memory, true
+}
+
+// usageTracker follows the size and the reads of every row of a table with a limit, and samples rows to evict.
+type usageTracker struct {
+	mu sync.Mutex
+	// rows holds every tracked row once, in no order, so a random position samples a random row
+	rows    []*trackedRow
+	byIndex map[int]*trackedRow
+	memory  int64
+}
+
+type trackedRow struct {
+	index    int
+	position int
+	size     int64
+	// lastAccess is the unix nanoseconds of the last read or write, hits counts reads for EvictionLFU
+	lastAccess int64
+	hits       uint32
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{byIndex: make(map[int]*trackedRow)}
+}
+
+func (usage *usageTracker) totals() (rows, memory int64) {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	return int64(len(usage.rows)), usage.memory
+}
+
+// set tracks the row at index with size, or changes its size when it is tracked already.
+func (usage *usageTracker) set(index int, size int64) {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	now := time.Now().UnixNano()
+	if row, ok := usage.byIndex[index]; ok {
+		usage.memory += size - row.size
+		row.size = size
+		row.lastAccess = now
+		return
+	}
+	row := &trackedRow{index: index, position: len(usage.rows), size: size, lastAccess: now, hits: 1}
+	usage.rows = append(usage.rows, row)
+	usage.byIndex[index] = row
+	usage.memory += size
+}
+
+func (usage *usageTracker) remove(index int) {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	row, ok := usage.byIndex[index]
+	if !ok {
+		return
+	}
+	last := usage.rows[len(usage.rows)-1]
+	usage.rows[row.position] = last
+	last.position = row.position
+	usage.rows = usage.rows[:len(usage.rows)-1]
+	delete(usage.byIndex, index)
+	usage.memory -= row.size
+}
+
+func (usage *usageTracker) access(indexes []int) {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	now := time.Now().UnixNano()
+	for _, index := range indexes {
+		if row, ok := usage.byIndex[index]; ok {
+			row.hits = row.decayedHits(now) + 1
+			row.lastAccess = now
+		}
+	}
+}
+
+func (usage *usageTracker) clear() {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	usage.rows = nil
+	usage.byIndex = make(map[int]*trackedRow)
+	usage.memory = 0
+}
+
+// sample returns copies of evictionSamples random rows, or of every row when there are no more. Rows in spared are left out,
+// when random picks keep finding them the rows are walked for the others.
+func (usage *usageTracker) sample(spared map[int]struct{}) []trackedRow {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+	isSpared := func(row *trackedRow) bool {
+		_, ok := spared[row.index]
+		return ok
+	}
+	if len(usage.rows) <= evictionSamples {
+		samples := make([]trackedRow, 0, len(usage.rows))
+		for _, row := range usage.rows {
+			if !isSpared(row) {
+				samples = append(samples, *row)
+			}
+		}
+		return samples
+	}
+	samples := make([]trackedRow, 0, evictionSamples)
+	for attempt := 0; attempt < 4*evictionSamples && len(samples) < evictionSamples; attempt++ {
+		if row := usage.rows[rand.IntN(len(usage.rows))]; !isSpared(row) {
+			samples = append(samples, *row)
+		}
+	}
+	for i := 0; len(samples) == 0 && i < len(usage.rows); i++ {
+		if !isSpared(usage.rows[i]) {
+			samples = append(samples, *usage.rows[i])
+		}
+	}
+	return samples
+}
+
+func (row *trackedRow) decayedHits(now int64) uint32 {
+	idleMinutes := (now - row.lastAccess) / int64(time.Minute)
+	if idleMinutes >= 32 {
+		return 0
+	}
+	return row.hits >> idleMinutes
+}
+
+// evictionCandidate is a sampled row with the key policy compares, the lowest key is evicted first.
+type evictionCandidate struct {
+	table *DataTable
+	index int
+	key   [2]int64
+}
+
+// evictionCandidates samples the rows of the table other than spared for policy.
+func (tdm *DataTable) evictionCandidates(policy EvictionPolicy, spared map[int]struct{}) []evictionCandidate {
+	usage := tdm.usage.Load()
+	if usage == nil {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	samples := usage.sample(spared)
+	candidates := make([]evictionCandidate, len(samples))
+	for i, row := range samples {
+		candidate := evictionCandidate{table: tdm, index: row.index}
+		switch policy {
+		case EvictionLRU:
+			candidate.key = [2]int64{row.lastAccess}
+		case EvictionLFU:
+			candidate.key = [2]int64{int64(row.decayedHits(now)), row.lastAccess}
+		case EvictionTTL:
+			expiration, ok := tdm.liveRows.Expiration(row.index)
+			if ok && expiration == -1 {
+				expiration = math.MaxInt64
+			}
+			candidate.key = [2]int64{expiration, row.lastAccess}
+		default:
+			candidate.key = [2]int64{rand.Int64()}
+		}
+		candidates[i] = candidate
+	}
+	return candidates
+}
+
+// evictOne evicts the best candidate of policy and returns false when there was none.
+func evictOne(candidates []evictionCandidate) bool {
+	if len(candidates) == 0 {
+		return false
+	}
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.key[0] < best.key[0] || candidate.key[0] == best.key[0] && candidate.key[1] < best.key[1] {
+			best = candidate
+		}
+	}
+	best.table.deleteRow(best.index, RowEvicted)
+	return true
+}
+
+// makeRoom evicts rows until count rows of size in total fit within the limits of the table and the global ones,
+// or fails with ErrTableFull when the policy is EvictionNone or the rows cannot fit at all. replaced are the stored rows
+// the write deletes before it stores the new ones, their room counts as free and they are not evicted.
+func (tdm *DataTable) makeRoom(count, size int64, replaced map[int]struct{}) error {
+	usage := tdm.usage.Load()
+	if usage == nil {
+		return nil
+	}
+	var freedRows, freedMemory int64
+	for index := range replaced {
+		if row, ok := tdm.row(index); ok {
+			freedRows++
+			freedMemory += tdm.rowSize(row)
+		}
+	}
+	options := tdm.Options()
+	if options.MaxRows > 0 || options.MaxMemory > 0 {
+		if options.MaxRows > 0 && count > options.MaxRows || options.MaxMemory > 0 && size > options.MaxMemory {
+			return tdm.tableFull()
+		}
+		for {
+			rows, memory := usage.totals()
+			rows, memory = rows-freedRows, memory-freedMemory
+			if (options.MaxRows <= 0 || rows+count <= options.MaxRows) && (options.MaxMemory <= 0 || memory+size <= options.MaxMemory) {
+				break
+			}
+			if options.Eviction == EvictionNone || !evictOne(tdm.evictionCandidates(options.Eviction, replaced)) {
+				return tdm.tableFull()
+			}
+		}
+	}
+
+	limits := globalLimits.Load()
+	if limits == nil {
+		return nil
+	}
+	if limits.MaxRows > 0 && count > limits.MaxRows || limits.MaxMemory > 0 && size > limits.MaxMemory {
+		return tdm.tableFull()
+	}
+	for {
+		rows, memory := -freedRows, -freedMemory
+		var candidates []evictionCandidate
+		eachTable(func(table *DataTable) {
+			if tableUsage := table.usage.Load(); tableUsage != nil {
+				tableRows, tableMemory := tableUsage.totals()
+				rows += tableRows
+				memory += tableMemory
+			}
+		})
+		if (limits.MaxRows <= 0 || rows+count <= limits.MaxRows) && (limits.MaxMemory <= 0 || memory+size <= limits.MaxMemory) {
+			return nil
+		}
+		if limits.Eviction != EvictionNone {
+			eachTable(func(table *DataTable) {
+				var spared map[int]struct{}
+				if table == tdm {
+					spared = replaced
+				}
+				candidates = append(candidates, table.evictionCandidates(limits.Eviction, spared)...)
+			})
+		}
+		if !evictOne(candidates) {
+			return tdm.tableFull()
+		}
+	}
+}
+
+func (tdm *DataTable) tableFull() error {
+	return fmt.Errorf("%w: '%s'", ErrTableFull, tdm.tableName)
+}
+
+// updateUsageTracking starts tracking the rows of the table when a limit applies to it and stops otherwise,
+// the caller holds indexMutex.
+func (tdm *DataTable) updateUsageTracking() {
+	options := tdm.indexes.Load().options
+	limited := options.MaxRows > 0 || options.MaxMemory > 0 || globalLimits.Load() != nil
+	if !limited {
+		tdm.usage.Store(nil)
+		return
+	}
+	if tdm.usage.Load() != nil {
+		return
+	}
+	// the tracker is published before the stored rows are added, so a row inserted meanwhile is not missed;
+	// a row deleted meanwhile may stay tracked until it is picked for eviction, which then only untracks it
+	usage := newUsageTracker()
+	tdm.usage.Store(usage)
+	tdm.eachRow(func(index int, row map[string]any) bool {
+		usage.set(index, tdm.rowSize(row))
+		return true
+	})
+}
+
+func (tdm *DataTable) trackRow(index int, row map[string]any) {
+	if usage := tdm.usage.Load(); usage != nil {
+		usage.set(index, tdm.rowSize(row))
+	}
+}
+
+func (tdm *DataTable) untrackRow(index int) {
+	if usage := tdm.usage.Load(); usage != nil {
+		usage.remove(index)
+	}
+}
+
+// Accessed records that the rows at indexes were read, for the sliding TTL and the LRU and LFU eviction of the table.
+func (tdm *DataTable) Accessed(indexes []int) {
+	if tdm.Options().SlidingTTL {
+		tdm.Touch(indexes)
+	}
+	if usage := tdm.usage.Load(); usage != nil {
+		usage.access(indexes)
+	}
+}
+
+// TracksAccess tells whether reads have to be reported with Accessed.
+func (tdm *DataTable) TracksAccess() bool {
+	return tdm.Options().SlidingTTL || tdm.usage.Load() != nil
+}
+
+// Estimated sizes in bytes of the parts of a stored row, close enough to compare tables against a memory limit.
+const (
+	rowOverhead         = 128
+	columnOverhead      = 48
+	bucketEntryOverhead = 64
+)
+
+// rowSize estimates the bytes a row takes in the table together with its bucket entries.
+func (tdm *DataTable) rowSize(row map[string]any) int64 {
+	autoIndex := !tdm.indexes.Load().options.DisableAutoIndex
+	size := int64(rowOverhead)
+	for column, value := range row {
+		size += columnOverhead + int64(len(column)) + valueSize(value)
+		if autoIndex {
+			size += bucketEntryOverhead
+		}
+	}
+	return size
+}
+
+func valueSize(value any) int64 {
+	switch value := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(value))
+	case []byte:
+		return int64(len(value)) + 24
+	case time.Time:
+		return 24
+	case decimal.Decimal:
+		return 40
+	default:
+		return 8
+	}
+}
+
+// eachTable calls consumer with every table of every database.
+func eachTable(consumer func(table *DataTable)) {
+	registry := atomicDatabaseRegistry.Load()
+	if registry == nil {
+		return
+	}
+	registry.Items(func(_ string, database *map_data_structure.TTLMap[string, DataTable]) bool {
+		database.Items(func(_ string, table *DataTable) bool {
+			consumer(table)
+			return true
+		})
+		return true
+	})
+}
@@ -0,0 +1,60 @@
+package map_table
+
+import (
+	"time"
+)
+
+// Expiration returns when the row at index expires in unix nanoseconds, -1 when it never does.
+// It returns false when there is no such row.
+func (tdm *DataTable) Expiration(index int) (int64, bool) {
+	return tdm.liveRows.Expiration(index)
+}
+
+// Expire makes the row at index expire after ttl from now, a ttl of -1 keeps it until it is deleted like PERSIST of Redis.
+// It returns false when there is no such row.
+func (tdm *DataTable) Expire(index int, ttl time.Duration) bool {
+	expiration := int64(-1)
+	if ttl != -1 {
+		expiration = time.Now().Add(ttl).UnixNano()
+	}
+	return tdm.setExpiration(index, expiration)
+}
+
+// Touch restarts the expiration of the rows at indexes with the default TTL of the table,
+// rows that never expire are left alone.
+func (tdm *DataTable) Touch(indexes []int) {
+	ttl := tdm.Options().DefaultTTL
+	if ttl <= 0 {
+		return
+	}
+	expiration := time.Now().Add(ttl).UnixNano()
+	for _, index := range indexes {
+		if current, ok := tdm.liveRows.Expiration(index); ok && current != -1 {
+			tdm.setExpiration(index, expiration)
+		}
+	}
+}
+
+// setExpiration changes the expiration of a row together with the one of its bucket entries,
+// which would otherwise hide the row from lookups once they expire.
+func (tdm *DataTable) setExpiration(index int, expiration int64) bool {
+	row, ok := tdm.row(index)
+	if !ok {
+		return false
+	}
+	if expiration != -1 {
+		tdm.columns.markExpiring(index)
+	}
+	if !tdm.liveRows.SetExpiration(index, expiration) {
+		return false
+	}
+	if tdm.indexes.Load().options.DisableAutoIndex {
+		return true
+	}
+	for key, value := range row {
+		if bucket, ok := tdm.referenceBucket(key, value); ok {
+			bucket.rows.SetExpiration(index, expiration)
+		}
+	}
+	return true
+}
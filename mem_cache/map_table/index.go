@@ -0,0 +1,603 @@
+package map_table
+
+import (
+	data_structure_skiplist "a-eighty/data_structure/skiplist"
+	"a-eighty/utils"
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IndexKind is how an index keeps its rows.
+type IndexKind int
+
+const (
+	// IndexKindHash finds the rows holding the same values in every column of the index
+	IndexKindHash IndexKind = iota
+	// IndexKindBTree keeps the rows ordered, it serves equalities on a prefix of its columns and ranges and ORDER BY on the first one
+	IndexKindBTree
+)
+
+func (kind IndexKind) String() string {
+	switch kind {
+	case IndexKindHash:
+		return "HASH"
+	case IndexKindBTree:
+		return "BTREE"
+	default:
+		return fmt.Sprintf("IndexKind(%d)", int(kind))
+	}
+}
+
+// IndexDefinition describes an index created on a table.
+type IndexDefinition struct {
+	Name    string
+	Kind    IndexKind
+	Columns []string
+	// Unique rejects a row holding the values of another row in every column, NULL never equals another value
+	Unique bool
+	// Primary marks the primary key of the table, it is unique, named PrimaryKeyName and its columns are NOT NULL
+	Primary bool
+}
+
+var (
+	ErrIndexExists    = errors.New("index already exists")
+	ErrIndexNotExists = errors.New("index not exists")
+)
+
+// TableOptions are the settings of a table.
+type TableOptions struct {
+	// DisableAutoIndex stops indexing every column of every row, only the indexes created on the table are kept
+	DisableAutoIndex bool
+	// DefaultTTL is how long a row inserted without a TTL of its own lives, 0 keeps such rows until they are deleted.
+	// Changing it leaves the rows already stored alone
+	DefaultTTL time.Duration
+	// SlidingTTL restarts the expiration of the rows a SELECT reads with DefaultTTL, see Touch
+	SlidingTTL bool
+	// MaxRows and MaxMemory limit the rows of the table and the bytes they take as estimated for each row, 0 for no limit.
+	// Inserting past a limit evicts rows picked by Eviction, lowering a limit takes effect with the next insert
+	MaxRows   int64
+	MaxMemory int64
+	Eviction  EvictionPolicy
+}
+
+// RangeBound limits a range of column values, Inclusive tells whether Value itself is part of the range.
+type RangeBound struct {
+	Value     any
+	Inclusive bool
+}
+
+// indexEntry is a row in an ordered index, the row index keeps entries of equal values apart and in insertion order.
+type indexEntry struct {
+	values []any
+	index  int
+}
+
+// tableIndex is an index of a table, rows are found in hash for HASH indexes and in ordered for BTREE ones.
+type tableIndex struct {
+	definition IndexDefinition
+	// ready is set once the rows stored before the index was created are in it, lookups ignore the index until then
+	ready   atomic.Bool
+	mutex   sync.RWMutex
+	hash    map[any]map[int]struct{}
+	ordered *data_structure_skiplist.SkipList[indexEntry]
+}
+
+// indexSet is the indexes a table keeps, it is replaced as a whole whenever they change.
+type indexSet struct {
+	options TableOptions
+	// ordered keeps the rows ordered by every schema column while auto indexing is on
+	ordered map[string]*tableIndex
+	created []*tableIndex
+}
+
+func newTableIndex(definition IndexDefinition) *tableIndex {
+	index := &tableIndex{definition: definition}
+	if definition.Kind == IndexKindHash {
+		index.hash = make(map[any]map[int]struct{})
+	} else {
+		index.ordered = data_structure_skiplist.NewSkipList(compareIndexEntries)
+	}
+	return index
+}
+
+// compareIndexEntries orders entries by their values and then by row index. A seek key with only the leading values and the lowest
+// or highest row index lands before or after every entry starting with those values.
+func compareIndexEntries(a, b indexEntry) int {
+	for i := 0; i < len(a.values) && i < len(b.values); i++ {
+		if result := compareIndexValues(a.values[i], b.values[i]); result != 0 {
+			return result
+		}
+	}
+	return cmp.Compare(a.index, b.index)
+}
+
+// compareIndexValues orders NULL before every value, values a column cannot compare are ordered by their type
+// so the order stays total.
+func compareIndexValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if result, err := utils.CompareValues(a, b); err == nil {
+		return result
+	}
+	return cmp.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b))
+}
+
+// hashKey combines values into one map key, equal values of different Go types share it like in the value buckets.
+func hashKey(values []any) any {
+	if len(values) == 1 {
+		return utils.ValueKey(values[0])
+	}
+	var builder strings.Builder
+	for _, value := range values {
+		key := utils.ValueKey(value)
+		fmt.Fprintf(&builder, "%T:%v\x00", key, key)
+	}
+	return builder.String()
+}
+
+func (index *tableIndex) values(row map[string]any) []any {
+	values := make([]any, len(index.definition.Columns))
+	for i, column := range index.definition.Columns {
+		values[i] = row[column]
+	}
+	return values
+}
+
+func (index *tableIndex) add(row map[string]any, rowIndex int) {
+	values := index.values(row)
+	if index.ordered != nil {
+		index.ordered.Insert(indexEntry{values: values, index: rowIndex})
+		return
+	}
+	key := hashKey(values)
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	rows, ok := index.hash[key]
+	if !ok {
+		rows = make(map[int]struct{})
+		index.hash[key] = rows
+	}
+	rows[rowIndex] = struct{}{}
+}
+
+func (index *tableIndex) remove(row map[string]any, rowIndex int) {
+	values := index.values(row)
+	if index.ordered != nil {
+		index.ordered.Delete(indexEntry{values: values, index: rowIndex})
+		return
+	}
+	key := hashKey(values)
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if rows, ok := index.hash[key]; ok {
+		delete(rows, rowIndex)
+		if len(rows) == 0 {
+			delete(index.hash, key)
+		}
+	}
+}
+
+func (index *tableIndex) clear() {
+	if index.ordered != nil {
+		index.ordered.Clear()
+		return
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	clear(index.hash)
+}
+
+// changed tells whether the row moves within the index when oldRow is replaced by newRow.
+func (index *tableIndex) changed(oldRow, newRow map[string]any) bool {
+	for _, column := range index.definition.Columns {
+		if utils.ValueKey(oldRow[column]) != utils.ValueKey(newRow[column]) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the indexes of the rows holding values in the leading columns of the index, a HASH index needs a value for each column.
+func (index *tableIndex) lookup(values []any) []int {
+	if index.ordered == nil {
+		index.mutex.RLock()
+		defer index.mutex.RUnlock()
+		rows := index.hash[hashKey(values)]
+		indexes := make([]int, 0, len(rows))
+		for rowIndex := range rows {
+			indexes = append(indexes, rowIndex)
+		}
+		return indexes
+	}
+	var indexes []int
+	index.ordered.Ascend(&indexEntry{values: values, index: math.MinInt}, func(entry indexEntry) bool {
+		for i, value := range values {
+			if compareIndexValues(entry.values[i], value) != 0 {
+				return false
+			}
+		}
+		indexes = append(indexes, entry.index)
+		return true
+	})
+	return indexes
+}
+
+// walkRange walks the entries whose first value lies between from and to, NULL excluded.
+func (index *tableIndex) walkRange(from, to *RangeBound, descending bool, visit func(entry indexEntry) bool) {
+	if descending {
+		var start *indexEntry
+		if to != nil {
+			start = &indexEntry{values: []any{to.Value}, index: math.MinInt}
+			if to.Inclusive {
+				start.index = math.MaxInt
+			}
+		}
+		index.ordered.Descend(start, func(entry indexEntry) bool {
+			if entry.values[0] == nil {
+				return false
+			}
+			if from != nil {
+				result := compareIndexValues(entry.values[0], from.Value)
+				if result < 0 || result == 0 && !from.Inclusive {
+					return false
+				}
+			}
+			return visit(entry)
+		})
+		return
+	}
+	start := &indexEntry{values: []any{nil}, index: math.MaxInt}
+	if from != nil {
+		start = &indexEntry{values: []any{from.Value}, index: math.MaxInt}
+		if from.Inclusive {
+			start.index = math.MinInt
+		}
+	}
+	index.ordered.Ascend(start, func(entry indexEntry) bool {
+		if entry.values[0] == nil {
+			// only reached through a NULL bound, which no value lies beyond
+			return false
+		}
+		if to != nil {
+			result := compareIndexValues(entry.values[0], to.Value)
+			if result > 0 || result == 0 && !to.Inclusive {
+				return false
+			}
+		}
+		return visit(entry)
+	})
+}
+
+func (set *indexSet) each(consumer func(index *tableIndex)) {
+	for _, index := range set.ordered {
+		consumer(index)
+	}
+	for _, index := range set.created {
+		consumer(index)
+	}
+}
+
+func (set *indexSet) addRow(row map[string]any, rowIndex int) {
+	set.each(func(index *tableIndex) {
+		index.add(row, rowIndex)
+	})
+}
+
+func (set *indexSet) removeRow(row map[string]any, rowIndex int) {
+	set.each(func(index *tableIndex) {
+		index.remove(row, rowIndex)
+	})
+}
+
+// equalityIndex returns a created index that finds rows by the value of column alone, nil when there is none.
+func (set *indexSet) equalityIndex(column string) *tableIndex {
+	for _, index := range set.created {
+		columns := index.definition.Columns
+		if index.ready.Load() && columns[0] == column && (index.ordered != nil || len(columns) == 1) {
+			return index
+		}
+	}
+	return nil
+}
+
+// orderedIndex returns the index keeping the rows ordered by column, nil when there is none.
+func (set *indexSet) orderedIndex(column string) *tableIndex {
+	if index, ok := set.ordered[column]; ok && index.ready.Load() {
+		return index
+	}
+	for _, index := range set.created {
+		if index.ready.Load() && index.ordered != nil && index.definition.Columns[0] == column {
+			return index
+		}
+	}
+	return nil
+}
+
+// Options returns the settings of the table.
+func (tdm *DataTable) Options() TableOptions {
+	return tdm.indexes.Load().options
+}
+
+// SetOptions changes the settings of the table. Switching auto indexing off drops the value buckets and ordered indexes
+// kept for every column, switching it on builds them from the stored rows. Setting a limit starts tracking the usage of the rows.
+func (tdm *DataTable) SetOptions(options TableOptions) {
+	tdm.indexMutex.Lock()
+	defer tdm.indexMutex.Unlock()
+	defer tdm.updateUsageTracking()
+	current := tdm.indexes.Load()
+	next := &indexSet{options: options, created: current.created}
+	if options.DisableAutoIndex {
+		tdm.indexes.Store(next)
+		if !current.options.DisableAutoIndex {
+			tdm.releaseReferences()
+			tdm.valueToReferenceMap.Clear()
+		}
+		return
+	}
+
+	if current.ordered != nil {
+		next.ordered = current.ordered
+		tdm.indexes.Store(next)
+		return
+	}
+	var orderedIndexes []*tableIndex
+	if tdm.schema != nil {
+		// schemaless tables keep no ordered indexes since their columns may mix values that do not compare
+		next.ordered = make(map[string]*tableIndex, len(tdm.schema.Columns))
+		for _, column := range tdm.schema.Columns {
+			index := newTableIndex(IndexDefinition{Name: column.Name, Kind: IndexKindBTree, Columns: []string{column.Name}})
+			next.ordered[column.Name] = index
+			orderedIndexes = append(orderedIndexes, index)
+		}
+	}
+	tdm.indexes.Store(next)
+	if current.options.DisableAutoIndex {
+		tdm.eachRow(func(index int, row map[string]any) bool {
+			expiration, ok := tdm.liveRows.Expiration(index)
+			if !ok {
+				return true
+			}
+			wrappedNode := WrapperNode{Index: index}
+			for key, value := range row {
+				tdm.addReference(key, value, wrappedNode, expiration)
+			}
+			return true
+		})
+	}
+	for _, index := range orderedIndexes {
+		// only unique indexes fail to fill
+		_ = tdm.fillIndex(index)
+	}
+}
+
+// CreateIndex adds an index to the table and fills it from the stored rows. Writes keep the index up to date while it is filled,
+// lookups only use it once it holds every row.
+func (tdm *DataTable) CreateIndex(definition IndexDefinition) error {
+	if len(definition.Columns) == 0 {
+		return errors.New("index must have at least one column")
+	}
+	columns := make([]string, len(definition.Columns))
+	for i, name := range definition.Columns {
+		columns[i] = name
+		if tdm.schema != nil {
+			column, ok := tdm.schema.Column(name)
+			if !ok {
+				return fmt.Errorf("key column '%s' doesn't exist in table", name)
+			}
+			columns[i] = column.Name
+		}
+		for _, previous := range columns[:i] {
+			if strings.EqualFold(previous, columns[i]) {
+				return fmt.Errorf("duplicate column name '%s'", name)
+			}
+		}
+	}
+	definition.Columns = columns
+	if definition.Primary {
+		if tdm.schema == nil {
+			return errors.New("a PRIMARY KEY needs a table schema")
+		}
+		for _, name := range columns {
+			if column, _ := tdm.schema.Column(name); column.Nullable {
+				return fmt.Errorf("all parts of a PRIMARY KEY must be NOT NULL, column '%s' is nullable", name)
+			}
+		}
+		definition.Name = PrimaryKeyName
+		definition.Unique = true
+	}
+
+	tdm.indexMutex.Lock()
+	current := tdm.indexes.Load()
+	for _, index := range current.created {
+		if definition.Primary && index.definition.Primary {
+			tdm.indexMutex.Unlock()
+			return errors.New("multiple primary key defined")
+		}
+		if strings.EqualFold(index.definition.Name, definition.Name) {
+			tdm.indexMutex.Unlock()
+			return ErrIndexExists
+		}
+	}
+	index := newTableIndex(definition)
+	next := *current
+	next.created = append(append([]*tableIndex(nil), current.created...), index)
+	tdm.indexes.Store(&next)
+	tdm.indexMutex.Unlock()
+
+	if err := tdm.fillIndex(index); err != nil {
+		tdm.removeIndex(func(created *tableIndex) bool {
+			return created == index
+		})
+		return err
+	}
+	return nil
+}
+
+// fillIndex adds the stored rows to an index writes already keep up to date, a row written meanwhile is added twice at worst.
+// A unique index fails on the first row holding the values of another one, writes do not check it before it is ready.
+func (tdm *DataTable) fillIndex(index *tableIndex) error {
+	var err error
+	tdm.eachRow(func(rowIndex int, row map[string]any) bool {
+		if index.definition.Unique && !hasNull(index.values(row)) && len(tdm.conflictingRows(index, row, map[int]struct{}{rowIndex: {}})) > 0 {
+			err = duplicateEntry(index, row)
+			return false
+		}
+		index.add(row, rowIndex)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	index.ready.Store(true)
+	return nil
+}
+
+// DropIndex removes an index created on the table, the primary key is dropped by the name PrimaryKeyName.
+func (tdm *DataTable) DropIndex(name string) error {
+	if !tdm.removeIndex(func(index *tableIndex) bool {
+		return strings.EqualFold(index.definition.Name, name)
+	}) {
+		return ErrIndexNotExists
+	}
+	return nil
+}
+
+// removeIndex removes the first created index matching match and tells whether there was one.
+func (tdm *DataTable) removeIndex(match func(index *tableIndex) bool) bool {
+	tdm.indexMutex.Lock()
+	defer tdm.indexMutex.Unlock()
+	current := tdm.indexes.Load()
+	for i, index := range current.created {
+		if match(index) {
+			next := *current
+			next.created = append(append([]*tableIndex(nil), current.created[:i]...), current.created[i+1:]...)
+			tdm.indexes.Store(&next)
+			index.clear()
+			return true
+		}
+	}
+	return false
+}
+
+// Indexes returns the definitions of the indexes created on the table in the order they were created.
+func (tdm *DataTable) Indexes() []IndexDefinition {
+	created := tdm.indexes.Load().created
+	definitions := make([]IndexDefinition, len(created))
+	for i, index := range created {
+		definitions[i] = index.definition
+		definitions[i].Columns = append([]string(nil), index.definition.Columns...)
+	}
+	return definitions
+}
+
+// HasLookupIndex tells whether RowIndexes and LookupRows can find the rows holding a value in column without a scan.
+func (tdm *DataTable) HasLookupIndex(column string) bool {
+	set := tdm.indexes.Load()
+	return !set.options.DisableAutoIndex || set.equalityIndex(column) != nil
+}
+
+// HasOrderedIndex tells whether the rows can be walked in the order of column.
+func (tdm *DataTable) HasOrderedIndex(column string) bool {
+	return tdm.indexes.Load().orderedIndex(column) != nil
+}
+
+// CompositeRowIndexes finds the rows holding values through the created index covering most of their columns, a HASH index
+// needs a value for each of its columns and a BTREE one for a prefix of them. It returns false when no index covers two columns.
+func (tdm *DataTable) CompositeRowIndexes(values map[string]any) ([]int, bool) {
+	var best *tableIndex
+	bestColumns := 1
+	for _, index := range tdm.indexes.Load().created {
+		if !index.ready.Load() {
+			continue
+		}
+		matched := 0
+		for _, column := range index.definition.Columns {
+			if _, ok := values[column]; !ok {
+				break
+			}
+			matched++
+		}
+		if index.ordered == nil && matched < len(index.definition.Columns) {
+			continue
+		}
+		if matched > bestColumns {
+			best, bestColumns = index, matched
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	lookupValues := make([]any, bestColumns)
+	for i := range lookupValues {
+		lookupValues[i] = values[best.definition.Columns[i]]
+	}
+	return best.lookup(lookupValues), true
+}
+
+// RangeRowIndexes returns the indexes of the rows whose column lies between from and to, a nil bound leaves its side open.
+// NULL is never part of a range. It returns false when no index keeps the rows ordered by column.
+func (tdm *DataTable) RangeRowIndexes(column string, from, to *RangeBound) ([]int, bool) {
+	index := tdm.indexes.Load().orderedIndex(column)
+	if index == nil {
+		return nil, false
+	}
+	var indexes []int
+	index.walkRange(from, to, false, func(entry indexEntry) bool {
+		indexes = append(indexes, entry.index)
+		return true
+	})
+	return indexes, true
+}
+
+// OrderedRows walks the rows in the order of column until consumer returns false. With a bound only the rows between from and to
+// are walked and NULL is skipped, without one NULL comes first when nullsFirst is set and last otherwise, whatever the direction.
+// Rows with equal values come in the order they were inserted. It returns false when no index keeps the rows ordered by column.
+func (tdm *DataTable) OrderedRows(column string, from, to *RangeBound, descending, nullsFirst bool, consumer func(index int, row map[string]any) bool) bool {
+	index := tdm.indexes.Load().orderedIndex(column)
+	if index == nil {
+		return false
+	}
+	stopped := false
+	visit := func(entry indexEntry) bool {
+		row, ok := tdm.row(entry.index)
+		// the entry of an expired row stays in the index, and the entry of a row being updated may still hold its old value
+		if !ok || compareIndexValues(row[column], entry.values[0]) != 0 {
+			return true
+		}
+		if !consumer(entry.index, row) {
+			stopped = true
+		}
+		return !stopped
+	}
+	walkNulls := func() {
+		index.ordered.Ascend(nil, func(entry indexEntry) bool {
+			return entry.values[0] == nil && visit(entry)
+		})
+	}
+
+	bounded := from != nil || to != nil
+	if !bounded && nullsFirst {
+		walkNulls()
+	}
+	if !stopped {
+		index.walkRange(from, to, descending, visit)
+	}
+	if !bounded && !nullsFirst && !stopped {
+		walkNulls()
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package map_table
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+)
+
+// ColumnType is the family of values a column stores, several SQL types share one family.
+type ColumnType int
+
+const (
+	ColumnTypeInt ColumnType = iota
+	ColumnTypeFloat
+	ColumnTypeDecimal
+	ColumnTypeString
+	ColumnTypeBool
+	ColumnTypeBytes
+	ColumnTypeTime
+)
+
+func (columnType ColumnType) String() string {
+	switch columnType {
+	case ColumnTypeInt:
+		return "INT"
+	case ColumnTypeFloat:
+		return "FLOAT"
+	case ColumnTypeDecimal:
+		return "DECIMAL"
+	case ColumnTypeString:
+		return "STRING"
+	case ColumnTypeBool:
+		return "BOOL"
+	case ColumnTypeBytes:
+		return "BYTES"
+	case ColumnTypeTime:
+		return "TIME"
+	default:
+		return fmt.Sprintf("ColumnType(%d)", int(columnType))
+	}
+}
+
+type ColumnDefinition struct {
+	Name string
+	Type ColumnType
+	// SQLType is the type as it was declared, e.g. "varchar" or "datetime"
+	SQLType    string
+	Nullable   bool
+	Default    any
+	HasDefault bool
+}
+
+type TableSchema struct {
+	Columns     []ColumnDefinition
+	columnIndex map[string]int
+}
+
+func NewTableSchema(columns []ColumnDefinition) (*TableSchema, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table must have at least one column")
+	}
+	schema := &TableSchema{
+		Columns:     columns,
+		columnIndex: make(map[string]int, len(columns)),
+	}
+	for i, column := range columns {
+		key := strings.ToLower(column.Name)
+		if _, ok := schema.columnIndex[key]; ok {
+			return nil, fmt.Errorf("duplicate column name '%s'", column.Name)
+		}
+		schema.columnIndex[key] = i
+	}
+	return schema, nil
+}
+
+// Column finds a column by name, names are case-insensitive like in MySQL.
+func (schema *TableSchema) Column(name string) (*ColumnDefinition, bool) {
+	if i, ok := schema.columnIndex[strings.ToLower(name)]; ok {
+		return &schema.Columns[i], true
+	}
+	return nil, false
+}
+
+// ColumnTypeOf returns the column type a stored value belongs to, false for NULL and values of unknown types.
+func ColumnTypeOf(value any) (ColumnType, bool) {
+	switch value.(type) {
+	case int64, int, int32, uint64:
+		return ColumnTypeInt, true
+	case float64, float32:
+		return ColumnTypeFloat, true
+	case decimal.Decimal:
+		return ColumnTypeDecimal, true
+	case string:
+		return ColumnTypeString, true
+	case bool:
+		return ColumnTypeBool, true
+	case []byte:
+		return ColumnTypeBytes, true
+	case time.Time:
+		return ColumnTypeTime, true
+	}
+	return 0, false
+}
@@ -11,6 +11,13 @@ var (
 	atomicDatabaseRegistry atomic.Pointer[map_data_structure.TTLMap[string, map_data_structure.TTLMap[string, DataTable]]]
 )
 
+var (
+	ErrDatabaseExists    = errors.New("database already exists")
+	ErrDatabaseNotExists = errors.New("database not exists")
+	ErrTableExists       = errors.New("table already exists")
+	ErrTableNotExists    = errors.New("table not exists")
+)
+
 func InitDataBase() {
 	databaseWrapper := map_data_structure.NewTTLMap[string, map_data_structure.TTLMap[string, DataTable]]()
 	atomicDatabaseRegistry.Store(databaseWrapper)
@@ -19,37 +26,98 @@ func InitDataBase() {
 func CreateDatabase(databaseName string) error {
 	databaseName = utils.GetDefaultDatabaseName(databaseName)
 	database := map_data_structure.NewTTLMap[string, DataTable]()
+	// of concurrent creates of one database only the first stores it
+	if _, loaded := atomicDatabaseRegistry.Load().GetOrSet(databaseName, database, -1); loaded {
+		database.Release()
+		return ErrDatabaseExists
+	}
+	return nil
+}
+
+// DropDatabase removes the database with all of its tables and releases their memory.
+func DropDatabase(databaseName string) error {
+	databaseName = utils.GetDefaultDatabaseName(databaseName)
 	databaseWrapper := atomicDatabaseRegistry.Load()
-	databaseWrapper.Set(databaseName, database, -1)
+	database, ok := databaseWrapper.Get(databaseName)
+	if !ok {
+		return ErrDatabaseNotExists
+	}
+	databaseWrapper.Delete(databaseName)
+	database.Items(func(_ string, table *DataTable) bool {
+		table.Release()
+		return true
+	})
+	database.Release()
 	return nil
 }
 
 func CreateTable(databaseName string, tableName string) error {
+	return CreateTableWithSchema(databaseName, tableName, nil)
+}
+
+// CreateTableWithSchema creates a table whose rows are checked against schema, a nil schema creates a schemaless table.
+func CreateTableWithSchema(databaseName string, tableName string, schema *TableSchema) error {
+	return CreateTableWithOptions(databaseName, tableName, schema, TableOptions{})
+}
+
+// CreateTableWithOptions works like CreateTableWithSchema and applies the settings of the table.
+func CreateTableWithOptions(databaseName string, tableName string, schema *TableSchema, options TableOptions) error {
 	databaseName = utils.GetDefaultDatabaseName(databaseName)
 	if tableName == "" {
 		return errors.New("table name is empty")
 	}
 	if database, ok := atomicDatabaseRegistry.Load().Get(databaseName); ok {
 		if _, ok := database.Get(tableName); ok {
-			return errors.New("table already exists")
+			return ErrTableExists
 		}
 		table := NewDataTable(tableName)
-		database.Set(tableName, table, -1)
+		table.schema = schema
+		table.SetOptions(options)
+		if _, loaded := database.GetOrSet(tableName, table, -1); loaded {
+			table.Release()
+			return ErrTableExists
+		}
 		return nil
 	} else {
-		return errors.New("database not exists")
+		return ErrDatabaseNotExists
 	}
 }
 
+// DropTable removes the table and releases its memory.
+func DropTable(databaseName string, tableName string) error {
+	databaseName = utils.GetDefaultDatabaseName(databaseName)
+	if database, ok := atomicDatabaseRegistry.Load().Get(databaseName); ok {
+		table, ok := database.Get(tableName)
+		if !ok {
+			return ErrTableNotExists
+		}
+		database.Delete(tableName)
+		table.Release()
+		return nil
+	} else {
+		return ErrDatabaseNotExists
+	}
+}
+
+// TruncateTable removes every row of the table and keeps the table.
+func TruncateTable(databaseName string, tableName string) error {
+	table, err := GetTable(databaseName, tableName)
+	if err != nil {
+		return err
+	}
+	table.Truncate()
+	return nil
+}
+
 func GetTable(databaseName string, tableName string) (*DataTable, error) {
 	databaseName = utils.GetDefaultDatabaseName(databaseName)
 	if database, ok := atomicDatabaseRegistry.Load().Get(databaseName); ok {
 		if table, ok := database.Get(tableName); ok {
 			return table, nil
 		} else {
-			return nil, errors.New("table not exists")
+			return nil, ErrTableNotExists
 		}
 	} else {
-		return nil, errors.New("database not exists")
+		return nil, ErrDatabaseNotExists
 	}
 }
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	sqlSession := newSession(t, "aggregate_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE employees (id int not null, department varchar(20), level int, salary int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL(`INSERT INTO employees (id, department, level, salary) VALUES
+		(1, 'Engineering', 1, 1000), (2, 'Engineering', 2, 3000), (3, 'Engineering', 2, 2000),
+		(4, 'Sales', 1, 500), (5, 'Sales', 1, NULL), (6, 'Support', 1, 800)`); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select count(*), count(salary), count(distinct department), sum(salary), min(salary), max(salary) from employees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rs.Rows))
+	}
+	row := rs.Rows[0]
+	if row["count(*)"] != int64(6) || row["count(salary)"] != int64(5) || row["count(distinct department)"] != int64(3) ||
+		row["sum(salary)"] != int64(7300) || row["min(salary)"] != int64(500) || row["max(salary)"] != int64(3000) {
+		t.Fatalf("unexpected totals %#v", row)
+	}
+
+	rs, err = sqlSession.ExecuteSQL(`select department, count(*) as total, avg(salary) average from employees
+		group by department having count(*) > 1 order by total desc`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 2 {
+		t.Fatalf("expected 2 departments, got %#v", rs.Rows)
+	}
+	if rs.Rows[0]["department"] != "Engineering" || rs.Rows[0]["total"] != int64(3) || rs.Rows[0]["average"] != float64(2000) {
+		t.Fatalf("unexpected first group %#v", rs.Rows[0])
+	}
+	if rs.Rows[1]["department"] != "Sales" || rs.Rows[1]["total"] != int64(2) || rs.Rows[1]["average"] != float64(500) {
+		t.Fatalf("unexpected second group %#v", rs.Rows[1])
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select department, level, sum(salary) total from employees group by 1, level having total >= 1000 order by 1, 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 2 || rs.Rows[0]["level"] != int64(1) || rs.Rows[1]["level"] != int64(2) || rs.Rows[1]["total"] != int64(5000) {
+		t.Fatalf("unexpected groups %#v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select count(*), sum(salary) from employees where id > 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["count(*)"] != int64(0) || rs.Rows[0]["sum(salary)"] != nil {
+		t.Fatalf("expected one row with a zero count over no rows, got %#v", rs.Rows)
+	}
+
+	// columns are named after the expression as written, without backquotes around the identifiers
+	rs, err = sqlSession.ExecuteSQL("select min(`level`), max(employees.level), count(distinct `department`) from employees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["min(level)"] != int64(1) || rs.Rows[0]["max(employees.level)"] != int64(2) ||
+		rs.Rows[0]["count(distinct department)"] != int64(3) {
+		t.Fatalf("unexpected aggregate column names %#v", rs.Rows)
+	}
+
+	if _, err = sqlSession.ExecuteSQL("select id from employees where count(*) > 1"); err == nil {
+		t.Fatal("expected an aggregate in WHERE to fail")
+	}
+}
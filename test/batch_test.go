@@ -0,0 +1,106 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBatchExecution(t *testing.T) {
+	sqlSession := newSession(t, "batch_test")
+
+	expectValue := func(sql, column string, expected any) {
+		rs := mustExecute(t, sqlSession, sql)
+		if len(rs.Rows) != 1 || rs.Rows[0][column] != expected {
+			t.Fatalf("%s: expected %v, got %v", sql, expected, rs.Rows)
+		}
+	}
+
+	// several batches of rows, a tenth of them with NULL in score, and labels of which some read as numbers
+	mustExecute(t, sqlSession, "CREATE TABLE metrics (id int, kind varchar(10), score double, label varchar(10)) COMMENT 'auto_index=off'")
+	kinds := []string{"cpu", "disk", "net"}
+	for id := 0; id < 3000; id++ {
+		score := "NULL"
+		if id%10 != 0 {
+			score = fmt.Sprintf("%d.0", id%100)
+		}
+		label := fmt.Sprintf("'%d'", id%7)
+		if id%2 == 0 {
+			label = "'even'"
+		}
+		mustExecute(t, sqlSession, fmt.Sprintf("INSERT INTO metrics (id, kind, score, label) VALUES (%d, '%s', %s, %s)", id, kinds[id%3], score, label))
+	}
+
+	expectCount(t, sqlSession, "select id from metrics where id >= 2500", 500)
+	expectCount(t, sqlSession, "select id from metrics where 2500 <= id", 500)
+	expectCount(t, sqlSession, "select id from metrics where kind = 'disk'", 1000)
+	expectCount(t, sqlSession, "select id from metrics where kind != 'disk'", 2000)
+	expectCount(t, sqlSession, "select id from metrics where kind in ('cpu', 'net', NULL)", 2000)
+	expectCount(t, sqlSession, "select id from metrics where score = 55", 30)
+	expectCount(t, sqlSession, "select id from metrics where score > 54.5 and score <= 55", 30)
+	expectCount(t, sqlSession, "select id from metrics where score between 95 and 99", 150)
+	expectCount(t, sqlSession, "select id from metrics where score is null", 300)
+	expectCount(t, sqlSession, "select id from metrics where score is not null and kind = 'cpu'", 900)
+	expectCount(t, sqlSession, "select id from metrics where score = NULL", 0)
+	expectCount(t, sqlSession, "select id from metrics where kind = 'cpu' or score < 2", 1020)
+	expectCount(t, sqlSession, "select id from metrics where not (kind = 'cpu')", 2000)
+	// a text compares with a number numerically when it reads as one
+	expectCount(t, sqlSession, "select id from metrics where label = 3", 215)
+	expectCount(t, sqlSession, "select id from metrics where label in (3, 'even')", 1500+215)
+	expectCount(t, sqlSession, "select id from metrics where id + 1 = 3000", 1)
+
+	rs := mustExecute(t, sqlSession, "select id, kind from metrics where kind = 'net' and id > 1000 limit 3 offset 2")
+	if len(rs.Rows) != 3 || rs.Rows[0]["id"] != int64(1007) || rs.Rows[2]["id"] != int64(1013) {
+		t.Fatalf("expected rows 1007 to 1013, got %v", rs.Rows)
+	}
+	if _, ok := rs.Rows[0]["score"]; ok {
+		t.Fatalf("expected only the selected columns, got %v", rs.Rows[0])
+	}
+	expectCount(t, sqlSession, "select * from metrics limit 0", 0)
+
+	expectValue("select count(*) from metrics where kind = 'cpu'", "count(*)", int64(1000))
+	expectValue("select count(score) from metrics", "count(score)", int64(2700))
+	expectValue("select sum(id) from metrics where id < 2000", "sum(id)", int64(1999*2000/2))
+	expectValue("select sum(score) from metrics where id < 100", "sum(score)", float64(4500))
+	expectValue("select avg(score) from metrics where id < 10", "avg(score)", float64(5))
+	expectValue("select min(kind) from metrics", "min(kind)", "cpu")
+	expectValue("select max(score) from metrics", "max(score)", float64(99))
+	expectValue("select max(label) from metrics", "max(label)", "even")
+	expectValue("select sum(score) from metrics where id > 5000", "sum(score)", nil)
+	expectValue("select count(*) from metrics where id > 5000", "count(*)", int64(0))
+	rs = mustExecute(t, sqlSession, "select kind, count(*) as total from metrics where id >= 3 group by kind order by kind")
+	if len(rs.Rows) != 3 || rs.Rows[0]["total"] != int64(999) || rs.Rows[1]["kind"] != "disk" {
+		t.Fatalf("expected the groups of kind, got %v", rs.Rows)
+	}
+
+	// DELETE and UPDATE find their rows with the same filters
+	if rs := mustExecute(t, sqlSession, "DELETE FROM metrics WHERE kind = 'net' AND id >= 1500"); rs.RowsAffected != 500 {
+		t.Fatalf("expected 500 deleted rows, got %d", rs.RowsAffected)
+	}
+	if rs := mustExecute(t, sqlSession, "UPDATE metrics SET kind = 'gpu' WHERE kind = 'disk' AND score IS NULL"); rs.RowsAffected != 100 {
+		t.Fatalf("expected 100 updated rows, got %d", rs.RowsAffected)
+	}
+	expectValue("select count(*) from metrics where kind = 'gpu'", "count(*)", int64(100))
+	expectValue("select count(*) from metrics", "count(*)", int64(2500))
+
+	// a row inserted through the table may lack a column, and rows that expired are skipped before the cleaner removes them
+	mustExecute(t, sqlSession, "CREATE TABLE events (id int, owner varchar(10)) COMMENT 'auto_index=off'")
+	events := mustTable(t, "batch_test", "events")
+	for id := 0; id < 1500; id++ {
+		row := map[string]any{"id": int64(id)}
+		if id%2 == 0 {
+			row["owner"] = "alice"
+		}
+		ttl := time.Duration(-1)
+		if id%3 == 0 {
+			ttl = time.Millisecond
+		}
+		if err := events.Insert(row, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	expectValue("select count(*) from events", "count(*)", int64(1000))
+	expectValue("select count(*) from events where owner = 'alice'", "count(*)", int64(500))
+	expectValue("select count(*) from events where owner is null", "count(*)", int64(500))
+}
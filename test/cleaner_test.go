@@ -0,0 +1,80 @@
+package test
+
+import (
+	"a-eighty/data_structure/map"
+	"testing"
+	"time"
+)
+
+func TestCleaner(t *testing.T) {
+	map_data_structure.ConfigureCleaner(map_data_structure.CleanerOptions{Resolution: 10 * time.Millisecond, MaxExpirationsPerTick: 100})
+	defer map_data_structure.ConfigureCleaner(map_data_structure.CleanerOptions{})
+
+	waitForLen := func(ttlMap *map_data_structure.TTLMap[int, string], expected int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for ttlMap.Len() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d items to be left, got %d", expected, ttlMap.Len())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	ttlMap := map_data_structure.NewTTLMap[int, string]()
+	value := "value"
+	for i := 0; i < 1000; i++ {
+		ttlMap.Set(i, &value, 30*time.Millisecond)
+	}
+	ttlMap.Set(1000, &value, -1)
+	// an item set again or given a new expiration is not deleted at its old expiration
+	ttlMap.Set(0, &value, time.Hour)
+	expiration, _ := ttlMap.Expiration(1)
+	ttlMap.SetExpiration(1, expiration+int64(time.Hour))
+	// one entry scheduled past the span of every level of the wheel
+	ttlMap.Set(2, &value, 100*365*24*time.Hour)
+
+	time.Sleep(45 * time.Millisecond)
+	// the expired items are spread over ten ticks of at most a hundred deletions
+	if length := ttlMap.Len(); length <= 4 {
+		t.Fatalf("expected the burst of expirations to take several ticks, %d items are left", length)
+	}
+	waitForLen(ttlMap, 4)
+	for _, key := range []int{0, 1, 2, 1000} {
+		if _, ok := ttlMap.Get(key); !ok {
+			t.Fatalf("expected item %d to be kept", key)
+		}
+	}
+
+	// a longer resolution keeps the scheduled items
+	ttlMap.Set(3, &value, 50*time.Millisecond)
+	map_data_structure.ConfigureCleaner(map_data_structure.CleanerOptions{Resolution: 20 * time.Millisecond})
+	waitForLen(ttlMap, 4)
+
+	// refreshing an item keeps its one entry, which finds the item still live and schedules it again
+	scheduled := map_data_structure.ScheduledExpirations()
+	for i := 0; i < 1000; i++ {
+		ttlMap.Set(4, &value, 100*time.Millisecond)
+		ttlMap.SetExpiration(4, time.Now().Add(100*time.Millisecond).UnixNano())
+	}
+	if added := map_data_structure.ScheduledExpirations() - scheduled; added > 1 {
+		t.Fatalf("expected a refreshed item to keep one entry, %d were added", added)
+	}
+	time.Sleep(60 * time.Millisecond)
+	ttlMap.SetExpiration(4, time.Now().Add(100*time.Millisecond).UnixNano())
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := ttlMap.Get(4); !ok {
+		t.Fatal("expected the refreshed item to be kept")
+	}
+	waitForLen(ttlMap, 4)
+	// an earlier expiration gets an entry of its own
+	ttlMap.SetExpiration(0, time.Now().Add(20*time.Millisecond).UnixNano())
+	waitForLen(ttlMap, 3)
+
+	released := map_data_structure.NewTTLMap[int, string]()
+	released.Set(1, &value, 10*time.Millisecond)
+	released.Release()
+	time.Sleep(50 * time.Millisecond)
+	if released.Len() != 0 {
+		t.Fatal("expected a released map to stay empty")
+	}
+}
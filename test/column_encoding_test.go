@@ -0,0 +1,51 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestColumnEncoding(t *testing.T) {
+	sqlSession := newSession(t, "column_encoding_test")
+
+	// without value buckets or indexes, equalities are answered from the encoded columns
+	mustExecute(t, sqlSession, "CREATE TABLE employees (id int, name varchar(20), department varchar(20), level int, score double) COMMENT 'auto_index=off'")
+	departments := []string{"Engineering", "Sales", "Support"}
+	for id := 0; id < 3000; id++ {
+		name := "NULL"
+		if id%10 != 0 {
+			// more distinct names than a dictionary takes
+			name = fmt.Sprintf("'name %d'", id)
+		}
+		mustExecute(t, sqlSession, fmt.Sprintf("INSERT INTO employees (id, name, department, level, score) VALUES (%d, %s, '%s', %d, %d)",
+			id, name, departments[id/1000], id/500, id%4))
+	}
+	table := mustTable(t, "column_encoding_test", "employees")
+	if indexes, ok := table.RowIndexes("department", "Sales"); !ok || len(indexes) != 1000 {
+		t.Fatalf("expected 1000 rows in Sales, got %d", len(indexes))
+	}
+	expectCount(t, sqlSession, "select id from employees where department = 'Engineering'", 1000)
+	expectCount(t, sqlSession, "select id from employees where department = 'Marketing'", 0)
+	expectCount(t, sqlSession, "select id from employees where department in ('Sales', 'Support')", 2000)
+	expectCount(t, sqlSession, "select id from employees where level = 3", 500)
+	expectCount(t, sqlSession, "select id from employees where score = 2", 750)
+	expectCount(t, sqlSession, "select id from employees where name = 'name 2999'", 1)
+	expectCount(t, sqlSession, "select id from employees where name is null", 300)
+
+	// changing a row of a run-length encoded segment keeps the other rows of the run intact
+	mustExecute(t, sqlSession, "UPDATE employees SET department = 'Marketing', level = 9 WHERE id = 10")
+	expectCount(t, sqlSession, "select id from employees where department = 'Engineering'", 999)
+	expectCount(t, sqlSession, "select id from employees where level = 0", 499)
+	rs := mustExecute(t, sqlSession, "select department, level from employees where department = 'Marketing'")
+	if len(rs.Rows) != 1 || rs.Rows[0]["level"] != int64(9) {
+		t.Fatalf("expected the updated row, got %v", rs.Rows)
+	}
+	mustExecute(t, sqlSession, "UPDATE employees SET score = 1.5 WHERE id = 11")
+	expectCount(t, sqlSession, "select id from employees where score = 1.5", 1)
+	expectCount(t, sqlSession, "select id from employees where score = 3", 749)
+
+	mustExecute(t, sqlSession, "DELETE FROM employees WHERE department = 'Support' AND level = 5")
+	expectCount(t, sqlSession, "select id from employees where department = 'Support'", 500)
+	mustExecute(t, sqlSession, "INSERT INTO employees (id, department) VALUES (5000, 'Support')")
+	expectCount(t, sqlSession, "select id from employees where department = 'Support'", 501)
+}
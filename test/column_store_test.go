@@ -0,0 +1,93 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"testing"
+	"time"
+)
+
+func TestColumnStore(t *testing.T) {
+	map_table.InitDataBase()
+	map_table.CreateDatabase("column_store_test")
+	if err := map_table.CreateTable("column_store_test", "events"); err != nil {
+		t.Fatal(err)
+	}
+	table, err := map_table.GetTable("column_store_test", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert := func(row map[string]any) {
+		if err := table.Insert(row, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a missing column is not NULL, and a column may change type from one row to the next
+	created := time.Unix(1700000000, 0)
+	insert(map[string]any{"id": int64(1), "kind": "click", "score": 1.5, "seen": true})
+	insert(map[string]any{"id": int64(2), "kind": nil, "at": created})
+	insert(map[string]any{"id": "three", "kind": "view", "payload": []byte("raw")})
+	rows := table.QueryWithCriteria(func(map[string]any) bool {
+		return true
+	}, nil, nil, nil)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %v", rows)
+	}
+	if len(rows[0]) != 4 || rows[0]["score"] != 1.5 || rows[0]["seen"] != true {
+		t.Fatalf("unexpected first row %v", rows[0])
+	}
+	if kind, ok := rows[1]["kind"]; !ok || kind != nil || len(rows[1]) != 3 || !rows[1]["at"].(time.Time).Equal(created) {
+		t.Fatalf("expected the second row to hold NULL in kind, got %v", rows[1])
+	}
+	if _, ok := rows[1]["score"]; ok {
+		t.Fatalf("expected the second row to lack score, got %v", rows[1])
+	}
+	if rows[2]["id"] != "three" || string(rows[2]["payload"].([]byte)) != "raw" {
+		t.Fatalf("unexpected third row %v", rows[2])
+	}
+
+	// a row handed out is a copy
+	rows[0]["kind"] = "changed"
+	if stored, _ := table.LookupRows("id", int64(1)); len(stored) != 1 || stored[0]["kind"] != "click" {
+		t.Fatalf("expected changing a returned row to leave the table alone, got %v", stored)
+	}
+
+	// an update may drop a column
+	if _, err := table.Update(func(row map[string]any) bool {
+		return row["id"] == int64(1)
+	}, func(row map[string]any) (map[string]any, error) {
+		return map[string]any{"id": row["id"], "kind": "tap"}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := table.LookupRows("kind", "tap"); len(stored) != 1 || len(stored[0]) != 2 {
+		t.Fatalf("expected the updated row to hold two columns, got %v", stored)
+	}
+
+	// rows deleted by whole segments are gone for good, later rows keep working
+	for i := 0; i < 3000; i++ {
+		insert(map[string]any{"id": int64(100 + i), "kind": "bulk", "score": float64(i)})
+	}
+	deleted, _ := table.Delete(func(row map[string]any) bool {
+		return row["kind"] == "bulk" && row["score"].(float64) < 2900
+	})
+	if deleted != 2900 {
+		t.Fatalf("expected 2900 rows to be deleted, got %d", deleted)
+	}
+	insert(map[string]any{"id": int64(5000), "kind": "bulk", "score": 0.5})
+	if bulk, _ := table.LookupRows("kind", "bulk"); len(bulk) != 101 {
+		t.Fatalf("expected 101 bulk rows, got %d", len(bulk))
+	}
+	index, ok := table.RowIndexes("id", int64(5000))
+	if !ok || len(index) != 1 || index[0] != 3004 {
+		t.Fatalf("expected the new row to get the next row ID, got %v", index)
+	}
+
+	table.Truncate()
+	insert(map[string]any{"id": int64(6000)})
+	if rows := table.QueryWithCriteria(func(map[string]any) bool {
+		return true
+	}, nil, nil, nil); len(rows) != 1 || rows[0]["id"] != int64(6000) {
+		t.Fatalf("expected one row after TRUNCATE, got %v", rows)
+	}
+}
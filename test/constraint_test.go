@@ -0,0 +1,158 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	sqlSession := newSession(t, "constraint_test")
+
+	expectDuplicate := func(sql string) {
+		if _, err := sqlSession.ExecuteSQL(sql); !errors.Is(err, map_table.ErrDuplicateEntry) {
+			t.Fatalf("%s: expected a duplicate entry, got %v", sql, err)
+		}
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE users (id int primary key, email varchar(50) unique, name varchar(20))")
+	mustExecute(t, sqlSession, "INSERT INTO users (id, email, name) VALUES (1, 'a@x', 'ann'), (2, 'b@x', 'bob'), (3, NULL, 'cid'), (4, NULL, 'dan')")
+	table, err := map_table.GetTable("constraint_test", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if column, _ := table.Schema().Column("id"); column.Nullable {
+		t.Fatal("expected the primary key column to be NOT NULL")
+	}
+	row, ok := table.GetByPrimaryKey(int64(2))
+	if !ok || row["name"] != "bob" {
+		t.Fatalf("expected bob by primary key, got %v", row)
+	}
+	if _, ok := table.GetByPrimaryKey(int64(9)); ok {
+		t.Fatal("expected no row for a missing key")
+	}
+
+	_, err = sqlSession.ExecuteSQL("INSERT INTO users (id, email, name) VALUES (1, 'c@x', 'eve')")
+	if !errors.Is(err, map_table.ErrDuplicateEntry) || err.Error() != "duplicate entry '1' for key 'PRIMARY'" {
+		t.Fatalf("expected a duplicate primary key, got %v", err)
+	}
+	expectDuplicate("INSERT INTO users (id, email, name) VALUES (5, 'a@x', 'eve')")
+	expectDuplicate("INSERT INTO users (id, email, name) VALUES (5, 'e@x', 'eve'), (6, 'e@x', 'fay')")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO users (email, name) VALUES ('g@x', 'gus')"); err == nil {
+		t.Fatal("expected a missing primary key to fail")
+	}
+	mustExecute(t, sqlSession, "INSERT INTO users (id, email, name) VALUES (5, NULL, 'eve')")
+	expectCount(t, sqlSession, "select id from users", 5)
+
+	expectCount(t, sqlSession, "select name from users where id = 2", 1)
+	expectCount(t, sqlSession, "select name from users where id = 2 and name = 'ann'", 0)
+	expectCount(t, sqlSession, "select name from users where id = '3'", 1)
+	expectCount(t, sqlSession, "select name from users where id = NULL", 0)
+	expectCount(t, sqlSession, "select name from users where id = 7", 0)
+
+	expectDuplicate("UPDATE users SET email = 'a@x' WHERE id = 2")
+	expectDuplicate("UPDATE users SET id = 1")
+	mustExecute(t, sqlSession, "UPDATE users SET id = 12 WHERE id = 2")
+	mustExecute(t, sqlSession, "UPDATE users SET email = 'b@x', name = 'bea' WHERE id = 12")
+	if row, ok := table.GetByPrimaryKey(int64(12)); !ok || row["name"] != "bea" {
+		t.Fatalf("expected the updated row by its new key, got %v", row)
+	}
+	if rs := mustExecute(t, sqlSession, "DELETE FROM users WHERE id = 1"); rs.RowsAffected != 1 {
+		t.Fatalf("expected one deleted row, got %d", rs.RowsAffected)
+	}
+	mustExecute(t, sqlSession, "INSERT INTO users (id, email, name) VALUES (1, 'a@x', 'amy')")
+
+	mustExecute(t, sqlSession, "CREATE TABLE memberships (user_id int not null, team varchar(10) not null, role varchar(10), primary key (user_id, team))")
+	mustExecute(t, sqlSession, "INSERT INTO memberships (user_id, team, role) VALUES (1, 'red', 'lead'), (1, 'blue', 'dev'), (2, 'red', 'dev')")
+	_, err = sqlSession.ExecuteSQL("INSERT INTO memberships (user_id, team, role) VALUES (1, 'blue', 'qa')")
+	if err == nil || err.Error() != "duplicate entry '1-blue' for key 'PRIMARY'" {
+		t.Fatalf("expected a duplicate composite key, got %v", err)
+	}
+	rs := mustExecute(t, sqlSession, "select role from memberships where team = 'blue' and user_id = 1")
+	if len(rs.Rows) != 1 || rs.Rows[0]["role"] != "dev" {
+		t.Fatalf("expected the dev membership, got %v", rs.Rows)
+	}
+
+	rs = mustExecute(t, sqlSession, "SHOW INDEX FROM users")
+	if len(rs.Rows) != 2 || rs.Rows[0]["Key_name"] != "PRIMARY" || rs.Rows[0]["Non_unique"] != int64(0) ||
+		rs.Rows[1]["Key_name"] != "email" || rs.Rows[1]["Index_type"] != "HASH" {
+		t.Fatalf("unexpected indexes %v", rs.Rows)
+	}
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE bad (id int null primary key)"); err == nil {
+		t.Fatal("expected a nullable primary key to fail")
+	}
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE bad (id int primary key, other int, primary key (other))"); err == nil {
+		t.Fatal("expected a second primary key to fail")
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE logs (level varchar(10), message varchar(50))")
+	mustExecute(t, sqlSession, "INSERT INTO logs (level, message) VALUES ('info', 'started'), ('info', 'started'), ('warn', 'slow')")
+	expectCount(t, sqlSession, "select level from logs where level = 'info'", 2)
+	expectCount(t, sqlSession, "select message from logs", 3)
+	expectDuplicate("CREATE UNIQUE INDEX by_message ON logs (message)")
+	logs, err := map_table.GetTable("constraint_test", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.Indexes()) != 0 {
+		t.Fatalf("expected the failed unique index to be dropped, got %v", logs.Indexes())
+	}
+	mustExecute(t, sqlSession, "DELETE FROM logs WHERE level = 'info'")
+	mustExecute(t, sqlSession, "CREATE UNIQUE INDEX by_message ON logs (message)")
+	expectDuplicate("INSERT INTO logs (level, message) VALUES ('error', 'slow')")
+	mustExecute(t, sqlSession, "ALTER TABLE users DROP PRIMARY KEY")
+	mustExecute(t, sqlSession, "INSERT INTO users (id, email, name) VALUES (1, NULL, 'abe')")
+	expectCount(t, sqlSession, "select name from users where id = 1", 2)
+}
+
+func TestConcurrentUniqueInserts(t *testing.T) {
+	sqlSession := newSession(t, "concurrent_constraint_test")
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE counters (id int primary key, hits int)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// every round the workers write the same key at once, the first insert wins and the upserts count on it
+	workers := 8
+	for round := 0; round < 200; round++ {
+		var inserted, updated atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		wg.Add(workers)
+		for worker := 0; worker < workers; worker++ {
+			go func() {
+				defer wg.Done()
+				<-start
+				sql := fmt.Sprintf("INSERT INTO counters (id, hits) VALUES (%d, 1)", round)
+				if worker%2 == 1 {
+					sql += " ON DUPLICATE KEY UPDATE hits = hits + 1"
+				}
+				rs, err := sqlSession.ExecuteSQL(sql)
+				switch {
+				case err == nil && rs.RowsAffected == 1:
+					inserted.Add(1)
+				case err == nil && rs.RowsAffected == 2:
+					updated.Add(1)
+				case err != nil && !errors.Is(err, map_table.ErrDuplicateEntry):
+					t.Error(err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		if inserted.Load() != 1 {
+			t.Fatalf("round %d: expected one insert to succeed, got %d", round, inserted.Load())
+		}
+		rs, err := sqlSession.ExecuteSQL(fmt.Sprintf("select hits from counters where id = %d", round))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the upserts that lost the race to insert each counted a hit
+		if len(rs.Rows) != 1 || rs.Rows[0]["hits"] != int64(1+updated.Load()) || updated.Load() < int32(workers/2-1) {
+			t.Fatalf("round %d: expected one row with %d hits, got %v", round, 1+updated.Load(), rs.Rows)
+		}
+	}
+}
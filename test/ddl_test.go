@@ -0,0 +1,96 @@
+package test
+
+import (
+	"a-eighty/mem_cache/data_query"
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDDL(t *testing.T) {
+	map_table.InitDataBase()
+	sqlSession := &data_query.SqlSession{
+		DatabaseName: "ddl_test",
+	}
+
+	mustExecute(t, sqlSession, "CREATE DATABASE ddl_test")
+	if _, err := sqlSession.ExecuteSQL("CREATE DATABASE ddl_test"); err == nil {
+		t.Fatal("expected creating an existing database to fail")
+	}
+	mustExecute(t, sqlSession, "CREATE DATABASE IF NOT EXISTS ddl_test")
+
+	mustExecute(t, sqlSession, "CREATE TABLE employees (id int, name varchar(10))")
+	mustExecute(t, sqlSession, "CREATE TABLE IF NOT EXISTS employees (id int, name varchar(10))")
+	mustExecute(t, sqlSession, "INSERT INTO employees (id, name) VALUES (1, 'a'), (2, 'b')")
+
+	mustExecute(t, sqlSession, "TRUNCATE TABLE employees")
+	if rs := mustExecute(t, sqlSession, "select * from employees where id > 0"); len(rs.Rows) != 0 {
+		t.Fatalf("expected no rows after truncate, got %d", len(rs.Rows))
+	}
+	mustExecute(t, sqlSession, "INSERT INTO employees (id, name) VALUES (3, 'c')")
+	if rs := mustExecute(t, sqlSession, "select * from employees where id > 0"); len(rs.Rows) != 1 {
+		t.Fatalf("expected 1 row after insert into truncated table, got %d", len(rs.Rows))
+	}
+
+	if _, err := sqlSession.ExecuteSQL("DROP TABLE employees, missing"); err == nil {
+		t.Fatal("expected dropping a missing table to fail")
+	}
+	mustExecute(t, sqlSession, "select * from employees where id > 0")
+	mustExecute(t, sqlSession, "DROP TABLE IF EXISTS employees, missing")
+	if _, err := sqlSession.ExecuteSQL("select * from employees where id > 0"); err == nil {
+		t.Fatal("expected select from a dropped table to fail")
+	}
+
+	mustExecute(t, sqlSession, "DROP DATABASE ddl_test")
+	if _, err := sqlSession.ExecuteSQL("DROP DATABASE ddl_test"); err == nil {
+		t.Fatal("expected dropping a missing database to fail")
+	}
+	mustExecute(t, sqlSession, "DROP DATABASE IF EXISTS ddl_test")
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	map_table.InitDataBase()
+	for round := 0; round < 200; round++ {
+		database := fmt.Sprintf("concurrent_%d", round)
+		var created, tables atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		wg.Add(8)
+		for worker := 0; worker < 8; worker++ {
+			go func() {
+				defer wg.Done()
+				<-start
+				if err := map_table.CreateDatabase(database); err == nil {
+					created.Add(1)
+				} else if !errors.Is(err, map_table.ErrDatabaseExists) {
+					t.Error(err)
+				}
+				err := map_table.CreateTable(database, "items")
+				if err == nil {
+					tables.Add(1)
+					table, err := map_table.GetTable(database, "items")
+					if err == nil {
+						err = table.Insert(map[string]any{"id": int64(worker)}, -1)
+					}
+					if err != nil {
+						t.Error(err)
+					}
+				} else if !errors.Is(err, map_table.ErrTableExists) {
+					t.Error(err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		if created.Load() != 1 || tables.Load() != 1 {
+			t.Fatalf("expected one create of the database and the table to succeed, got %d and %d", created.Load(), tables.Load())
+		}
+		// a create that lost the race did not replace the table holding the row
+		if rows := mustTable(t, database, "items").QueryWithCriteria(func(map[string]any) bool { return true }, nil, nil, nil); len(rows) != 1 {
+			t.Fatalf("expected the row of the created table, got %v", rows)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"testing"
+	"time"
+)
+
+func TestDefaultTTL(t *testing.T) {
+	sqlSession := newSession(t, "default_ttl_test")
+
+	mustExecute(t, sqlSession, "CREATE TABLE sessions (id int primary key, name varchar(20)) COMMENT 'login sessions, ttl=PT1S'")
+	table, err := map_table.GetTable("default_ttl_test", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Options().DefaultTTL != time.Second {
+		t.Fatalf("expected a default TTL of one second, got %v", table.Options().DefaultTTL)
+	}
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name) VALUES (1, 'short')")
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name, ttl) VALUES (2, 'long', 'PT1H'), (3, 'forever', NULL)")
+	mustExecute(t, sqlSession, "REPLACE INTO sessions (id, name) VALUES (4, 'replaced')")
+
+	mustExecute(t, sqlSession, "ALTER TABLE sessions COMMENT 'ttl=PT1H'")
+	if table.Options().DefaultTTL != time.Hour || table.Options().DisableAutoIndex {
+		t.Fatalf("expected only the default TTL to change, got %+v", table.Options())
+	}
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name) VALUES (5, 'after alter')")
+	mustExecute(t, sqlSession, "ALTER TABLE sessions COMMENT 'ttl=off'")
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name) VALUES (6, 'no default')")
+
+	time.Sleep(1100 * time.Millisecond)
+	expectNames(t, sqlSession, "select name from sessions order by id", "long", "forever", "after alter", "no default")
+
+	for _, sql := range []string{
+		"CREATE TABLE bad (id int) COMMENT 'ttl=soon'",
+		"ALTER TABLE sessions COMMENT 'ttl=PT0S'",
+	} {
+		if _, err := sqlSession.ExecuteSQL(sql); err == nil {
+			t.Fatalf("%s: expected an invalid TTL to fail", sql)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEviction(t *testing.T) {
+	sqlSession := newSession(t, "eviction_test")
+
+	// each statement gets its own access time
+	pause := func() {
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE recent (id int primary key, name varchar(20)) COMMENT 'max_rows=3, eviction=lru'")
+	recent := mustTable(t, "eviction_test", "recent")
+	events := make(chan map_table.RowEvent, 4)
+	recent.SubscribeChannel(events)
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (1, 'a')")
+	pause()
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (2, 'b')")
+	pause()
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (3, 'c')")
+	pause()
+	mustExecute(t, sqlSession, "select name from recent where id = 1")
+	pause()
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (4, 'd')")
+	expectIds(t, sqlSession, "select id from recent order by id", 1, 3, 4)
+	if event := <-events; event.Reason != map_table.RowEvicted || event.Row["id"] != int64(2) {
+		t.Fatalf("expected row 2 to be evicted, got %s for %v", event.Reason, event.Row)
+	}
+	// the evicted row leaves the value buckets too
+	if rows, _ := recent.LookupRows("name", "b"); len(rows) != 0 {
+		t.Fatalf("expected no row named b, got %v", rows)
+	}
+	if rows, memory, ok := recent.Usage(); !ok || rows != 3 || memory <= 0 {
+		t.Fatalf("expected the usage of 3 rows, got %d rows and %d bytes", rows, memory)
+	}
+	// lowering the limit evicts on the next insert
+	mustExecute(t, sqlSession, "ALTER TABLE recent MAX_ROWS = 2")
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (5, 'e')")
+	if rows, _, _ := recent.Usage(); rows != 2 {
+		t.Fatalf("expected 2 rows to be left, got %d", rows)
+	}
+	if _, ok := recent.GetByPrimaryKey(int64(5)); !ok {
+		t.Fatal("expected the inserted row to be kept")
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE frequent (id int primary key) COMMENT 'max_rows=3, eviction=lfu'")
+	mustExecute(t, sqlSession, "INSERT INTO frequent (id) VALUES (1), (2), (3)")
+	for i := 0; i < 3; i++ {
+		mustExecute(t, sqlSession, "select id from frequent where id in (1, 3)")
+	}
+	mustExecute(t, sqlSession, "select id from frequent where id = 2")
+	mustExecute(t, sqlSession, "INSERT INTO frequent (id) VALUES (4)")
+	expectIds(t, sqlSession, "select id from frequent order by id", 1, 3, 4)
+
+	mustExecute(t, sqlSession, "CREATE TABLE expiring (id int primary key) COMMENT 'max_rows=3, eviction=ttl'")
+	mustExecute(t, sqlSession, "INSERT INTO expiring (id, ttl) VALUES (1, 'PT1H'), (2, 'PT10M'), (3, NULL)")
+	mustExecute(t, sqlSession, "INSERT INTO expiring (id) VALUES (4)")
+	expectIds(t, sqlSession, "select id from expiring order by id", 1, 3, 4)
+
+	mustExecute(t, sqlSession, "CREATE TABLE bounded (id int primary key) COMMENT 'max_rows=1, eviction=none'")
+	mustExecute(t, sqlSession, "INSERT INTO bounded (id) VALUES (1)")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO bounded (id) VALUES (2)"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected the table to be full, got %v", err)
+	}
+	// a statement that does not fit writes none of its rows
+	mustExecute(t, sqlSession, "CREATE TABLE pair (id int primary key) COMMENT 'max_rows=2, eviction=none'")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO pair (id) VALUES (1), (2), (3)"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected the table to be full, got %v", err)
+	}
+	expectIds(t, sqlSession, "select id from pair order by id")
+	mustExecute(t, sqlSession, "INSERT INTO pair (id) VALUES (1)")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO pair (id) VALUES (2), (3)"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected the table to be full, got %v", err)
+	}
+	expectIds(t, sqlSession, "select id from pair order by id", 1)
+	mustExecute(t, sqlSession, "CREATE TABLE small (id int primary key, payload varchar(500)) COMMENT 'max_memory=600'")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO small (id, payload) VALUES (1, 'x'), (2, '" + strings.Repeat("x", 500) + "')"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected the table to be full, got %v", err)
+	}
+	expectIds(t, sqlSession, "select id from small order by id")
+	mustExecute(t, sqlSession, "DROP TABLE pair, small")
+	mustExecute(t, sqlSession, "ALTER TABLE bounded COMMENT 'max_rows=off'")
+	mustExecute(t, sqlSession, "INSERT INTO bounded (id) VALUES (2)")
+	if _, _, ok := mustTable(t, "eviction_test", "bounded").Usage(); ok {
+		t.Fatal("expected the usage not to be tracked without a limit")
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE sized (id int primary key, payload varchar(2000)) COMMENT 'max_memory=8K, eviction=random'")
+	payload := strings.Repeat("x", 1000)
+	for id := 0; id < 20; id++ {
+		mustExecute(t, sqlSession, fmt.Sprintf("INSERT INTO sized (id, payload) VALUES (%d, '%s')", id, payload))
+	}
+	sized := mustTable(t, "eviction_test", "sized")
+	if rows, memory, _ := sized.Usage(); memory > 8<<10 || rows < 5 || rows > 8 {
+		t.Fatalf("expected the rows to fit in 8K, got %d rows and %d bytes", rows, memory)
+	}
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO sized (id, payload) VALUES (100, '" + strings.Repeat(payload, 10) + "')"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected a row larger than the limit to be rejected, got %v", err)
+	}
+
+	// the global limit evicts from every table
+	map_table.SetGlobalLimits(map_table.GlobalLimits{MaxRows: 12, Eviction: map_table.EvictionLRU})
+	defer map_table.SetGlobalLimits(map_table.GlobalLimits{})
+	mustExecute(t, sqlSession, "INSERT INTO bounded (id) VALUES (3), (4), (5)")
+	total := int64(0)
+	for _, name := range []string{"recent", "frequent", "expiring", "bounded", "sized"} {
+		rows, _, ok := mustTable(t, "eviction_test", name).Usage()
+		if !ok {
+			t.Fatalf("expected the usage of %s to be tracked under a global limit", name)
+		}
+		total += rows
+	}
+	if total != 12 {
+		t.Fatalf("expected 12 rows in all tables, got %d", total)
+	}
+	expectIds(t, sqlSession, "select id from bounded order by id", 1, 2, 3, 4, 5)
+
+	for _, sql := range []string{
+		"CREATE TABLE bad (id int) COMMENT 'eviction=fifo'",
+		"CREATE TABLE bad (id int) COMMENT 'max_memory=lots'",
+		"CREATE TABLE bad (id int) COMMENT 'max_rows=-1'",
+	} {
+		if _, err := sqlSession.ExecuteSQL(sql); err == nil {
+			t.Fatalf("%s: expected an error", sql)
+		}
+	}
+}
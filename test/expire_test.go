@@ -0,0 +1,78 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	sqlSession := newSession(t, "expire_test")
+
+	mustExecute(t, sqlSession, "CREATE TABLE sessions (id int primary key, name varchar(20)) COMMENT 'ttl=PT1S'")
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name) VALUES (1, 'expired'), (2, 'extended'), (3, 'persisted'), (4, 'restarted')")
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, name, ttl) VALUES (5, 'forever', NULL), (6, 'defaulted', NULL)")
+
+	if rs := mustExecute(t, sqlSession, "UPDATE sessions SET ttl = 'PT1H' WHERE id = 2"); rs.RowsAffected != 1 {
+		t.Fatalf("expected the TTL of one row to change, got %d", rs.RowsAffected)
+	}
+	mustExecute(t, sqlSession, "UPDATE sessions SET ttl = NULL WHERE name = 'persisted'")
+	mustExecute(t, sqlSession, "UPDATE sessions SET ttl = DEFAULT WHERE id = 6")
+	rs := mustExecute(t, sqlSession, "select id, ttl() as ttl, expires_at() as expires_at from sessions where ttl() > 60 or expires_at() is null order by id")
+	if len(rs.Rows) != 3 || rs.Rows[0]["id"] != int64(2) || rs.Rows[0]["ttl"] != int64(3600) ||
+		rs.Rows[1]["ttl"] != int64(-1) || rs.Rows[1]["expires_at"] != nil || rs.Rows[2]["id"] != int64(5) {
+		t.Fatalf("unexpected expirations: %v", rs.Rows)
+	}
+	if expiresAt, ok := rs.Rows[0]["expires_at"].(time.Time); !ok || time.Until(expiresAt) < 59*time.Minute {
+		t.Fatalf("expected the extended row to expire in an hour, got %v", rs.Rows[0]["expires_at"])
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	mustExecute(t, sqlSession, "UPDATE sessions SET name = 'restarted!', ttl = DEFAULT WHERE id = 4")
+	if rs := mustExecute(t, sqlSession, "select count(*) as c from sessions where ttl() = 1"); rs.Rows[0]["c"] != int64(3) {
+		t.Fatalf("expected 3 rows about to expire, got %v", rs.Rows)
+	}
+	time.Sleep(600 * time.Millisecond)
+	expectNames(t, sqlSession, "select name from sessions order by id", "extended", "persisted", "restarted!", "forever")
+	if rs := mustExecute(t, sqlSession, "DELETE FROM sessions WHERE ttl() = -1"); rs.RowsAffected != 2 {
+		t.Fatalf("expected the rows that never expire to be deleted, got %d", rs.RowsAffected)
+	}
+	expectNames(t, sqlSession, "select name from sessions order by id", "extended", "restarted!")
+	// statements that match no row change none, rather than every row
+	if rs := mustExecute(t, sqlSession, "UPDATE sessions SET name = 'x', ttl = 'PT1H' WHERE id = 999"); rs.RowsAffected != 0 {
+		t.Fatalf("expected no row to be updated, got %d", rs.RowsAffected)
+	}
+	if rs := mustExecute(t, sqlSession, "DELETE FROM sessions WHERE ttl() = 5"); rs.RowsAffected != 0 {
+		t.Fatalf("expected no row to be deleted, got %d", rs.RowsAffected)
+	}
+	expectNames(t, sqlSession, "select name from sessions order by id", "extended", "restarted!")
+
+	// reading a row of a table with a sliding TTL keeps it alive
+	mustExecute(t, sqlSession, "CREATE TABLE cache (id int primary key, name varchar(20)) COMMENT 'ttl=PT1S, sliding_ttl=on'")
+	mustExecute(t, sqlSession, "INSERT INTO cache (id, name) VALUES (1, 'read'), (2, 'unread')")
+	mustExecute(t, sqlSession, "INSERT INTO cache (id, name, ttl) VALUES (3, 'forever', NULL)")
+	for i := 0; i < 2; i++ {
+		time.Sleep(600 * time.Millisecond)
+		expectNames(t, sqlSession, "select name from cache where id = 1", "read")
+	}
+	time.Sleep(200 * time.Millisecond)
+	expectNames(t, sqlSession, "select name from cache order by id", "read", "forever")
+	if rs := mustExecute(t, sqlSession, "select ttl() as ttl from cache where id = 3"); rs.Rows[0]["ttl"] != int64(-1) {
+		t.Fatalf("expected a read not to give an expiration to a row that never expires, got %v", rs.Rows)
+	}
+	mustExecute(t, sqlSession, "ALTER TABLE cache COMMENT 'sliding_ttl=off'")
+	if options := mustTable(t, "expire_test", "cache").Options(); options.SlidingTTL || options.DefaultTTL != time.Second {
+		t.Fatalf("expected only the sliding TTL to be turned off, got %+v", options)
+	}
+
+	for _, sql := range []string{
+		"UPDATE sessions SET ttl = 'soon'",
+		"UPDATE sessions SET ttl = 1",
+		"select ttl(1) from sessions",
+		"select s.id from sessions s join cache c on s.id = c.id where ttl() > 0",
+		"CREATE TABLE bad (id int) COMMENT 'sliding_ttl=maybe'",
+	} {
+		if _, err := sqlSession.ExecuteSQL(sql); err == nil {
+			t.Fatalf("%s: expected an error", sql)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"a-eighty/mem_cache/data_query"
+	"a-eighty/mem_cache/map_table"
+	"testing"
+)
+
+// newSession starts from an empty store and returns a session on the new database of that name.
+func newSession(t *testing.T, database string) *data_query.SqlSession {
+	t.Helper()
+	map_table.InitDataBase()
+	if err := map_table.CreateDatabase(database); err != nil {
+		t.Fatal(err)
+	}
+	return &data_query.SqlSession{DatabaseName: database}
+}
+
+func mustExecute(t *testing.T, sqlSession *data_query.SqlSession, sql string) *data_query.QueryResult {
+	t.Helper()
+	rs, err := sqlSession.ExecuteSQL(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	return rs
+}
+
+func mustTable(t *testing.T, database, name string) *map_table.DataTable {
+	t.Helper()
+	table, err := map_table.GetTable(database, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+// expectColumn runs query and checks the values of column in the rows it returns, in order.
+func expectColumn[T comparable](t *testing.T, sqlSession *data_query.SqlSession, query, column string, expected ...T) {
+	t.Helper()
+	rs := mustExecute(t, sqlSession, query)
+	if len(rs.Rows) != len(expected) {
+		t.Fatalf("%s: expected %v, got %v", query, expected, rs.Rows)
+	}
+	for i, value := range expected {
+		if rs.Rows[i][column] != value {
+			t.Fatalf("%s: expected %v, got %v", query, expected, rs.Rows)
+		}
+	}
+}
+
+func expectIds(t *testing.T, sqlSession *data_query.SqlSession, query string, expected ...int64) {
+	t.Helper()
+	expectColumn(t, sqlSession, query, "id", expected...)
+}
+
+func expectNames(t *testing.T, sqlSession *data_query.SqlSession, query string, expected ...string) {
+	t.Helper()
+	expectColumn(t, sqlSession, query, "name", expected...)
+}
+
+func expectCount(t *testing.T, sqlSession *data_query.SqlSession, query string, expected int) {
+	t.Helper()
+	if rs := mustExecute(t, sqlSession, query); len(rs.Rows) != expected {
+		t.Fatalf("%s: expected %d rows, got %d", query, expected, len(rs.Rows))
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"testing"
+)
+
+func TestCreateIndex(t *testing.T) {
+	sqlSession := newSession(t, "index_test")
+
+	mustExecute(t, sqlSession, "CREATE TABLE events (id int not null, tenant varchar(10), kind varchar(10), score int, index (tenant) using hash) comment 'events cache, auto_index=off'")
+	mustExecute(t, sqlSession, `INSERT INTO events (id, tenant, kind, score) VALUES
+		(1, 'a', 'click', 30), (2, 'a', 'view', 10), (3, 'b', 'click', NULL), (4, 'b', 'view', 50), (5, 'a', 'click', 20)`)
+	table, err := map_table.GetTable("index_test", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !table.Options().DisableAutoIndex || table.HasLookupIndex("kind") || !table.HasLookupIndex("tenant") || table.HasOrderedIndex("score") {
+		t.Fatal("expected only the index on tenant without auto indexing")
+	}
+
+	mustExecute(t, sqlSession, "CREATE INDEX tenant_kind ON events (tenant, kind) USING HASH")
+	mustExecute(t, sqlSession, "CREATE INDEX by_score ON events (score)")
+	if !table.HasOrderedIndex("score") || table.HasLookupIndex("kind") {
+		t.Fatal("expected the BTREE index to order score and the composite index not to serve kind alone")
+	}
+	if _, err := sqlSession.ExecuteSQL("CREATE INDEX by_score ON events (kind)"); !errors.Is(err, map_table.ErrIndexExists) {
+		t.Fatalf("expected a duplicate index name to fail, got %v", err)
+	}
+	if _, err := sqlSession.ExecuteSQL("CREATE INDEX by_missing ON events (missing)"); err == nil {
+		t.Fatal("expected an index on a missing column to fail")
+	}
+
+	rs := mustExecute(t, sqlSession, "SHOW INDEX FROM events")
+	expected := []struct {
+		key, column, kind string
+		seq               int64
+	}{
+		{"tenant", "tenant", "HASH", 1}, {"tenant_kind", "tenant", "HASH", 1}, {"tenant_kind", "kind", "HASH", 2}, {"by_score", "score", "BTREE", 1},
+	}
+	if len(rs.Rows) != len(expected) {
+		t.Fatalf("unexpected indexes %v", rs.Rows)
+	}
+	for i, index := range expected {
+		row := rs.Rows[i]
+		if row["Key_name"] != index.key || row["Column_name"] != index.column || row["Index_type"] != index.kind || row["Seq_in_index"] != index.seq {
+			t.Fatalf("unexpected index %v, expected %v", row, index)
+		}
+	}
+
+	expectIds(t, sqlSession, "select id from events where tenant = 'a' and kind = 'click' order by id", 1, 5)
+	expectIds(t, sqlSession, "select id from events where kind = 'view' and tenant = 'b'", 4)
+	expectIds(t, sqlSession, "select id from events where kind = 'view' order by id", 2, 4)
+	expectIds(t, sqlSession, "select id from events where score > 15 order by id", 1, 4, 5)
+	expectIds(t, sqlSession, "select id from events order by score desc limit 2", 4, 1)
+	mustExecute(t, sqlSession, "INSERT INTO events (id, tenant, kind, score) VALUES (6, 'a', 'click', 40)")
+	mustExecute(t, sqlSession, "UPDATE events SET kind = 'view' WHERE id = 1")
+	mustExecute(t, sqlSession, "DELETE FROM events WHERE id = 2")
+	expectIds(t, sqlSession, "select id from events where tenant = 'a' and kind = 'click' order by id", 5, 6)
+	expectIds(t, sqlSession, "select id from events where tenant = 'a' and kind = 'view'", 1)
+	expectIds(t, sqlSession, "select id from events where score between 20 and 40 order by score", 5, 1, 6)
+
+	mustExecute(t, sqlSession, "CREATE TABLE tenants (name varchar(10), plan varchar(10)) comment 'auto_index=0'")
+	mustExecute(t, sqlSession, "INSERT INTO tenants (name, plan) VALUES ('a', 'free'), ('b', 'paid')")
+	rs = mustExecute(t, sqlSession, "select e.id, t.plan from tenants t join events e on e.tenant = t.name where t.plan = 'paid' order by e.id")
+	if len(rs.Rows) != 2 || rs.Rows[0]["id"] != int64(3) || rs.Rows[1]["plan"] != "paid" {
+		t.Fatalf("unexpected join through the index %v", rs.Rows)
+	}
+
+	mustExecute(t, sqlSession, "DROP INDEX tenant_kind ON events")
+	mustExecute(t, sqlSession, "ALTER TABLE events DROP INDEX by_score")
+	if _, err := sqlSession.ExecuteSQL("DROP INDEX by_score ON events"); !errors.Is(err, map_table.ErrIndexNotExists) {
+		t.Fatalf("expected dropping a missing index to fail, got %v", err)
+	}
+	if table.HasOrderedIndex("score") || len(mustExecute(t, sqlSession, "SHOW INDEX FROM events").Rows) != 1 {
+		t.Fatal("expected only the index on tenant to be left")
+	}
+	expectIds(t, sqlSession, "select id from events where tenant = 'a' and kind = 'click' order by id", 5, 6)
+	expectIds(t, sqlSession, "select id from events order by score desc limit 2", 4, 6)
+
+	mustExecute(t, sqlSession, "ALTER TABLE events COMMENT 'auto_index=on'")
+	if table.Options().DisableAutoIndex || !table.HasLookupIndex("kind") || !table.HasOrderedIndex("score") {
+		t.Fatal("expected auto indexing to index every column again")
+	}
+	expectIds(t, sqlSession, "select id from events where kind = 'view' order by id", 1, 4)
+	expectIds(t, sqlSession, "select id from events where score < 35 order by score", 5, 1)
+
+	if _, err := sqlSession.ExecuteSQL("ALTER TABLE events COMMENT 'auto_index=maybe'"); err == nil {
+		t.Fatal("expected an invalid table setting to fail")
+	}
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE broken (id int) comment 'unknown_setting=1'"); err == nil {
+		t.Fatal("expected an unknown table setting to fail")
+	}
+}
@@ -0,0 +1,31 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"testing"
+)
+
+func TestMultiRowInsert(t *testing.T) {
+	sqlSession := newSession(t, "insert_test")
+	map_table.CreateTable("insert_test", "employees")
+
+	rs, err := sqlSession.ExecuteSQL("INSERT INTO employees (id, name, TTL) VALUES (1, 'a', 'PT1H'), (2, 'b', 'PT2H'), (3, 'c', 'PT3H')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.RowsAffected != 3 {
+		t.Fatalf("expected 3 rows affected, got %d", rs.RowsAffected)
+	}
+
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO employees (id, name) VALUES (4, 'd'), (5)"); err == nil {
+		t.Fatal("expected a tuple with a wrong value count to reject the statement")
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from employees where id > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rs.Rows))
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"testing"
+)
+
+func TestJoin(t *testing.T) {
+	sqlSession := newSession(t, "join_test")
+
+	statements := []string{
+		"CREATE TABLE departments (id int not null, name varchar(20))",
+		"CREATE TABLE employees (id int not null, name varchar(20), department_id int)",
+		"INSERT INTO departments (id, name) VALUES (1, 'Engineering'), (2, 'Sales'), (3, 'Support')",
+		"INSERT INTO employees (id, name, department_id) VALUES (1, 'John', 1), (2, 'Jane', 1), (3, 'Jim', 2), (4, 'Joe', NULL)",
+	}
+	for _, statement := range statements {
+		if _, err := sqlSession.ExecuteSQL(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select e.name, d.name as department from employees e join departments d on e.department_id = d.id order by e.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 || rs.Rows[0]["name"] != "John" || rs.Rows[0]["department"] != "Engineering" || rs.Rows[2]["department"] != "Sales" {
+		t.Fatalf("unexpected inner join %#v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select e.name, d.name from employees e left join departments d on d.id = e.department_id where e.id > 2 order by e.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 2 || rs.Rows[1]["e.name"] != "Joe" || rs.Rows[1]["d.name"] != nil {
+		t.Fatalf("expected the employee without department with NULL columns, got %#v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select d.name, count(e.id) total from departments d left join employees e on e.department_id = d.id and e.name <> 'Jane' group by d.name order by d.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 || rs.Rows[0]["total"] != int64(1) || rs.Rows[1]["total"] != int64(1) || rs.Rows[2]["total"] != int64(0) {
+		t.Fatalf("unexpected counts per department %#v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from employees cross join departments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 12 || len(rs.Columns) != 5 || rs.Columns[0].Name != "employees.id" || rs.Columns[4].Name != "departments.name" {
+		t.Fatalf("unexpected cross join %#v", rs.Columns)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select e.name from employees e, departments d where e.department_id = d.id and d.name = 'Sales'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["name"] != "Jim" {
+		t.Fatalf("unexpected comma join %#v", rs.Rows)
+	}
+
+	if _, err = sqlSession.ExecuteSQL("CREATE TABLE managers (id int not null, department_id int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sqlSession.ExecuteSQL("INSERT INTO managers (id, department_id) VALUES (2, 1)"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err = sqlSession.ExecuteSQL("select employees.name from employees join managers using (id, department_id)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["name"] != "Jane" {
+		t.Fatalf("unexpected join with USING %#v", rs.Rows)
+	}
+
+	// a text that does not convert to the INT column is compared with every row of the other table, USING still has to hold
+	mustExecute(t, sqlSession, "CREATE TABLE codes (id varchar(10), code varchar(10))")
+	mustExecute(t, sqlSession, "INSERT INTO codes (id, code) VALUES ('2', 'two'), ('two', 'none'), ('2.0', 'float')")
+	rs = mustExecute(t, sqlSession, "select codes.code, departments.name from codes join departments using (id) order by codes.code")
+	if len(rs.Rows) != 2 || rs.Rows[0]["code"] != "float" || rs.Rows[1]["code"] != "two" || rs.Rows[1]["name"] != "Sales" {
+		t.Fatalf("unexpected join with USING on other types %#v", rs.Rows)
+	}
+	rs = mustExecute(t, sqlSession, "select codes.code, departments.name from codes left join departments using (id) order by codes.code")
+	if len(rs.Rows) != 3 || rs.Rows[1]["code"] != "none" || rs.Rows[1]["name"] != nil {
+		t.Fatalf("unexpected left join with USING on other types %#v", rs.Rows)
+	}
+
+	if _, err = sqlSession.ExecuteSQL("select name from employees e join departments d on e.department_id = d.id"); err == nil {
+		t.Fatal("expected an ambiguous column to fail")
+	}
+}
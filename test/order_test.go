@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+)
+
+func TestOrderBy(t *testing.T) {
+	sqlSession := newSession(t, "order_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE employees (id int not null, department varchar(20), salary int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL(`INSERT INTO employees (id, department, salary) VALUES
+		(1, 'Sales', 900), (2, 'Engineering', NULL), (3, 'Sales', 1000), (4, 'Engineering', 3000),
+		(5, NULL, 100), (6, 'Sales', 1000), (7, 'Engineering', 20000)`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		orderBy  string
+		expected []int64
+	}{
+		{"salary", []int64{2, 5, 1, 3, 6, 4, 7}},
+		{"salary desc", []int64{7, 4, 3, 6, 1, 5, 2}},
+		{"salary nulls last", []int64{5, 1, 3, 6, 4, 7, 2}},
+		{"salary desc nulls first", []int64{2, 7, 4, 3, 6, 1, 5}},
+		{"department, salary desc", []int64{5, 7, 4, 2, 3, 6, 1}},
+		{"department desc, salary, id desc", []int64{1, 6, 3, 2, 4, 7, 5}},
+		{"department nulls last, 1 desc", []int64{7, 4, 2, 6, 3, 1, 5}},
+		{"salary * -1 nulls last", []int64{7, 4, 3, 6, 1, 5, 2}},
+		{"department is null, department, id", []int64{2, 4, 7, 1, 3, 6, 5}},
+	}
+	for _, testCase := range cases {
+		rs, err := sqlSession.ExecuteSQL("select id from employees order by " + testCase.orderBy)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.orderBy, err)
+		}
+		if len(rs.Rows) != len(testCase.expected) {
+			t.Fatalf("%s: expected ids %v, got %v", testCase.orderBy, testCase.expected, rs.Rows)
+		}
+		for i, id := range testCase.expected {
+			if rs.Rows[i]["id"] != id {
+				t.Fatalf("%s: expected ids %v, got %v", testCase.orderBy, testCase.expected, rs.Rows)
+			}
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select id, salary pay from employees where department = 'Sales' order by pay desc, id limit 2 offset 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 2 || rs.Rows[0]["id"] != int64(6) || rs.Rows[1]["id"] != int64(1) {
+		t.Fatalf("expected ids 6 and 1, got %v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select id from employees where department = 'nulls first' order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 0 {
+		t.Fatalf("expected no rows, got %v", rs.Rows)
+	}
+}
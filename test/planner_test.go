@@ -0,0 +1,75 @@
+package test
+
+import (
+	"testing"
+)
+
+func TestIndexPlanner(t *testing.T) {
+	sqlSession := newSession(t, "planner_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE orders (id int not null, customer varchar(20), status varchar(10), amount int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL(`INSERT INTO orders (id, customer, status, amount) VALUES
+		(1, 'alice', 'open', 10), (2, 'bob', 'open', 20), (3, 'alice', 'closed', 30),
+		(4, 'carol', 'open', NULL), (5, 'bob', 'closed', 50), (6, '05', 'open', 60)`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		where    string
+		expected []int64
+	}{
+		{"customer = 'alice' AND status = 'open'", []int64{1}},
+		{"status = 'closed' AND amount > 40", []int64{5}},
+		{"customer IN ('bob', 'carol') OR id = 1", []int64{1, 2, 4, 5}},
+		{"id = 2 OR amount > 40", []int64{2, 5, 6}},
+		{"'bob' = customer", []int64{2, 5}},
+		{"id = '3'", []int64{3}},
+		{"id = 1 + 1", []int64{2}},
+		{"customer = 5", []int64{6}},
+		{"amount = NULL", nil},
+		{"id IN (7, 8)", nil},
+		{"customer = 'alice' AND id = amount / 10", []int64{1, 3}},
+	}
+	for _, testCase := range cases {
+		rs, err := sqlSession.ExecuteSQL("select id from orders where " + testCase.where + " order by id")
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.where, err)
+		}
+		if len(rs.Rows) != len(testCase.expected) {
+			t.Fatalf("%s: expected ids %v, got %v", testCase.where, testCase.expected, rs.Rows)
+		}
+		for i, id := range testCase.expected {
+			if rs.Rows[i]["id"] != id {
+				t.Fatalf("%s: expected ids %v, got %v", testCase.where, testCase.expected, rs.Rows)
+			}
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("delete from orders where customer = 'bob' and status = 'open'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.RowsAffected != 1 {
+		t.Fatalf("expected 1 deleted row, got %d", rs.RowsAffected)
+	}
+	rs, err = sqlSession.ExecuteSQL("delete from orders where id in (1, 6, 9)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.RowsAffected != 2 {
+		t.Fatalf("expected 2 deleted rows, got %d", rs.RowsAffected)
+	}
+	rs, err = sqlSession.ExecuteSQL("select id from orders where status = 'closed' or customer = 'carol' order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 || rs.Rows[0]["id"] != int64(3) || rs.Rows[1]["id"] != int64(4) || rs.Rows[2]["id"] != int64(5) {
+		t.Fatalf("expected rows 3, 4 and 5 to be left, got %v", rs.Rows)
+	}
+
+	if _, err = sqlSession.ExecuteSQL("delete from orders where id = 3 limit 1"); err == nil {
+		t.Fatal("expected DELETE with LIMIT to fail")
+	}
+}
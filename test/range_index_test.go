@@ -0,0 +1,122 @@
+package test
+
+import (
+	"a-eighty/data_structure/skiplist"
+	"cmp"
+	"fmt"
+	"testing"
+)
+
+func TestSkipList(t *testing.T) {
+	list := data_structure_skiplist.NewSkipList(cmp.Compare[int])
+	for _, key := range []int{50, 10, 40, 20, 30, 20} {
+		list.Insert(key)
+	}
+	if !list.Delete(40) || list.Delete(45) || list.Len() != 4 {
+		t.Fatalf("unexpected length %d", list.Len())
+	}
+
+	var keys []int
+	from := 15
+	list.Ascend(&from, func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if fmt.Sprint(keys) != "[20 30 50]" {
+		t.Fatalf("unexpected ascending keys %v", keys)
+	}
+	keys = nil
+	from = 30
+	list.Descend(&from, func(key int) bool {
+		keys = append(keys, key)
+		return key > 10
+	})
+	if fmt.Sprint(keys) != "[30 20 10]" {
+		t.Fatalf("unexpected descending keys %v", keys)
+	}
+	keys = nil
+	list.Descend(nil, func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if fmt.Sprint(keys) != "[50 30 20 10]" {
+		t.Fatalf("unexpected descending keys %v", keys)
+	}
+}
+
+func TestRangeIndex(t *testing.T) {
+	sqlSession := newSession(t, "range_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE events (id int not null, kind varchar(10), score int, created datetime)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL(`INSERT INTO events (id, kind, score, created) VALUES
+		(1, 'click', 30, '2024-01-01 10:00:00'), (2, 'view', 10, '2024-01-01 11:00:00'), (3, 'click', NULL, '2024-01-01 09:00:00'),
+		(4, 'view', 50, '2024-01-02 08:00:00'), (5, 'click', 30, NULL), (6, 'view', 20, '2024-01-01 12:00:00'),
+		(7, 'click', 40, '2024-01-01 11:00:00'), (8, 'view', 30, '2024-01-03 00:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query    string
+		expected []int64
+	}{
+		{"where score > 30 order by id", []int64{4, 7}},
+		{"where score >= 30 order by id", []int64{1, 4, 5, 7, 8}},
+		{"where 30 > score order by id", []int64{2, 6}},
+		{"where score <= '20' order by id", []int64{2, 6}},
+		{"where score between 20 and 40 and kind = 'click' order by id", []int64{1, 5, 7}},
+		{"where score > NULL", nil},
+		{"where created >= '2024-01-01 11:00:00' and created < '2024-01-02' order by id", []int64{2, 6, 7}},
+		{"where kind < 'd' and score > 10 order by id", []int64{1, 5, 7}},
+		{"order by score limit 3", []int64{3, 2, 6}},
+		{"order by score desc limit 2", []int64{4, 7}},
+		{"order by score limit 2 offset 3", []int64{1, 5}},
+		{"order by score, id desc limit 4", []int64{3, 2, 6, 8}},
+		{"order by score nulls last limit 3", []int64{2, 6, 1}},
+		{"order by score desc nulls first limit 2", []int64{3, 4}},
+		{"order by score desc limit 10", []int64{4, 7, 1, 5, 8, 6, 2, 3}},
+		{"where created > '2024-01-01 10:00:00' order by created desc limit 3", []int64{8, 4, 6}},
+		{"where created between '2024-01-01' and '2024-01-01 23:59:59' order by created, id desc limit 3", []int64{3, 1, 7}},
+		{"where kind = 'view' order by score limit 2", []int64{2, 6}},
+		{"where kind = 'click' and score > 10 order by score desc limit 1", []int64{7}},
+		{"order by created limit 2", []int64{5, 3}},
+		{"order by score limit 0", nil},
+	}
+	for _, testCase := range cases {
+		rs, err := sqlSession.ExecuteSQL("select id from events " + testCase.query)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.query, err)
+		}
+		if len(rs.Rows) != len(testCase.expected) {
+			t.Fatalf("%s: expected ids %v, got %v", testCase.query, testCase.expected, rs.Rows)
+		}
+		for i, id := range testCase.expected {
+			if rs.Rows[i]["id"] != id {
+				t.Fatalf("%s: expected ids %v, got %v", testCase.query, testCase.expected, rs.Rows)
+			}
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select id, score as id2 from events order by id2 desc limit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["id"] != int64(4) {
+		t.Fatalf("expected the highest score, got %v", rs.Rows)
+	}
+
+	if _, err = sqlSession.ExecuteSQL("update events set score = 5 where id = 4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sqlSession.ExecuteSQL("delete from events where score < 15"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err = sqlSession.ExecuteSQL("select id from events where score > 0 order by score desc, id limit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 || rs.Rows[0]["id"] != int64(7) || rs.Rows[1]["id"] != int64(1) || rs.Rows[2]["id"] != int64(5) {
+		t.Fatalf("expected ids 7, 1 and 5 after the update and delete, got %v", rs.Rows)
+	}
+}
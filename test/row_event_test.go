@@ -0,0 +1,100 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"testing"
+	"time"
+)
+
+func TestRowEvents(t *testing.T) {
+	sqlSession := newSession(t, "row_event_test")
+
+	events := make(chan map_table.RowEvent, 16)
+	expectEvent := func(id int64, reason map_table.RowEventReason) {
+		select {
+		case event := <-events:
+			if event.Table != "items" || event.Row["id"] != id || event.Reason != reason {
+				t.Fatalf("expected item %d to be %s, got %s for %v", id, reason, event.Reason, event.Row)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected item %d to be %s", id, reason)
+		}
+	}
+	expectNoEvent := func() {
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected event %s for %v", event.Reason, event.Row)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE items (id int primary key, name varchar(20))")
+	table, err := map_table.GetTable("row_event_test", "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe, dropped := table.SubscribeChannel(events)
+	var callbacks []map_table.RowEvent
+	unsubscribeCallback := table.Subscribe(func(event map_table.RowEvent) {
+		callbacks = append(callbacks, event)
+	})
+
+	mustExecute(t, sqlSession, "INSERT INTO items (id, name) VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+	mustExecute(t, sqlSession, "UPDATE items SET name = 'bb' WHERE id = 2")
+	expectNoEvent()
+	mustExecute(t, sqlSession, "DELETE FROM items WHERE id = 1")
+	expectEvent(1, map_table.RowDeleted)
+	mustExecute(t, sqlSession, "REPLACE INTO items (id, name) VALUES (2, 'replaced')")
+	expectEvent(2, map_table.RowDeleted)
+	if len(callbacks) != 2 || callbacks[1].Row["name"] != "bb" {
+		t.Fatalf("expected the callback to see both deleted rows, got %v", callbacks)
+	}
+	unsubscribeCallback()
+
+	// the cleaner reports the rows it deletes, and so does a statement finding a row expired first
+	if err := table.Insert(map[string]any{"id": int64(4), "name": "short"}, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(4, map_table.RowExpired)
+	if err := table.Insert(map[string]any{"id": int64(5), "name": "short"}, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	mustExecute(t, sqlSession, "INSERT INTO items (id, name) VALUES (5, 'again')")
+	expectEvent(5, map_table.RowExpired)
+	expectNoEvent()
+
+	mustExecute(t, sqlSession, "TRUNCATE TABLE items")
+	truncated := map[any]bool{}
+	for i := 0; i < 3; i++ {
+		if event := <-events; event.Reason == map_table.RowDeleted {
+			truncated[event.Row["id"]] = true
+		}
+	}
+	if !truncated[int64(2)] || !truncated[int64(3)] || !truncated[int64(5)] {
+		t.Fatalf("expected every row to be deleted by TRUNCATE, got %v", truncated)
+	}
+	if dropped() != 0 {
+		t.Fatalf("expected no dropped event, got %d", dropped())
+	}
+
+	// a full channel drops the rows instead of holding up the statement deleting them
+	mustExecute(t, sqlSession, "INSERT INTO items (id, name) VALUES (10, 'j'), (11, 'k'), (12, 'l'), (13, 'm'), (14, 'n'), (15, 'o'), (16, 'p'), (17, 'q'), (18, 'r'), (19, 's'), (20, 't'), (21, 'u'), (22, 'v'), (23, 'w'), (24, 'x'), (25, 'y'), (26, 'z'), (27, 'zz')")
+	if rs := mustExecute(t, sqlSession, "DELETE FROM items WHERE id >= 10"); rs.RowsAffected != 18 {
+		t.Fatalf("expected 18 deleted rows, got %d", rs.RowsAffected)
+	}
+	if len(events) != cap(events) || dropped() != 2 {
+		t.Fatalf("expected a full channel and 2 dropped events, got %d events and %d dropped", len(events), dropped())
+	}
+	for len(events) > 0 {
+		<-events
+	}
+
+	unsubscribe()
+	mustExecute(t, sqlSession, "INSERT INTO items (id, name) VALUES (6, 'f')")
+	mustExecute(t, sqlSession, "DELETE FROM items")
+	expectNoEvent()
+	if len(callbacks) != 2 {
+		t.Fatalf("expected no callback after unsubscribing, got %v", callbacks)
+	}
+}
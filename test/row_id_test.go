@@ -0,0 +1,111 @@
+package test
+
+import (
+	"a-eighty/data_structure/slice"
+	"a-eighty/mem_cache/map_table"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTTLSliceIndexes(t *testing.T) {
+	slice := data_structure_slice.NewTTLSlice[string]()
+	first := slice.Append("a", -1)
+	second := slice.Append("b", -1)
+	slice.Delete(first)
+	third := slice.Append("c", -1)
+	if first != 1 || second != 2 || third != 3 {
+		t.Fatalf("expected indexes 1, 2 and 3, got %d, %d and %d", first, second, third)
+	}
+	if value, ok := slice.Get(second); !ok || *value != "b" {
+		t.Fatal("expected the append after a delete to keep the other element")
+	}
+
+	slice.Append("short", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if index := slice.Append("d", -1); index != 5 {
+		t.Fatalf("expected an expired index not to be reused, got %d", index)
+	}
+	slice.Clear()
+	if index := slice.Append("e", -1); index != 6 || slice.Len() != 1 {
+		t.Fatalf("expected indexes to go on after a clear, got %d", index)
+	}
+}
+
+func TestConcurrentInsertRowIds(t *testing.T) {
+	map_table.InitDataBase()
+	map_table.CreateDatabase("row_id_test")
+	schema, err := map_table.NewTableSchema([]map_table.ColumnDefinition{
+		{Name: "id", Type: map_table.ColumnTypeInt},
+		{Name: "worker", Type: map_table.ColumnTypeInt, Nullable: true},
+		{Name: "shard", Type: map_table.ColumnTypeInt, Nullable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := map_table.CreateTableWithSchema("row_id_test", "rows", schema); err != nil {
+		t.Fatal(err)
+	}
+	table, err := map_table.GetTable("row_id_test", "rows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.CreateIndex(map_table.IndexDefinition{Kind: map_table.IndexKindHash, Columns: []string{"id"}, Primary: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	workers, perWorker := runtime.NumCPU(), 500
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := int64(worker*perWorker + i)
+				if err := table.Insert(map[string]any{"id": id, "worker": int64(worker), "shard": int64(i % 4)}, -1); err != nil {
+					t.Error(err)
+					return
+				}
+				// deleting while others insert must not move or overwrite their rows
+				if i%3 == 0 {
+					index, ok := table.PrimaryKeyRowIndex(id)
+					if !ok {
+						t.Errorf("row %d not found after insert", id)
+						return
+					}
+					table.DeleteIndexes([]int{index}, func(map[string]any) bool {
+						return true
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every worker writes to the buckets of the shards at the same time
+	for shard := 0; shard < 4; shard++ {
+		expected := 0
+		for i := shard; i < perWorker; i += 4 {
+			if i%3 != 0 {
+				expected += workers
+			}
+		}
+		if rows, ok := table.LookupRows("shard", int64(shard)); !ok || len(rows) != expected {
+			t.Fatalf("expected %d rows in shard %d, got %d", expected, shard, len(rows))
+		}
+	}
+	for worker := 0; worker < workers; worker++ {
+		rows, ok := table.LookupRows("worker", int64(worker))
+		if !ok || len(rows) != perWorker-(perWorker+2)/3 {
+			t.Fatalf("expected %d rows of worker %d, got %d", perWorker-(perWorker+2)/3, worker, len(rows))
+		}
+		for i := 0; i < perWorker; i++ {
+			id := int64(worker*perWorker + i)
+			row, ok := table.GetByPrimaryKey(id)
+			if ok == (i%3 == 0) || ok && (row["id"] != id || row["worker"] != int64(worker)) {
+				t.Fatalf("unexpected row for id %d: %v", id, row)
+			}
+		}
+	}
+}
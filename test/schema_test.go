@@ -0,0 +1,88 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchemaEnforcement(t *testing.T) {
+	sqlSession := newSession(t, "schema_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE employees (id int not null, name varchar(20) not null, department varchar(20) default 'Engineering', hire_date date)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := []string{
+		"INSERT INTO employees (id, nmae) VALUES (1, 'John Doe')",
+		"INSERT INTO employees (id) VALUES (1)",
+		"INSERT INTO employees (id, name) VALUES ('abc', 'John Doe')",
+		"INSERT INTO employees (id, name) VALUES (1, NULL)",
+		"INSERT INTO employees (id, name, hire_date) VALUES (1, 'John Doe', 'yesterday')",
+		"UPDATE employees SET nmae = 'x'",
+		"UPDATE employees SET id = 'abc'",
+	}
+	for _, sql := range rejected {
+		if _, err := sqlSession.ExecuteSQL(sql); err == nil {
+			t.Fatalf("expected %q to be rejected", sql)
+		}
+	}
+
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO employees (ID, name, hire_date) VALUES (1, 'John Doe', '2023-01-15')"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := sqlSession.ExecuteSQL("select * from employees where id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rs.Rows))
+	}
+	if rs.Rows[0]["department"] != "Engineering" {
+		t.Fatalf("expected the default department, got %v", rs.Rows[0]["department"])
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	sqlSession := newSession(t, "typed_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE products (id bigint not null, name varchar(20), price decimal(10,2), weight double, active bool, code varbinary(8), created datetime)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO products (id, name, price, weight, active, code, created) VALUES (1, 'John Doe', '9.99', 1, true, x'0A0B', '2023-01-15 10:00:00'), (-2, NULL, 10, 2.5, false, 'ab', '2023-01-16')"); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select * from products where name = 'John Doe'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rs.Rows))
+	}
+	row := rs.Rows[0]
+	if row["id"] != int64(1) || row["name"] != "John Doe" || row["weight"] != float64(1) || row["active"] != true {
+		t.Fatalf("unexpected typed row %#v", row)
+	}
+	if code, ok := row["code"].([]byte); !ok || string(code) != "\x0a\x0b" {
+		t.Fatalf("expected code to be bytes, got %#v", row["code"])
+	}
+	if created, ok := row["created"].(time.Time); !ok || created.Hour() != 10 {
+		t.Fatalf("expected created to be a time, got %#v", row["created"])
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from products where price > 9.995")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["id"] != int64(-2) || rs.Rows[0]["name"] != nil {
+		t.Fatalf("expected only the second product, got %#v", rs.Rows)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from products where created < '2023-01-16'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["id"] != int64(1) {
+		t.Fatalf("expected only the first product, got %#v", rs.Rows)
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"a-eighty/mem_cache/data_query"
+	"testing"
+)
+
+func TestSelectProjection(t *testing.T) {
+	sqlSession := newSession(t, "select_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE employees (id int not null, name varchar(20), salary int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO employees (id, name, salary) VALUES (1, 'John', 1000), (2, 'Jane', 2000)"); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := sqlSession.ExecuteSQL("select e.id, name AS n, salary * 2 + 1, concat(upper(name), '!') shout, 'x' from employees e where id = 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedColumns := []data_query.ColumnMetadata{
+		{Name: "id", Type: "INT"},
+		{Name: "n", Type: "STRING"},
+		{Name: "salary * 2 + 1", Type: "INT"},
+		{Name: "shout", Type: "STRING"},
+		{Name: "'x'", Type: "STRING"},
+	}
+	if len(rs.Columns) != len(expectedColumns) {
+		t.Fatalf("expected %d columns, got %#v", len(expectedColumns), rs.Columns)
+	}
+	for i, column := range expectedColumns {
+		if rs.Columns[i] != column {
+			t.Fatalf("expected column %d to be %#v, got %#v", i, column, rs.Columns[i])
+		}
+	}
+	if len(rs.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rs.Rows))
+	}
+	row := rs.Rows[0]
+	if row["id"] != int64(2) || row["n"] != "Jane" || row["salary * 2 + 1"] != int64(4001) || row["shout"] != "JANE!" || row["'x'"] != "x" {
+		t.Fatalf("unexpected row %#v", row)
+	}
+	if _, ok := row["name"]; ok {
+		t.Fatalf("expected only projected columns, got %#v", row)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select employees.* from employees where id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Columns) != 3 || rs.Columns[0].Name != "id" || rs.Columns[2].Name != "salary" {
+		t.Fatalf("expected the schema columns in order, got %#v", rs.Columns)
+	}
+
+	if _, err := sqlSession.ExecuteSQL("select nmae from employees"); err == nil {
+		t.Fatal("expected an unknown column to be rejected")
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select 1 + 1 AS two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["two"] != int64(2) {
+		t.Fatalf("unexpected constant result %#v", rs.Rows)
+	}
+
+	// DISTINCT drops the repeated output rows before ORDER BY and LIMIT
+	mustExecute(t, sqlSession, "INSERT INTO employees (id, name, salary) VALUES (3, 'John', 3000), (4, 'Jim', 1000), (5, 'Joe', NULL), (6, 'Joe', NULL)")
+	expectNames(t, sqlSession, "select distinct name from employees order by name", "Jane", "Jim", "Joe", "John")
+	expectNames(t, sqlSession, "select distinct name from employees order by name desc limit 2 offset 1", "Joe", "Jim")
+	expectCount(t, sqlSession, "select distinct name, salary from employees", 5)
+	expectCount(t, sqlSession, "select distinct salary from employees where id > 1", 4)
+	expectCount(t, sqlSession, "select distinct salary % 2 as parity from employees", 2)
+}
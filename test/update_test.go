@@ -0,0 +1,104 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	sqlSession := newSession(t, "update_test")
+	map_table.CreateTable("update_test", "employees")
+
+	sql := "INSERT INTO employees (id, name, department, TTL) VALUES (%d, 'John Doe', 'Engineering', 'PT1H');"
+	for i := 0; i < 10; i++ {
+		if _, err := sqlSession.ExecuteSQL(fmt.Sprintf(sql, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("UPDATE employees SET department = 'Sales', name = 'Jane Doe' WHERE id < 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.RowsAffected != 3 {
+		t.Fatalf("expected 3 rows affected, got %d", rs.RowsAffected)
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from employees where department = 'Sales'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 {
+		t.Fatalf("expected 3 rows in Sales, got %d", len(rs.Rows))
+	}
+	for _, row := range rs.Rows {
+		if row["name"] != "Jane Doe" {
+			t.Fatalf("expected updated name, got %v", row["name"])
+		}
+	}
+
+	rs, err = sqlSession.ExecuteSQL("select * from employees where department = 'Engineering'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 7 {
+		t.Fatalf("expected 7 rows left in Engineering, got %d", len(rs.Rows))
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	sqlSession := newSession(t, "update_expression_test")
+	mustExecute(t, sqlSession, "CREATE TABLE counters (id int not null, name varchar(20), hits int, previous int)")
+	mustExecute(t, sqlSession, "INSERT INTO counters (id, name, hits) VALUES (1, 'a', 1), (2, 'b', 5), (3, 'c', NULL)")
+
+	// every row gets its own values, and each assignment sees the columns set before it
+	if rs := mustExecute(t, sqlSession, "UPDATE counters SET hits = hits * 2 + id, previous = hits - id WHERE id < 3"); rs.RowsAffected != 2 {
+		t.Fatalf("expected 2 updated rows, got %d", rs.RowsAffected)
+	}
+	expectColumn[any](t, sqlSession, "select hits from counters order by id", "hits", int64(3), int64(12), nil)
+	expectColumn[any](t, sqlSession, "select previous from counters order by id", "previous", int64(2), int64(10), nil)
+	mustExecute(t, sqlSession, "UPDATE counters SET hits = hits + 1")
+	expectColumn[any](t, sqlSession, "select hits from counters order by id", "hits", int64(4), int64(13), nil)
+
+	// a computed value is converted to the column type, one that does not fit updates no row
+	if _, err := sqlSession.ExecuteSQL("UPDATE counters SET hits = name"); err == nil {
+		t.Fatal("expected a text that is no number to be rejected")
+	}
+	if _, err := sqlSession.ExecuteSQL("UPDATE counters SET id = hits"); err == nil {
+		t.Fatal("expected NULL in a NOT NULL column to be rejected")
+	}
+	expectColumn[any](t, sqlSession, "select hits from counters order by id", "hits", int64(4), int64(13), nil)
+	if _, err := sqlSession.ExecuteSQL("UPDATE counters SET hits = missing + 1"); err == nil {
+		t.Fatal("expected an unknown column to be rejected")
+	}
+}
+
+func TestDeleteRowsSharingValue(t *testing.T) {
+	sqlSession := newSession(t, "delete_shared_test")
+	mustExecute(t, sqlSession, "CREATE TABLE employees (id int, department varchar(20))")
+	employees := mustTable(t, "delete_shared_test", "employees")
+
+	// every row lands in the one bucket of 'Engineering', which a delete must not walk for each row it removes
+	rows := make([]map[string]any, 50000)
+	ttls := make([]time.Duration, len(rows))
+	for i := range rows {
+		rows[i] = map[string]any{"id": int64(i), "department": "Engineering"}
+		ttls[i] = -1
+	}
+	if err := employees.InsertRows(rows, ttls); err != nil {
+		t.Fatal(err)
+	}
+
+	if rs := mustExecute(t, sqlSession, "DELETE FROM employees WHERE department = 'Engineering' AND id >= 100"); rs.RowsAffected != 49900 {
+		t.Fatalf("expected 49900 deleted rows, got %d", rs.RowsAffected)
+	}
+	expectCount(t, sqlSession, "select id from employees where department = 'Engineering'", 100)
+	mustExecute(t, sqlSession, "DELETE FROM employees WHERE department = 'Engineering'")
+	expectCount(t, sqlSession, "select id from employees where department = 'Engineering'", 0)
+
+	// the emptied bucket was dropped, a new row starts a new one
+	mustExecute(t, sqlSession, "INSERT INTO employees (id, department) VALUES (1, 'Engineering')")
+	expectIds(t, sqlSession, "select id from employees where department = 'Engineering'", 1)
+}
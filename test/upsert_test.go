@@ -0,0 +1,130 @@
+package test
+
+import (
+	"a-eighty/mem_cache/map_table"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUpsert(t *testing.T) {
+	sqlSession := newSession(t, "upsert_test")
+
+	expectAffected := func(sql string, expected uint64) {
+		if rs := mustExecute(t, sqlSession, sql); rs.RowsAffected != expected {
+			t.Fatalf("%s: expected %d affected rows, got %d", sql, expected, rs.RowsAffected)
+		}
+	}
+
+	mustExecute(t, sqlSession, "CREATE TABLE sessions (id int primary key, token varchar(20) unique, hits int not null default 0, owner varchar(20))")
+	table, err := map_table.GetTable("upsert_test", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRow := func(id int64, token any, hits int64, owner any) {
+		row, ok := table.GetByPrimaryKey(id)
+		if !ok || row["token"] != token || row["hits"] != hits || row["owner"] != owner {
+			t.Fatalf("expected session %d to hold %v, %d and %v, got %v", id, token, hits, owner, row)
+		}
+	}
+
+	expectAffected("INSERT INTO sessions (id, token, owner) VALUES (1, 'a', 'ann'), (2, 'b', 'bob')", 2)
+	expectAffected("INSERT INTO sessions (id, token, owner) VALUES (1, 'a2', 'amy') ON DUPLICATE KEY UPDATE hits = hits + 1, token = VALUES(token)", 2)
+	expectRow(1, "a2", 1, "ann")
+	expectAffected("INSERT INTO sessions (id, token, owner) VALUES (1, 'a2', 'amy') ON DUPLICATE KEY UPDATE token = VALUES(token)", 0)
+	expectAffected("INSERT INTO sessions (id, token, owner) VALUES (3, 'c', 'cid'), (3, 'c', 'cy') AS new ON DUPLICATE KEY UPDATE owner = new.owner, hits = hits + 10", 3)
+	expectRow(3, "c", 10, "cy")
+	// the unique token finds the row when the primary key does not
+	expectAffected("INSERT INTO sessions (id, token) VALUES (9, 'b') ON DUPLICATE KEY UPDATE owner = concat(owner, '!'), hits = hits * 2 + 1", 2)
+	expectRow(2, "b", 1, "bob!")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO sessions (id, token) VALUES (2, 'x') ON DUPLICATE KEY UPDATE token = 'a2'"); !errors.Is(err, map_table.ErrDuplicateEntry) {
+		t.Fatalf("expected the update to break the unique token, got %v", err)
+	}
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO sessions (id, token) VALUES (2, 'x') ON DUPLICATE KEY UPDATE missing = 1"); err == nil {
+		t.Fatal("expected an unknown column to fail")
+	}
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO sessions (id, token) VALUES (2, 'x') ON DUPLICATE KEY UPDATE hits = NULL"); err == nil {
+		t.Fatal("expected NULL in a NOT NULL column to fail")
+	}
+	if _, err := sqlSession.ExecuteSQL("UPDATE sessions SET hits = VALUES(hits)"); err == nil {
+		t.Fatal("expected VALUES() outside of ON DUPLICATE KEY UPDATE to fail")
+	}
+
+	// REPLACE deletes both rows holding its primary key and its token
+	expectAffected("REPLACE INTO sessions (id, token, owner) VALUES (1, 'b', 'rex')", 3)
+	expectRow(1, "b", 0, "rex")
+	if _, ok := table.GetByPrimaryKey(int64(2)); ok {
+		t.Fatal("expected the row holding the token to be replaced")
+	}
+	expectAffected("REPLACE INTO sessions (id, token, owner) VALUES (4, 'd', 'dan'), (4, 'd', 'dee')", 3)
+	expectRow(4, "d", 0, "dee")
+	if rs := mustExecute(t, sqlSession, "select id from sessions"); len(rs.Rows) != 3 {
+		t.Fatalf("expected 3 sessions, got %v", rs.Rows)
+	}
+
+	// refreshing an entry restarts its TTL, the one that is not refreshed expires
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, token, ttl) VALUES (10, 'p', 'PT1S'), (11, 'q', 'PT1S')")
+	expectAffected("INSERT INTO sessions (id, token, ttl) VALUES (10, 'p', 'PT1H') ON DUPLICATE KEY UPDATE ttl = VALUES(ttl)", 2)
+	expectAffected("INSERT INTO sessions (id, token) VALUES (10, 'p') ON DUPLICATE KEY UPDATE hits = hits + 1", 2)
+	mustExecute(t, sqlSession, "REPLACE INTO sessions (id, token, ttl) VALUES (12, 'r', 'PT1S')")
+	mustExecute(t, sqlSession, "REPLACE INTO sessions (id, token) VALUES (12, 'r')")
+	time.Sleep(1100 * time.Millisecond)
+	expectRow(10, "p", 1, nil)
+	expectRow(12, "r", 0, nil)
+	if _, ok := table.GetByPrimaryKey(int64(11)); ok {
+		t.Fatal("expected the session that was not refreshed to expire")
+	}
+	expectAffected("INSERT INTO sessions (id, token) VALUES (11, 'q')", 1)
+}
+
+func TestMultiRowUpsertIsAtomic(t *testing.T) {
+	sqlSession := newSession(t, "multi_row_upsert_test")
+	mustExecute(t, sqlSession, "CREATE TABLE sessions (id int primary key, token varchar(20) unique, hits int not null default 0)")
+	mustExecute(t, sqlSession, "INSERT INTO sessions (id, token) VALUES (1, 'a'), (2, 'b')")
+	expectSessions := func(tokens ...string) {
+		t.Helper()
+		expectColumn(t, sqlSession, "select token from sessions order by id", "token", tokens...)
+	}
+
+	// the last row takes the token the row inserted first holds, so none of the rows is written
+	upsert := "INSERT INTO sessions (id, token) VALUES %s ON DUPLICATE KEY UPDATE hits = hits + 1, token = VALUES(token)"
+	if _, err := sqlSession.ExecuteSQL(fmt.Sprintf(upsert, "(5, 'e'), (1, 'x'), (2, 'e')")); !errors.Is(err, map_table.ErrDuplicateEntry) {
+		t.Fatalf("expected a duplicate token, got %v", err)
+	}
+	expectSessions("a", "b")
+	if _, err := sqlSession.ExecuteSQL("INSERT INTO sessions (id, token) VALUES (5, 'e'), (1, 'x') ON DUPLICATE KEY UPDATE hits = NULL"); err == nil {
+		t.Fatal("expected NULL in a NOT NULL column to fail")
+	}
+	expectSessions("a", "b")
+
+	// each row sees the rows before it: row 2 takes the token row 1 gave up, and the last row updates the row inserted first
+	if rs := mustExecute(t, sqlSession, fmt.Sprintf(upsert, "(5, 'e'), (1, 'x'), (2, 'a'), (5, 'f')")); rs.RowsAffected != 7 {
+		t.Fatalf("expected 7 affected rows, got %d", rs.RowsAffected)
+	}
+	expectSessions("x", "a", "f")
+	expectColumn(t, sqlSession, "select hits from sessions order by id", "hits", int64(1), int64(1), int64(1))
+	// the tokens are swapped through a free one, only the values the statement ends with have to be unique
+	mustExecute(t, sqlSession, fmt.Sprintf(upsert, "(1, 'tmp'), (2, 'x'), (1, 'a')"))
+	expectSessions("a", "x", "f")
+
+	// REPLACE finds every row to delete and makes room for the rows to insert before it writes any of them
+	mustExecute(t, sqlSession, "CREATE TABLE pair (id int primary key, name varchar(20)) COMMENT 'max_rows=2, eviction=none'")
+	mustExecute(t, sqlSession, "INSERT INTO pair (id, name) VALUES (1, 'a'), (2, 'b')")
+	if _, err := sqlSession.ExecuteSQL("REPLACE INTO pair (id, name) VALUES (1, 'a2'), (3, 'c')"); !errors.Is(err, map_table.ErrTableFull) {
+		t.Fatalf("expected a full table, got %v", err)
+	}
+	expectNames(t, sqlSession, "select name from pair order by id", "a", "b")
+	if rs := mustExecute(t, sqlSession, "REPLACE INTO pair (id, name) VALUES (1, 'a2'), (2, 'b2'), (2, 'b3')"); rs.RowsAffected != 6 {
+		t.Fatalf("expected 6 affected rows, got %d", rs.RowsAffected)
+	}
+	expectNames(t, sqlSession, "select name from pair order by id", "a2", "b3")
+
+	// the row a REPLACE deletes is not evicted to make room, so the least recently used row 1 stays replaced and row 2 goes
+	mustExecute(t, sqlSession, "CREATE TABLE recent (id int primary key, name varchar(20)) COMMENT 'max_rows=2, eviction=lru'")
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (1, 'a')")
+	time.Sleep(2 * time.Millisecond)
+	mustExecute(t, sqlSession, "INSERT INTO recent (id, name) VALUES (2, 'b')")
+	mustExecute(t, sqlSession, "REPLACE INTO recent (id, name) VALUES (1, 'a2'), (3, 'c')")
+	expectIds(t, sqlSession, "select id from recent order by id", 1, 3)
+}
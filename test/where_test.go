@@ -0,0 +1,155 @@
+package test
+
+import (
+	"a-eighty/mem_cache/data_query"
+	"testing"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+func TestWhereExpressions(t *testing.T) {
+	sqlSession := newSession(t, "where_test")
+
+	if _, err := sqlSession.ExecuteSQL("CREATE TABLE employees (id int not null, name varchar(20), manager_id int, salary int, bonus int)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlSession.ExecuteSQL(`INSERT INTO employees (id, name, manager_id, salary, bonus) VALUES
+		(1, 'John Doe', NULL, 5000, 500), (2, 'Jane Doe', 1, 3000, 100), (3, 'Jim Beam', 1, 2000, NULL),
+		(4, 'Joe_Smith', 2, 1500, 0), (5, 'Ann Lee', 2, 1000, 900)`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		where    string
+		expected []int64
+	}{
+		{"id = 2 AND salary = 3000", []int64{2}},
+		{"id = 2 AND salary = 1000", nil},
+		{"(id = 1 OR id = 5) AND NOT salary > 4000", []int64{5}},
+		{"id IN (1, 3, 7)", []int64{1, 3}},
+		{"id NOT IN (1, 3)", []int64{2, 4, 5}},
+		{"id NOT IN (1, NULL)", nil},
+		{"salary BETWEEN 1500 AND 3000", []int64{2, 3, 4}},
+		{"salary NOT BETWEEN 1500 AND 3000", []int64{1, 5}},
+		{"name LIKE 'J%Doe'", []int64{1, 2}},
+		{"name LIKE 'Joh_ Doe'", []int64{1}},
+		{"name NOT LIKE 'J%'", []int64{5}},
+		{"name LIKE 'Joe!_%' ESCAPE '!'", []int64{4}},
+		{"name REGEXP '^J[a-z]+ B'", []int64{3}},
+		{"manager_id IS NULL", []int64{1}},
+		{"bonus IS NOT NULL AND bonus > 0", []int64{1, 2, 5}},
+		{"bonus > salary / 2", []int64{5}},
+		{"manager_id = id - 1", []int64{2}},
+		{"3000 <= salary", []int64{1, 2}},
+		{"salary + bonus > 3000", []int64{1, 2}},
+		{"NOT (bonus = 0)", []int64{1, 2, 5}},
+	}
+	for _, testCase := range cases {
+		rs, err := sqlSession.ExecuteSQL("select id from employees where " + testCase.where + " order by id")
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.where, err)
+		}
+		if len(rs.Rows) != len(testCase.expected) {
+			t.Fatalf("%s: expected ids %v, got %v", testCase.where, testCase.expected, rs.Rows)
+		}
+		for i, id := range testCase.expected {
+			if rs.Rows[i]["id"] != id {
+				t.Fatalf("%s: expected ids %v, got %v", testCase.where, testCase.expected, rs.Rows)
+			}
+		}
+	}
+
+	for _, where := range []string{"id = ANY (select id from employees)", "unknown_column = 1", "count(*) > 1"} {
+		if _, err := sqlSession.ExecuteSQL("select id from employees where " + where); err == nil {
+			t.Fatalf("%s: expected an error", where)
+		}
+	}
+
+	rs, err := sqlSession.ExecuteSQL("delete from employees where manager_id IS NULL or name LIKE '%Lee'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.RowsAffected != 2 {
+		t.Fatalf("expected 2 deleted rows, got %d", rs.RowsAffected)
+	}
+	rs, err = sqlSession.ExecuteSQL("select id from employees order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 3 || rs.Rows[0]["id"] != int64(2) || rs.Rows[2]["id"] != int64(4) {
+		t.Fatalf("expected rows 2, 3 and 4 to be left, got %v", rs.Rows)
+	}
+	rs, err = sqlSession.ExecuteSQL("select id from employees where salary = 1500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0]["id"] != int64(4) {
+		t.Fatalf("expected the moved row to stay reachable, got %v", rs.Rows)
+	}
+}
+
+func TestPredicateFromExpr(t *testing.T) {
+	type audit struct {
+		CreatedBy string
+	}
+	type account struct {
+		audit
+		ID      uint64  `json:"id"`
+		Owner   *string `json:"owner,omitempty"`
+		Balance float32 `json:"balance"`
+		Secret  string  `json:"-"`
+		Active  bool
+	}
+	parser, err := sqlparser.New(sqlparser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := "alice"
+	accounts := []account{
+		{audit: audit{CreatedBy: "admin"}, ID: 1 << 60, Owner: &owner, Balance: 12.5, Secret: "x", Active: true},
+		{ID: 1<<60 + 1, Balance: -3},
+	}
+
+	cases := []struct {
+		where    string
+		expected []bool
+	}{
+		// integers beyond 2^53 keep their value, they are not read as float64
+		{"id = 1152921504606846976", []bool{true, false}},
+		{"owner = 'alice' AND balance > 12", []bool{true, false}},
+		{"owner IS NULL", []bool{false, true}},
+		{"CreatedBy = 'admin' AND Active", []bool{true, false}},
+		{"Active = false OR balance < 0", []bool{false, true}},
+		{"Secret = 'x'", []bool{false, false}},
+	}
+	for _, testCase := range cases {
+		expr, err := parser.ParseExpr(testCase.where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		predicate, err := data_query.BuildPredicateFromExpr[*account](expr)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.where, err)
+		}
+		for i := range accounts {
+			if predicate(&accounts[i]) != testCase.expected[i] {
+				t.Fatalf("%s: expected %v for account %d", testCase.where, testCase.expected[i], i)
+			}
+		}
+		if predicate(nil) {
+			t.Fatalf("%s: expected a nil row not to match", testCase.where)
+		}
+	}
+
+	expr, err := parser.ParseExpr("id > 1 AND id < 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicate, err := data_query.BuildPredicateFromExpr[map[string]int](expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !predicate(map[string]int{"id": 2}) || predicate(map[string]int{"id": 3}) || predicate(nil) {
+		t.Fatal("expected only the map with id 2 to match")
+	}
+}
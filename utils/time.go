@@ -40,3 +40,21 @@ func ParseISO8601Duration(iso string) (time.Duration, error) {
 
 	return totalDuration, nil
 }
+
+var sqlTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+// ParseSQLTime parses the DATE, DATETIME, TIMESTAMP and TIME literal formats, values without a zone are UTC.
+func ParseSQLTime(value string) (time.Time, error) {
+	for _, layout := range sqlTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time value: %s", value)
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql/decimal"
+)
+
+// ValueKey returns a comparable key for a stored value, values that are equal in SQL share a key:
+// integral numbers of any type become int64, other numbers float64, []byte becomes string and times are normalized to UTC.
+func ValueKey(value any) any {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return v
+	case float32:
+		return floatKey(float64(v))
+	case float64:
+		return floatKey(v)
+	case decimal.Decimal:
+		if i, ok := v.Int64(); ok && v.Cmp(decimal.NewFromInt(i)) == 0 {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Round(0).UTC()
+	default:
+		return value
+	}
+}
+
+// maxExactFloatInt bounds the integers a float64 represents exactly.
+const maxExactFloatInt = 1 << 53
+
+func floatKey(f float64) any {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 {
+		return int64(f)
+	}
+	return f
+}
+
+// CompareValues orders two non-NULL values and returns -1, 0 or 1.
+// Numbers of any type compare numerically, strings compare with numbers and times when they can be parsed as one.
+func CompareValues(a, b any) (int, error) {
+	switch aValue := a.(type) {
+	case int64:
+		switch bValue := b.(type) {
+		case int64:
+			return cmp.Compare(aValue, bValue), nil
+		case float64:
+			if aValue > -maxExactFloatInt && aValue < maxExactFloatInt {
+				return cmp.Compare(float64(aValue), bValue), nil
+			}
+		}
+	case float64:
+		switch bValue := b.(type) {
+		case float64:
+			return cmp.Compare(aValue, bValue), nil
+		case int64:
+			if bValue > -maxExactFloatInt && bValue < maxExactFloatInt {
+				return cmp.Compare(aValue, float64(bValue)), nil
+			}
+		}
+	}
+
+	if aNumber, ok := toDecimal(a); ok {
+		if bNumber, ok := toDecimal(b); ok {
+			return aNumber.Cmp(bNumber), nil
+		}
+		if bString, ok := b.(string); ok {
+			if bNumber, err := decimal.NewFromString(strings.TrimSpace(bString)); err == nil {
+				return aNumber.Cmp(bNumber), nil
+			}
+		}
+		return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+	}
+
+	switch aValue := a.(type) {
+	case string:
+		switch bValue := b.(type) {
+		case string:
+			return strings.Compare(aValue, bValue), nil
+		case []byte:
+			return bytes.Compare([]byte(aValue), bValue), nil
+		case time.Time:
+			aTime, err := ParseSQLTime(aValue)
+			if err != nil {
+				return 0, err
+			}
+			return aTime.Compare(bValue), nil
+		default:
+			result, err := CompareValues(b, a)
+			return -result, err
+		}
+	case []byte:
+		switch bValue := b.(type) {
+		case []byte:
+			return bytes.Compare(aValue, bValue), nil
+		case string:
+			return bytes.Compare(aValue, []byte(bValue)), nil
+		}
+	case time.Time:
+		switch bValue := b.(type) {
+		case time.Time:
+			return aValue.Compare(bValue), nil
+		case string:
+			bTime, err := ParseSQLTime(bValue)
+			if err != nil {
+				return 0, err
+			}
+			return aValue.Compare(bTime), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// toDecimal converts any numeric value, booleans included, to a decimal so mixed numeric types compare exactly.
+func toDecimal(value any) (decimal.Decimal, bool) {
+	switch v := value.(type) {
+	case int64:
+		return decimal.NewFromInt(v), true
+	case int:
+		return decimal.NewFromInt(int64(v)), true
+	case int32:
+		return decimal.NewFromInt(int64(v)), true
+	case uint64:
+		return decimal.NewFromUint(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return decimal.Decimal{}, false
+		}
+		return decimal.NewFromFloat(v), true
+	case float32:
+		return toDecimal(float64(v))
+	case decimal.Decimal:
+		return v, true
+	case bool:
+		if v {
+			return decimal.NewFromInt(1), true
+		}
+		return decimal.NewFromInt(0), true
+	}
+	return decimal.Decimal{}, false
+}
+
+// FormatValue renders a stored value the way MySQL prints it.
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999")
+	default:
+		return fmt.Sprint(v)
+	}
+}